@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"proj2/png"
+)
+
+// Reads the components of -blurhash, written [x]x[y] with each from 1 to 9
+func parseBlurHashComponents(s string) (int, int, error) {
+	var x, y int
+	if n, err := fmt.Sscanf(s, "%dx%d", &x, &y); err != nil || n != 2 || x < 1 || x > 9 || y < 1 || y > 9 ||
+		fmt.Sprintf("%dx%d", x, y) != s {
+		return 0, 0, fmt.Errorf("invalid -blurhash %q, expected [x]x[y] components from 1 to 9 such as 4x3", s)
+	}
+	return x, y, nil
+}
+
+// Returns the BlurHash of pngImg's output for the manifest with -blurhash, "" without it
+func outputBlurHash(pngImg *png.Image) string {
+	if settings.blurHashX == 0 {
+		return ""
+	}
+	return png.BlurHash(pngImg.Output(), settings.blurHashX, settings.blurHashY)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	stdpng "image/png"
+	"os"
+	"path/filepath"
+	"proj2/imageio"
+	"strings"
+)
+
+// How an output with a size budget was finally encoded, recorded in the manifest
+type SizeBudget struct {
+	MaxBytes    int64  `json:"maxBytes"`
+	Bytes       int64  `json:"bytes"`                 // size of the output as saved
+	Met         bool   `json:"met"`                   // false if even the strongest settings allowed left it over MaxBytes
+	Attempts    int    `json:"attempts"`              // times the output was encoded, 1 if the first try fit
+	Compression string `json:"compression,omitempty"` // PNG compression, fast, balanced or best like -quality
+	Paletted    bool   `json:"paletted,omitempty"`    // true if the PNG was saved with a palette
+	JPEGQuality int    `json:"jpegQuality,omitempty"` // quality of a JPEG output
+}
+
+// Returns the size budget of t: its own maxBytes if it has one, else -max-bytes, 0 for none
+func maxBytes(t ImageTask) int64 {
+	if t.MaxBytes != 0 {
+		return t.MaxBytes
+	}
+	return settings.maxBytes
+}
+
+// Saves img like saveWithPolicy and, if t has a size budget the output doesn't fit in, saves it again over the same
+// path with stronger settings until it fits: best PNG compression then a palette (both lossless, the palette only for
+// images of at most 256 colors), or JPEG quality lowered 10 at a time down to -min-jpeg-quality. Other formats are
+// never retried. An output still over budget is kept with a WARNING, or with -strict kept but not returned, since the
+// task failed. Returns the path img was saved to, "" if it wasn't, and how it was encoded, nil without a budget
+func saveWithinBudget(t ImageTask, img image.Image, opts imageio.EncodeOptions) (string, *SizeBudget, error) {
+	outPath, err := saveWithPolicy(t, img, opts)
+	limit := maxBytes(t)
+	if err != nil || outPath == "" || limit == 0 {
+		return outPath, nil, err
+	}
+	budget := &SizeBudget{MaxBytes: limit, Attempts: 1}
+	for {
+		info, err := os.Stat(outPath)
+		if err != nil {
+			return "", nil, err
+		}
+		budget.Bytes = info.Size()
+		if budget.Bytes <= limit {
+			budget.Met = true
+			break
+		}
+		next, ok := smallerEncoding(outPath, img, opts)
+		if !ok {
+			if taskWarning(t, outPath, "is", budget.Bytes, "bytes even with the strongest settings allowed, "+
+				"over its budget of", limit) {
+				return "", nil, nil
+			}
+			break
+		}
+		//the file is ours now, so it is replaced whatever the overwrite policy, and atomically so a failed retry
+		//leaves the previous attempt in place
+		opts = next
+		opts.Exclusive, opts.Atomic = false, true
+		if err := imageio.Save(outPath, img, opts); err != nil {
+			return "", nil, err
+		}
+		budget.Attempts++
+	}
+	if ext := strings.ToLower(filepath.Ext(outPath)); ext == ".jpg" || ext == ".jpeg" {
+		budget.JPEGQuality = jpegQuality(opts)
+	} else if ext != ".gif" && ext != ".raw" && ext != ".npy" && ext != ".pfm" {
+		budget.Compression = compressionName(opts.Compression)
+		budget.Paletted = opts.Paletted && imageio.FitsPalette(img)
+	}
+	return outPath, budget, nil
+}
+
+// Returns the next step down in size from opts for img saved at outPath, or false if there is none left
+func smallerEncoding(outPath string, img image.Image, opts imageio.EncodeOptions) (imageio.EncodeOptions, bool) {
+	switch strings.ToLower(filepath.Ext(outPath)) {
+	case ".jpg", ".jpeg":
+		quality := jpegQuality(opts)
+		if quality <= settings.minJPEGQuality {
+			return opts, false
+		}
+		opts.JPEGQuality = quality - 10
+		if opts.JPEGQuality < settings.minJPEGQuality {
+			opts.JPEGQuality = settings.minJPEGQuality
+		}
+		return opts, true
+	case ".gif", ".raw", ".npy", ".pfm":
+		return opts, false
+	}
+	if opts.Compression != stdpng.BestCompression {
+		opts.Compression = stdpng.BestCompression
+		return opts, true
+	}
+	if !opts.Paletted && imageio.FitsPalette(img) {
+		opts.Paletted = true
+		return opts, true
+	}
+	return opts, false
+}
+
+// Returns the quality JPEG outputs are encoded at with opts
+func jpegQuality(opts imageio.EncodeOptions) int {
+	if opts.JPEGQuality == 0 {
+		return jpeg.DefaultQuality
+	}
+	return opts.JPEGQuality
+}
+
+// Names a PNG compression level after the -quality profile that uses it
+func compressionName(level stdpng.CompressionLevel) string {
+	switch level {
+	case stdpng.BestSpeed:
+		return "fast"
+	case stdpng.BestCompression:
+		return "best"
+	case stdpng.NoCompression:
+		return "none"
+	}
+	return "balanced"
+}
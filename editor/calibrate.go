@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"proj2/engine"
+	"proj2/imageio"
+	"proj2/png"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runs "editor calibrate [-out=[path]] [-sizes=[pixels,...]] [-repeat=[count]]". Times decoding, encoding and every
+// effect on a single thread on generated square images of each size, fits a fixed time plus a time per megapixel
+// to each, and writes the resulting cost model to path for -cost-model
+func runCalibrate(args []string) {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	outPath := fs.String("out", "costs.json", "a filepath to write the cost model to")
+	sizeList := fs.String("sizes", "256,512,1024", "widths (and heights) of the square images every step is timed on")
+	repeat := fs.Int("repeat", 2, "times each step is run per size, keeping the fastest")
+	fs.Parse(args)
+	sizes, err := parseSizes(*sizeList)
+	if err != nil || fs.NArg() > 0 || *repeat < 1 {
+		if err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println("Usage: editor calibrate [-out=[path]] [-sizes=[pixels,...]] [-repeat=[count]]")
+		os.Exit(2)
+	}
+
+	images := make([]image.Image, len(sizes))
+	pixels := make([]int, len(sizes))
+	for i, size := range sizes {
+		images[i] = calibrationImage(size)
+		pixels[i] = size * size
+	}
+	dir, err := os.MkdirTemp("", "editor-calibrate")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	model := CostModel{SchemaVersion: costModelSchemaVersion, Effects: make(map[string]CostFit)}
+	encodeTimes := make([]float64, len(sizes))
+	decodeTimes := make([]float64, len(sizes))
+	for i, img := range images {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", sizes[i]))
+		encodeTimes[i] = fastest(*repeat, func() {
+			if err := imageio.Save(path, img, imageio.EncodeOptions{}); err != nil {
+				panic(err)
+			}
+		})
+		decodeTimes[i] = fastest(*repeat, func() {
+			if _, _, err := imageio.Load(path); err != nil {
+				panic(err)
+			}
+		})
+	}
+	model.Encode = fitCost(pixels, encodeTimes)
+	model.Decode = fitCost(pixels, decodeTimes)
+
+	s := engine.DefaultSettings()
+	for _, effect := range engine.Effects {
+		times := make([]float64, len(sizes))
+		for i, img := range images {
+			pngImg := png.FromImage(img)
+			times[i] = fastest(*repeat, func() {
+				if err := engine.Apply(pngImg, effect.Code, &s); err != nil {
+					panic(err)
+				}
+			})
+			engine.TakeFindings(pngImg)
+		}
+		model.Effects[effect.Code] = fitCost(pixels, times)
+		fmt.Printf("%s\t%.4fs + %.4fs/megapixel\n", effect.Code, float64(model.Effects[effect.Code].FixedSeconds),
+			float64(model.Effects[effect.Code].SecondsPerMegapixel))
+	}
+
+	data, err := json.MarshalIndent(model, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(*outPath, append(data, '\n'), 0644); err != nil {
+		panic(err)
+	}
+}
+
+// Parses a comma separated list of image sizes
+func parseSizes(s string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(s, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid size %q in -sizes, expected whole numbers of pixels", field)
+		}
+		sizes = append(sizes, size)
+	}
+	for _, size := range sizes {
+		if size != sizes[0] {
+			return sizes, nil
+		}
+	}
+	return nil, fmt.Errorf("-sizes needs at least two different sizes to tell fixed costs from costs per pixel")
+}
+
+// Returns the fewest seconds f took over repeat runs
+func fastest(repeat int, f func()) float64 {
+	best := float64(0)
+	for i := 0; i < repeat; i++ {
+		started := time.Now()
+		f()
+		if elapsed := time.Since(started).Seconds(); i == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return best
+}
+
+// Fits seconds = fixed + perMegapixel * megapixels to the timings by least squares, keeping both parts from going
+// negative, which noise on small images can otherwise cause
+func fitCost(pixels []int, seconds []float64) CostFit {
+	n := float64(len(pixels))
+	var sumX, sumY, sumXX, sumXY float64
+	for i := range pixels {
+		x := float64(pixels[i]) / 1e6
+		sumX += x
+		sumY += seconds[i]
+		sumXX += x * x
+		sumXY += x * seconds[i]
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	if slope < 0 {
+		slope = 0
+	}
+	fixed := (sumY - slope*sumX) / n
+	if fixed < 0 {
+		//all of the time goes to pixels, fitted through the origin instead
+		fixed, slope = 0, sumXY/sumXX
+	}
+	return CostFit{FixedSeconds: decimal(fixed), SecondsPerMegapixel: decimal(slope)}
+}
+
+// Generates a size by size image of smooth gradients overlaid with noise, so effects whose speed depends on
+// detail see some of each, and so the encoder can't compress it to nothing
+func calibrationImage(size int) image.Image {
+	img := image.NewRGBA64(image.Rect(0, 0, size, size))
+	random := rand.New(rand.NewSource(1))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			noise := random.Intn(8192)
+			img.SetRGBA64(x, y, color.RGBA64{uint16(57343*x/size + noise), uint16(57343*y/size + noise),
+				uint16(32768 + noise), 65535})
+		}
+	}
+	return img
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"proj2/png"
+	"sync"
+	"sync/atomic"
+)
+
+// Whether a task with an id has been cancelled, shared by the cancel message naming it and the worker processing it
+type cancellation struct {
+	cancelled int32 // set to 1 atomically by cancelTask
+}
+
+var cancels struct {
+	sync.Mutex
+	byID map[string]*cancellation // tasks with an id that are queued or in progress in the parallel version
+}
+
+// Cancellations of the tasks working on each image, keyed by the image like the watchdog's progress, since that is
+// what the effect code has at hand
+var cancelling sync.Map
+
+// Registers t, just read by the parallel version, so a cancel message can name it by its id. Tasks without an id
+// can't be cancelled. Returns false after an ERROR, failing t, if a task with the same id is queued or in progress
+func registerTask(t *ImageTask) bool {
+	if t.ID == "" {
+		return true
+	}
+	cancels.Lock()
+	defer cancels.Unlock()
+	if cancels.byID == nil {
+		cancels.byID = make(map[string]*cancellation)
+	}
+	if _, ok := cancels.byID[t.ID]; ok {
+		fmt.Println("ERROR:", t.InPath, "not processed: a task with id", t.ID, "is already queued or in progress")
+		recordFailure(*t, "duplicate id "+t.ID)
+		return false
+	}
+	t.cancel = &cancellation{}
+	cancels.byID[t.ID] = t.cancel
+	return true
+}
+
+// Forgets t once it is done, so its id can't be cancelled anymore and can be used again
+func forgetTask(t ImageTask) {
+	if t.cancel == nil {
+		return
+	}
+	cancels.Lock()
+	defer cancels.Unlock()
+	delete(cancels.byID, t.ID)
+}
+
+// Cancels the task with id. Returns false if no task with that id is queued or in progress
+func cancelTask(id string) bool {
+	cancels.Lock()
+	defer cancels.Unlock()
+	c, ok := cancels.byID[id]
+	if ok {
+		atomic.StoreInt32(&c.cancelled, 1)
+	}
+	return ok
+}
+
+func (c *cancellation) isCancelled() bool {
+	return c != nil && atomic.LoadInt32(&c.cancelled) == 1
+}
+
+// Returns true, printing that it was cancelled, if t has been
+func taskCancelled(t ImageTask) bool {
+	if !t.cancel.isCancelled() {
+		return false
+	}
+	fmt.Println("Task", t.ID, "cancelled:", t.InPath, "not processed")
+	return true
+}
+
+// Returns whether the task working on pngImg has been cancelled, so its remaining effects can be skipped
+func imageCancelled(pngImg *png.Image) bool {
+	c, ok := cancelling.Load(pngImg)
+	return ok && c.(*cancellation).isCancelled()
+}
+
+// Removes the outputs of t, saved to outPath or, with -grid, to panels, once t was cancelled while they were being
+// saved. An output that replaced t's own input is kept, since removing it would lose the input as well
+func removeCancelledOutputs(t ImageTask, outPath string, panels []string) {
+	if panels == nil {
+		panels = []string{outPath}
+	}
+	if isInPlace(t) {
+		fmt.Println("WARNING: Task", t.ID, "was cancelled once its output had replaced its input,", outPath, "is kept")
+		return
+	}
+	for _, path := range panels {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the environment variables flags fall back to when they aren't given on the command line
+const envPrefix = "EDITOR_"
+
+// Other names of flags, by the name the flag was defined with. Either name sets the same value
+var flagAliases = map[string][]string{}
+
+// Registers alias as another name of the flag called name in fs
+func aliasFlag(fs *flag.FlagSet, name string, alias string) {
+	f := fs.Lookup(name)
+	fs.Var(f.Value, alias, f.Usage)
+	fs.Lookup(alias).DefValue = f.DefValue
+	flagAliases[name] = append(flagAliases[name], alias)
+}
+
+// Returns whether name is an alias rather than the name a flag was defined with
+func isAlias(name string) bool {
+	for _, aliases := range flagAliases {
+		for _, alias := range aliases {
+			if alias == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns every name of the flag called name, one letter names first, then the rest by length
+func flagNames(name string) []string {
+	names := append([]string{name}, flagAliases[name]...)
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) < len(names[j]) })
+	return names
+}
+
+// Returns the environment variable the flag called name falls back to, after its longest name, e.g.
+// EDITOR_THREADS for -p (--threads)
+func envName(name string) string {
+	names := flagNames(name)
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(names[len(names)-1], "-", "_"))
+}
+
+// Parses args with fs like fs.Parse, after splitting combined one letter flags, so -vp4 is -v -p=4 and -vp 4 is
+// -v -p 4. Flags that aren't given fall back to their environment variable, if it is set
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(splitShortFlags(fs, args))
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		if isAlias(f.Name) {
+			return
+		}
+		for _, name := range flagNames(f.Name) {
+			if given[name] {
+				return
+			}
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			fmt.Printf("invalid value %q of %s: %v\n", value, envName(f.Name), err)
+			fs.Usage()
+			os.Exit(2)
+		}
+	})
+}
+
+// Returns args with every argument made of several one letter flags of fs, such as -vp4, split into one argument
+// per flag. Only the last flag of a group can take a value, either from the rest of the group or the next argument
+func splitShortFlags(fs *flag.FlagSet, args []string) []string {
+	var split []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			split = append(split, args[i:]...) //the flag package stops at the first positional argument too
+			break
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		f := fs.Lookup(name)
+		if f != nil || strings.HasPrefix(arg, "--") || len(name) < 2 || fs.Lookup(name[:1]) == nil {
+			split = append(split, arg)
+			if f != nil && !strings.Contains(arg, "=") && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				split = append(split, args[i]) //the value of the flag, which may start with - itself
+			}
+			continue
+		}
+		group := arg[1:]
+		for j := 0; j < len(group); j++ {
+			f := fs.Lookup(group[j : j+1])
+			if f == nil {
+				split = append(split, "-"+group[j:]) //left for the flag package to report
+				break
+			}
+			if isBoolFlag(f) {
+				split = append(split, "-"+f.Name)
+				continue
+			}
+			value := strings.TrimPrefix(group[j+1:], "=")
+			if value != "" {
+				split = append(split, "-"+f.Name+"="+value)
+			} else {
+				split = append(split, "-"+f.Name)
+				if i+1 < len(args) {
+					i++
+					split = append(split, args[i])
+				}
+			}
+			break
+		}
+	}
+	return split
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Prints the usage for --help, then every flag of fs with its other names, default and environment variable,
+// generated from the flags themselves so it can't fall behind them
+func printFlagHelp(fs *flag.FlagSet) {
+	printUsage()
+	fmt.Println("Options, with their other names, defaults and " + envPrefix + " environment variables:")
+	fs.VisitAll(func(f *flag.Flag) {
+		if isAlias(f.Name) {
+			return
+		}
+		var names []string
+		for _, name := range flagNames(f.Name) {
+			if len(name) == 1 {
+				names = append(names, "-"+name)
+			} else {
+				names = append(names, "--"+name)
+			}
+		}
+		valueName, usage := flag.UnquoteUsage(f)
+		line := "  " + strings.Join(names, ", ")
+		if valueName != "" {
+			line += "=" + valueName
+		}
+		defValue := f.DefValue
+		if defValue == "" {
+			defValue = `""`
+		}
+		fmt.Printf("%s\n    \t%s (default %s, $%s)\n", line, usage, defValue, envName(f.Name))
+	})
+}
+
+// Ranges the values of numeric flags must be in, by flag name. Flags missing from it take any value
+var flagRanges = []struct {
+	name     string
+	min, max float64
+}{
+	{"p", 0, math.Inf(1)},
+	{"k", 1, math.Inf(1)},
+	{"adaptive-radius", 1, 5},
+	{"watchdog-retries", 0, math.Inf(1)},
+	{"jpeg-quality", 1, 100},
+	{"max-bytes", 0, math.Inf(1)},
+	{"min-jpeg-quality", 1, 100},
+	{"prefetch", 0, math.Inf(1)},
+	{"prefetch-mb", 0, math.Inf(1)},
+	{"max-dimension", 0, math.Inf(1)},
+	{"max-decoded-mb", 0, math.Inf(1)},
+	{"chunk", 0, math.Inf(1)},
+	{"cvd-severity", 0, 1},
+	{"max-distance", 0, 63},
+	{"io-nice", 0, 19},
+	{"max-goroutines", 0, math.Inf(1)},
+	{"lens-k1", -1, 1},
+	{"lens-k2", -1, 1},
+	{"vignette", 0, 0.95},
+	{"vignette-falloff", 1, 8},
+}
+
+// Prints err, about a flag whose value is invalid, and exits with status 2 like the flag package does for values it
+// can't parse
+func exitFlagError(err error) {
+	fmt.Println(err)
+	fmt.Println("Run editor --help for the usage")
+	os.Exit(2)
+}
+
+// Checks the flags of the command line once they are parsed, returning an error naming the first one whose value
+// is out of range, or the first argument that isn't a flag
+func validateFlags() error {
+	if flag.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q, tasks are read from standard input", flag.Arg(0))
+	}
+	for _, r := range flagRanges {
+		value, err := strconv.ParseFloat(flag.Lookup(r.name).Value.String(), 64)
+		if err != nil {
+			return fmt.Errorf("-%s must be a number, got %s", r.name, flag.Lookup(r.name).Value)
+		}
+		if value >= r.min && value <= r.max {
+			continue
+		}
+		if math.IsInf(r.max, 1) {
+			return fmt.Errorf("-%s must be at least %v, got %v", r.name, r.min, value)
+		}
+		return fmt.Errorf("-%s must be from %v to %v, got %v", r.name, r.min, r.max, value)
+	}
+	if depth := settings.encodeOptions.BitDepth; depth != 0 && depth != 8 && depth != 16 {
+		return fmt.Errorf("-output-depth must be 8 or 16, got %d", depth)
+	}
+	if !isOverwritePolicy(settings.overwrite) {
+		return fmt.Errorf("-overwrite must be %s, %s, %s or %s, got %q", overwriteError, overwriteSkip,
+			overwriteReplace, overwriteVersion, settings.overwrite)
+	}
+	if settings.adaptInterval <= 0 {
+		return fmt.Errorf("-adapt-interval must be positive, got %v", settings.adaptInterval)
+	}
+	return nil
+}
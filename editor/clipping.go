@@ -0,0 +1,37 @@
+package main
+
+import "proj2/png"
+
+// Pixels of an output that its effect chain clipped to black or to white, recorded in the manifest with -clipping
+type ClippingStats struct {
+	Black         int     `json:"black"`         // pixels with a channel at 0 that wasn't before the effects
+	White         int     `json:"white"`         // pixels with a channel at the maximum that wasn't before the effects
+	BlackFraction decimal `json:"blackFraction"` // Black out of every pixel of the output
+	WhiteFraction decimal `json:"whiteFraction"` // White out of every pixel of the output
+}
+
+// Returns how every pixel of a freshly loaded pngImg is clipped, for clippingWarning once the effects are applied,
+// or nil if neither -clipping nor -clipping-overlay is set
+func inputClipping(pngImg *png.Image) []uint8 {
+	if !settings.clipping && !settings.clippingOverlay {
+		return nil
+	}
+	return pngImg.InputClipping()
+}
+
+// Counts the pixels of pngImg's output the effects newly clipped, given how they were clipped before by
+// inputClipping, and with -clipping-overlay paints them in. Returns nil unless -clipping is set
+func clippingWarning(pngImg *png.Image, before []uint8) *ClippingStats {
+	if before == nil {
+		return nil
+	}
+	black, white := pngImg.ClippingWarning(before, settings.clippingOverlay)
+	if !settings.clipping {
+		return nil
+	}
+	stats := &ClippingStats{Black: black, White: white}
+	if pixels := float64(len(before)); pixels > 0 {
+		stats.BlackFraction, stats.WhiteFraction = decimal(float64(black)/pixels), decimal(float64(white)/pixels)
+	}
+	return stats
+}
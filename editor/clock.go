@@ -0,0 +1,42 @@
+package main
+
+import "time"
+
+// Source of the time for the watchdog, -effect-stats, -stamp and task timings, so tests of timeouts can advance
+// time by hand with a fakeClock instead of sleeping. Calibration always times with the real clock
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// A ticker from a Clock, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// The clock every timing in the editor reads, the real one unless a test replaces it
+var clock Clock = realClock{}
+
+// Returns the time elapsed on clock since t, like time.Since
+func since(t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
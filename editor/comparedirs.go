@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"proj2/imageio"
+	"proj2/png"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Comparison of one file found in both directories
+type PairResult struct {
+	Name       string   `json:"name"`           // path relative to both directories
+	PSNR       *decimal `json:"psnr,omitempty"` // in dB, left out when the images are identical
+	SSIM       decimal  `json:"ssim"`
+	Identical  bool     `json:"identical"`
+	Regression bool     `json:"regression"`         // true if PSNR or SSIM is below the thresholds, or the pair can't be compared
+	DiffPath   string   `json:"diffPath,omitempty"` // image of the differences, saved with -diff-dir
+	Error      string   `json:"error,omitempty"`
+}
+
+// Report written by compare-dirs
+type CompareReport struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	OldDir        string       `json:"oldDir"`
+	NewDir        string       `json:"newDir"`
+	Pairs         []PairResult `json:"pairs"`
+	MissingInNew  []string     `json:"missingInNew"` // files in the old directory without a counterpart in the new one
+	MissingInOld  []string     `json:"missingInOld"`
+	Compared      int          `json:"compared"`
+	Regressions   int          `json:"regressions"`
+	MinSSIM       decimal      `json:"minSSIM"`
+}
+
+// Runs "editor compare-dirs oldDir newDir [-report path] [-p threads] [-min-psnr dB] [-min-ssim index]". Files are
+// paired by their path relative to each directory and compared in parallel. Exits with status 1 if any pair is a
+// regression, so it can gate engine upgrades in scripts
+func runCompareDirs(args []string) {
+	fs := flag.NewFlagSet("compare-dirs", flag.ExitOnError)
+	reportPath := fs.String("report", "", "a filepath for the JSON report, defaults to Stdout")
+	numThreads := fs.Int("p", runtime.NumCPU(), "number of pairs compared at once")
+	minPSNR := fs.Float64("min-psnr", 40, "PSNR in dB below which a pair counts as a regression")
+	minSSIM := fs.Float64("min-ssim", 0.99, "SSIM below which a pair counts as a regression")
+	diffDir := fs.String("diff-dir", "", "a directory to save an image of each differing pair's differences to")
+	smallDiff := fs.Float64("small-diff", 2, "largest channel difference (0-255) shown as small in -diff-dir images")
+	dirs := parseInterspersed(fs, args)
+	if len(dirs) != 2 || *numThreads < 1 {
+		fmt.Println("Usage: editor compare-dirs [oldDir] [newDir] [-report=[path]] [-p=[threads]] [-min-psnr=[dB]] [-min-ssim=[index]]\n" +
+			"\t[-diff-dir=[dir]] [-small-diff=[level]]")
+		os.Exit(2)
+	}
+
+	report := CompareReport{SchemaVersion: compareSchemaVersion, OldDir: dirs[0], NewDir: dirs[1], MissingInNew: []string{}, MissingInOld: []string{}, MinSSIM: 1}
+	oldFiles, err := listFiles(dirs[0])
+	if err != nil {
+		panic(err)
+	}
+	newFiles, err := listFiles(dirs[1])
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for name := range oldFiles {
+		if newFiles[name] {
+			names = append(names, name)
+		} else {
+			report.MissingInNew = append(report.MissingInNew, name)
+		}
+	}
+	for name := range newFiles {
+		if !oldFiles[name] {
+			report.MissingInOld = append(report.MissingInOld, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(report.MissingInNew)
+	sort.Strings(report.MissingInOld)
+
+	report.Pairs = make([]PairResult, len(names))
+	nextPair := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pairIndex := range nextPair {
+				name := names[pairIndex]
+				report.Pairs[pairIndex] = comparePair(name, filepath.Join(dirs[0], name), filepath.Join(dirs[1], name),
+					*minPSNR, *minSSIM, *diffDir, *smallDiff)
+			}
+		}()
+	}
+	for i := range names {
+		nextPair <- i
+	}
+	close(nextPair)
+	wg.Wait()
+
+	for _, pair := range report.Pairs {
+		report.Compared++
+		if pair.Regression {
+			report.Regressions++
+		}
+		if pair.Error == "" && pair.SSIM < report.MinSSIM {
+			report.MinSSIM = pair.SSIM
+		}
+	}
+	writeJSONReport(*reportPath, report)
+	if report.Regressions > 0 {
+		os.Exit(1)
+	}
+}
+
+// Decodes both images and computes their PSNR and SSIM. If diffDir isn't empty and the images differ, an image of
+// their differences is saved there as name with a .png extension
+func comparePair(name string, oldPath string, newPath string, minPSNR float64, minSSIM float64, diffDir string,
+	smallDiff float64) PairResult {
+	result := PairResult{Name: name, Regression: true}
+	oldImg, err := decodeFile(oldPath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	newImg, err := decodeFile(newPath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if oldImg.Bounds().Size() != newImg.Bounds().Size() {
+		result.Error = fmt.Sprintf("sizes differ: %v vs %v", oldImg.Bounds().Size(), newImg.Bounds().Size())
+		return result
+	}
+
+	psnr := png.PSNR(oldImg, newImg)
+	ssim := png.SSIM(oldImg, newImg)
+	result.SSIM = decimal(ssim)
+	result.Identical = math.IsInf(psnr, 1)
+	if !result.Identical {
+		rounded := decimal(psnr)
+		result.PSNR = &rounded
+	}
+	result.Regression = (!result.Identical && psnr < minPSNR) || ssim < minSSIM
+	if diffDir != "" && !result.Identical {
+		diffPath := filepath.Join(diffDir, strings.TrimSuffix(name, filepath.Ext(name))+".png")
+		opts := imageio.EncodeOptions{CreateDirs: true}
+		if err := imageio.Save(diffPath, png.DiffImage(oldImg, newImg, smallDiff), opts); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.DiffPath = diffPath
+		}
+	}
+	return result
+}
+
+func decodeFile(path string) (image.Image, error) {
+	img, _, err := imageio.Load(path)
+	return img, err
+}
+
+// Returns the set of regular files under dir, as paths relative to dir
+func listFiles(dir string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files[rel] = true
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Parses args with fs, allowing flags to come after positional arguments, and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Writes v as indented JSON to path, or to Stdout if path is empty
+func writeJSONReport(path string, v interface{}) {
+	out := io.Writer(os.Stdout)
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"proj2/engine"
+	"strings"
+)
+
+// Contents of the -config file
+type Config struct {
+	// Maps effect names used by task files to the effects they stand for, e.g. {"blur3": "B", "edge": ["G", "E"]}
+	Aliases map[string]EffectList `json:"aliases"`
+
+	// Effect chains with parameters, e.g. {"soft(radius)": [{"type":"blur","radius":"$radius"}, "S"]}, used by
+	// task files as "soft(3)" (see expandMacro)
+	Macros map[string][]json.RawMessage `json:"macros"`
+
+	// Rules changing the effects of tasks based on their input's format, size and bit depth (see Route)
+	Routes []Route `json:"routes"`
+
+	// Most strips of one image each effect runs at once, by effect code or effect object type, e.g. {"A": 8}, in
+	// place of the ceilings of the effect registry (see engine.StripCeiling)
+	MaxStrips map[string]int `json:"maxStrips"`
+}
+
+// A list of effects that can be written in JSON either as a single effect or as an array of them. An effect is a
+// code string or an effect object such as {"type":"blur","radius":3} (see engine.EffectObject), which is held as
+// its code, the object in compact JSON
+type EffectList []string
+
+func (l *EffectList) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+	*l = make(EffectList, len(list))
+	for i, raw := range list {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 && raw[0] == '{' {
+			code, err := engine.ParseEffectObject(raw)
+			if err != nil {
+				return err
+			}
+			(*l)[i] = code
+		} else if err := json.Unmarshal(raw, &(*l)[i]); err != nil {
+			return fmt.Errorf("expected an effect or an array of effects: %v", err)
+		}
+	}
+	return nil
+}
+
+// Writes effect objects back as objects rather than strings holding JSON
+func (l EffectList) MarshalJSON() ([]byte, error) {
+	list := make([]json.RawMessage, len(l))
+	for i, effect := range l {
+		if strings.HasPrefix(effect, "{") {
+			list[i] = json.RawMessage(effect)
+		} else {
+			code, err := json.Marshal(effect)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = code
+		}
+	}
+	return json.Marshal(list)
+}
+
+// The loaded -config file, empty if none was given
+var config Config
+
+// Reads the JSON config file at path into config
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if err := parseMacros(config.Macros); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	for code, ceiling := range config.MaxStrips {
+		if _, ok := engine.Lookup(code); !ok && !isObjectType(code) {
+			return fmt.Errorf("invalid config file %s: maxStrips of %q, which is neither an effect code nor an "+
+				"effect object type", path, code)
+		}
+		if ceiling < 0 {
+			return fmt.Errorf("invalid config file %s: maxStrips of %s is %d, expected 0 (no limit) or more", path,
+				code, ceiling)
+		}
+	}
+	return nil
+}
+
+// Reports whether name is one of engine.EffectObjectTypes
+func isObjectType(name string) bool {
+	for _, objectType := range engine.EffectObjectTypes {
+		if objectType == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces every effect that is an alias in the config by the effects it stands for, and every invocation of one of
+// its macros by the macro's effects for the arguments given. Aliases and macros are expanded only once, so they
+// can't refer to other aliases or macros. Returns why an invocation of a macro can't be expanded
+func expandAliases(effects []string) ([]string, error) {
+	if len(config.Aliases) == 0 && len(macros) == 0 {
+		return effects, nil
+	}
+	var expanded []string
+	for _, effect := range effects {
+		if alias, ok := config.Aliases[effect]; ok {
+			expanded = append(expanded, alias...)
+		} else if chain, ok, err := expandMacro(effect); err != nil {
+			return nil, err
+		} else if ok {
+			expanded = append(expanded, chain...)
+		} else {
+			expanded = append(expanded, effect)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A control message sent on Stdin between tasks by a parent process that runs the editor as a long-lived child:
+//
+//	{"cmd":"flush"} waits until every task read so far has been written before reading more tasks
+//	{"cmd":"set","threads":4} changes the number of threads used for the tasks read after it
+//	{"cmd":"shutdown"} stops reading tasks; tasks already read still finish
+//	{"cmd":"cancel","id":"a1"} cancels the task with id a1, queued or in progress, in the parallel version
+type ControlMessage struct {
+	Cmd     string `json:"cmd"`
+	Threads int    `json:"threads"`
+	ID      string `json:"id"`
+}
+
+// Returned by TaskDecoder when it reads a flush message, so the caller can wait for its tasks
+var errFlush = errors.New("flush requested")
+
+// Number of threads effects are decomposed into in the parallel version. Workers read it at the start of every
+// task, so a "set" message applies to the next tasks
+var decompositionThreads int32
+
+// Tasks that have been read but whose output hasn't been written yet
+var pendingTasks sync.WaitGroup
+
+func currentThreads() int {
+	return int(atomic.LoadInt32(&decompositionThreads))
+}
+
+func setThreads(numThreads int) {
+	runtime.GOMAXPROCS(numThreads)
+	if settings.effects.Pool != nil {
+		settings.effects.Pool.Resize(numThreads)
+	}
+	atomic.StoreInt32(&decompositionThreads, int32(numThreads))
+}
+
+// Applies a control message that doesn't need the caller's help. Returns errFlush or io.EOF (for shutdown) when
+// the caller has to act, nil otherwise
+func (d *TaskDecoder) handleControl(msg ControlMessage) error {
+	if msg.Cmd == "flush" {
+		return errFlush
+	} else if msg.Cmd == "shutdown" {
+		d.closed = true
+	} else if msg.Cmd == "set" {
+		if msg.Threads < 1 {
+			fmt.Println("WARNING: Control message set ignored, threads must be at least 1")
+		} else if currentThreads() == 0 {
+			fmt.Println("WARNING: Control message set ignored, the sequential version has no threads to set")
+		} else {
+			setThreads(msg.Threads)
+		}
+	} else if msg.Cmd == "cancel" {
+		if !cancelTask(msg.ID) {
+			fmt.Println("WARNING: Control message cancel ignored, no task with id", msg.ID, "is queued or in progress")
+		}
+	} else {
+		fmt.Println("WARNING: Control message:", msg.Cmd, " not recognized")
+	}
+	return nil
+}
+
+// Waits until every task read so far has been written, then makes sure the manifest is on disk
+func flushTasks() {
+	pendingTasks.Wait()
+	syncManifest()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"proj2/imageio"
+	"sync"
+	"time"
+)
+
+// Time a step takes on one thread, as a fixed part and a part proportional to the image's size
+type CostFit struct {
+	FixedSeconds        decimal `json:"fixedSeconds"`
+	SecondsPerMegapixel decimal `json:"secondsPerMegapixel"`
+}
+
+// Seconds the step takes on an image of the given number of pixels
+func (fit CostFit) seconds(pixels int) float64 {
+	return float64(fit.FixedSeconds) + float64(fit.SecondsPerMegapixel)*float64(pixels)/1e6
+}
+
+// Cost model written by "editor calibrate" and read with -cost-model: how long decoding, encoding and each effect
+// take on this machine, on a single thread
+type CostModel struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Decode        CostFit            `json:"decode"`
+	Encode        CostFit            `json:"encode"`
+	Effects       map[string]CostFit `json:"effects"` // by effect code
+}
+
+// The loaded -cost-model, nil if none was given
+var costModel *CostModel
+
+// Reads the cost model at path into costModel
+func loadCostModel(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var model CostModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return fmt.Errorf("invalid cost model %s: %v", path, err)
+	}
+	if model.SchemaVersion != costModelSchemaVersion {
+		return fmt.Errorf("cost model %s has schema version %d, expected %d, run editor calibrate again", path,
+			model.SchemaVersion, costModelSchemaVersion)
+	}
+	costModel = &model
+	return nil
+}
+
+// Returns the seconds t should take on one thread to decode, apply its effects to and encode according to the
+// cost model, from the size in its inputs' headers, or 0 without a cost model. Effects the model doesn't know, such
+// as effect objects, are counted as the slowest effect it knows
+func estimateTask(t ImageTask) float64 {
+	if costModel == nil {
+		return 0
+	}
+	effects, _ := expandAliases(routeEffects(t)) //a task whose macros can't be expanded fails before it costs anything
+	pixels := 0
+	seconds := float64(0)
+	for _, path := range taskInputs(t) {
+		info, err := imageio.Probe(path)
+		if err != nil {
+			continue //the task will fail anyway, so it costs next to nothing
+		}
+		pixels = info.Width * info.Height
+		seconds += costModel.Decode.seconds(pixels)
+	}
+	for _, effect := range effects {
+		fit, ok := costModel.Effects[effect]
+		if !ok {
+			for _, known := range costModel.Effects {
+				if known.seconds(pixels) > fit.seconds(pixels) {
+					fit = known
+				}
+			}
+		}
+		seconds += fit.seconds(pixels)
+	}
+	return seconds + costModel.Encode.seconds(pixels)
+}
+
+// Estimated seconds of work, on one thread, of the tasks read but not yet written
+var queuedWork struct {
+	sync.Mutex
+	seconds float64
+}
+
+// Adds seconds of estimated work to the queued work
+func addQueuedWork(seconds float64) {
+	queuedWork.Lock()
+	queuedWork.seconds += seconds
+	queuedWork.Unlock()
+}
+
+// Takes a finished task's estimated seconds off the queued work and, if it was saved to outPath (not "") with
+// -verbose, prints how long the rest of the queued work should take on numThreads threads
+func finishQueuedWork(outPath string, seconds float64, numThreads int) {
+	if costModel == nil {
+		return
+	}
+	queuedWork.Lock()
+	queuedWork.seconds = math.Max(queuedWork.seconds-seconds, 0)
+	left := queuedWork.seconds
+	queuedWork.Unlock()
+	if settings.verbose && outPath != "" {
+		if numThreads < 1 {
+			numThreads = 1
+		}
+		eta := time.Duration(left / float64(numThreads) * float64(time.Second)).Round(100 * time.Millisecond)
+		fmt.Println("Saved", outPath, "- queued tasks should take about", eta, "more")
+	}
+}
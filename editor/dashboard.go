@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"proj2/png"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the -tui dashboard is redrawn
+const dashboardRefresh = 250 * time.Millisecond
+
+// Seconds of throughput the dashboard's graph covers, one column each
+const throughputSeconds = 60
+
+// Lines of output the dashboard keeps on screen below the tasks
+const recentLines = 8
+
+// Characters of the throughput graph, from no task finished in a second to the most finished in any second shown
+var sparks = []rune(" ▁▂▃▄▅▆▇█")
+
+// The -tui dashboard, redrawn in place on the terminal while tasks run: a row with a progress bar for every task in
+// flight, how many tasks finished in each of the last seconds, and the last lines of output. Everything the editor
+// prints meanwhile is collected instead of scrolling the dashboard away, and printed in full once the run is over
+var dashboard struct {
+	sync.Mutex
+	terminal  *os.File  // the real Stdout, which the dashboard draws on
+	output    *os.File  // what Stdout is replaced with while the dashboard is up
+	lines     []string  // every line printed while the dashboard was up
+	collected chan bool // receives once every line printed has been collected
+	stop      chan bool // closed to stop redrawing
+	stopped   chan bool // receives once the last redraw is done
+	rows      map[*taskRow]bool
+	started   time.Time
+	read      int           // tasks read
+	saved     int           // tasks whose output was saved
+	skipped   int           // tasks that finished without saving an output
+	finished  map[int64]int // tasks finished in each second, by Unix time
+	drawn     int           // lines of the last redraw, to go back over
+}
+
+// A task on the dashboard from when a worker takes it until it is done. A nil row, which is what every task gets
+// without -tui, shows nothing
+type taskRow struct {
+	worker  int
+	inPath  string
+	started time.Time
+	stage   string // what the task is doing, such as the code of the effect being applied
+	effects int    // effects to apply, 0 until they are planned
+	applied int    // effects applied so far
+}
+
+// Rows of the tasks working on each image, keyed by the image like the watchdog's progress
+var shown sync.Map
+
+// Starts drawing the dashboard on Stdout, which must be a terminal, and collecting what is printed. Returns false,
+// after a WARNING, if Stdout isn't a terminal
+func startDashboard() bool {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Println("WARNING: -tui needs Stdout to be a terminal, printing the usual output instead")
+		return false
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	dashboard.terminal, dashboard.output = os.Stdout, w
+	dashboard.collected, dashboard.stop, dashboard.stopped = make(chan bool), make(chan bool), make(chan bool)
+	dashboard.rows = make(map[*taskRow]bool)
+	dashboard.finished = make(map[int64]int)
+	dashboard.started = clock.Now()
+	os.Stdout = w
+	go collectLines(r)
+	go redrawDashboard()
+	return true
+}
+
+// Draws the dashboard a last time, gives Stdout back and prints every line collected while it was up
+func stopDashboard() {
+	close(dashboard.stop)
+	<-dashboard.stopped
+	os.Stdout = dashboard.terminal
+	dashboard.output.Close()
+	<-dashboard.collected
+	for _, line := range dashboard.lines {
+		fmt.Println(line)
+	}
+}
+
+// Collects the lines printed to r until it is closed
+func collectLines(r *os.File) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		dashboard.Lock()
+		dashboard.lines = append(dashboard.lines, scanner.Text())
+		dashboard.Unlock()
+	}
+	r.Close()
+	dashboard.collected <- true
+}
+
+func redrawDashboard() {
+	ticker := clock.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dashboard.stop:
+			drawDashboard()
+			dashboard.stopped <- true
+			return
+		case <-ticker.C():
+			drawDashboard()
+		}
+	}
+}
+
+// Counts a task read, for the dashboard's total. Does nothing without -tui
+func countTaskRead() {
+	if dashboard.rows == nil {
+		return
+	}
+	dashboard.Lock()
+	dashboard.read++
+	dashboard.Unlock()
+}
+
+// Puts t on the dashboard as taken by worker, or returns nil without -tui
+func showTask(worker int, t ImageTask) *taskRow {
+	if dashboard.rows == nil {
+		return nil
+	}
+	r := &taskRow{worker: worker, inPath: t.InPath, started: clock.Now(), stage: "decoding"}
+	if r.inPath == "" {
+		r.inPath = strings.Join(t.InPaths, "+")
+	}
+	dashboard.Lock()
+	dashboard.rows[r] = true
+	dashboard.Unlock()
+	return r
+}
+
+// Returns the row of the task working on pngImg, nil if it isn't shown
+func rowOf(pngImg *png.Image) *taskRow {
+	if r, ok := shown.Load(pngImg); ok {
+		return r.(*taskRow)
+	}
+	return nil
+}
+
+// Records that the task of r is to apply effects. Does nothing if r is nil
+func (r *taskRow) plan(effects []string) {
+	if r == nil {
+		return
+	}
+	dashboard.Lock()
+	r.effects, r.applied = len(effects), 0
+	dashboard.Unlock()
+}
+
+// Records what the task of r is doing, such as the effect it is applying. Does nothing if r is nil
+func (r *taskRow) at(stage string) {
+	if r == nil {
+		return
+	}
+	dashboard.Lock()
+	r.stage = stage
+	dashboard.Unlock()
+}
+
+// Records that the task of r finished applying an effect. Does nothing if r is nil
+func (r *taskRow) effectDone() {
+	if r == nil {
+		return
+	}
+	dashboard.Lock()
+	r.applied++
+	dashboard.Unlock()
+}
+
+// Takes r off the dashboard, counting its task as saved to outPath, or skipped if outPath is "". Does nothing if r
+// is nil
+func (r *taskRow) done(outPath string) {
+	if r == nil {
+		return
+	}
+	dashboard.Lock()
+	defer dashboard.Unlock()
+	delete(dashboard.rows, r)
+	if outPath == "" {
+		dashboard.skipped++
+	} else {
+		dashboard.saved++
+	}
+	dashboard.finished[clock.Now().Unix()]++
+}
+
+// Draws the dashboard over its last drawing
+func drawDashboard() {
+	width := 80
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns >= 40 {
+		width = columns
+	}
+	now := clock.Now()
+	dashboard.Lock()
+	var lines []string
+	threads := "sequentially"
+	if numThreads := currentThreads(); numThreads > 0 {
+		threads = fmt.Sprintf("on %d threads", numThreads)
+	}
+	lines = append(lines, fmt.Sprintf("%d tasks read, %d saved, %d skipped, %d in flight %s, %v elapsed",
+		dashboard.read, dashboard.saved, dashboard.skipped, len(dashboard.rows), threads,
+		now.Sub(dashboard.started).Round(time.Second)))
+
+	if pool := settings.effects.Pool.Stats(); pool.Size > 0 {
+		lines = append(lines, fmt.Sprintf("Strip pool: %d of %d goroutines busy, %d strips waiting, %d goroutines in all",
+			pool.Busy, pool.Size, pool.Waiting, countGoroutines()))
+	}
+
+	lines = append(lines, "", "Tasks in flight:")
+	rows := make([]*taskRow, 0, len(dashboard.rows))
+	for r := range dashboard.rows {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].worker != rows[j].worker {
+			return rows[i].worker < rows[j].worker
+		}
+		return rows[i].started.Before(rows[j].started)
+	})
+	barWidth := 20
+	pathWidth := width - barWidth - 32
+	for _, r := range rows {
+		progress := 0.0
+		if r.effects > 0 {
+			progress = float64(r.applied) / float64(r.effects)
+		}
+		filled := int(progress * float64(barWidth))
+		lines = append(lines, fmt.Sprintf("  worker %-3d [%s%s] %-10s %6v  %s", r.worker,
+			strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), truncate(r.stage, 10),
+			now.Sub(r.started).Round(time.Second), truncateLeft(r.inPath, pathWidth)))
+	}
+	if len(rows) == 0 {
+		lines = append(lines, "  none")
+	}
+
+	lines = append(lines, "", fmt.Sprintf("Tasks finished per second, last %d seconds:", throughputSeconds))
+	counts := make([]int, throughputSeconds)
+	most := 0
+	for i := range counts {
+		second := now.Unix() - int64(throughputSeconds-1-i)
+		counts[i] = dashboard.finished[second]
+		if counts[i] > most {
+			most = counts[i]
+		}
+	}
+	for second := range dashboard.finished {
+		if second <= now.Unix()-throughputSeconds {
+			delete(dashboard.finished, second)
+		}
+	}
+	graph := make([]rune, len(counts))
+	for i, count := range counts {
+		graph[i] = sparks[0]
+		if most > 0 {
+			graph[i] = sparks[(count*(len(sparks)-1)+most-1)/most]
+		}
+	}
+	lines = append(lines, fmt.Sprintf("  |%s| peak %d/s", string(graph), most))
+
+	lines = append(lines, "", "Recent output:")
+	recent := dashboard.lines
+	if len(recent) > recentLines {
+		recent = recent[len(recent)-recentLines:]
+	}
+	for _, line := range recent {
+		lines = append(lines, "  "+truncate(line, width-2))
+	}
+	if len(recent) == 0 {
+		lines = append(lines, "  none")
+	}
+	drawn := dashboard.drawn
+	dashboard.drawn = len(lines)
+	dashboard.Unlock()
+
+	//go back to the first line of the last drawing and clear everything below
+	var out strings.Builder
+	if drawn > 0 {
+		fmt.Fprintf(&out, "\x1b[%dF", drawn)
+	}
+	out.WriteString("\x1b[J")
+	for _, line := range lines {
+		out.WriteString(truncate(line, width))
+		out.WriteString("\n")
+	}
+	dashboard.terminal.WriteString(out.String())
+}
+
+// Returns s cut to at most n characters
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n && n >= 0 {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// Returns s cut to at most n characters, keeping its end, which is the telling part of a path
+func truncateLeft(s string, n int) string {
+	if runes := []rune(s); len(runes) > n && n > 3 {
+		return "..." + string(runes[len(runes)-n+3:])
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"proj2/engine"
+	"unicode"
+)
+
+// Decodes tasks from input that is either a stream of concatenated JSON objects (one per line) or a single JSON array
+// of objects. The format is detected from the first non-whitespace character. Control messages (see ControlMessage) can
+// be mixed in with the tasks. Unescaped backslashes in Windows paths are tolerated. It is the engine.TaskSource the
+// editor reads Stdin with and, like json.Decoder, isn't safe for concurrent use
+type TaskDecoder struct {
+	reader  *bufio.Reader
+	dec     *json.Decoder // created once the format has been detected
+	inArray bool          // true if the input is a JSON array
+	failed  bool          // true after a syntax error, since the rest of the input can't be trusted
+	closed  bool          // true after a shutdown message
+}
+
+func NewTaskDecoder(r io.Reader) *TaskDecoder {
+	return &TaskDecoder{reader: bufio.NewReader(&lenientEscapes{r: bufio.NewReader(r)})}
+}
+
+// Decodes the next task, applying any control messages before it. Returns io.EOF once there are no tasks left or
+// a shutdown message was read, and errFlush when a flush message was read. After a syntax error, every following
+// call returns io.EOF
+func (d *TaskDecoder) Next() (engine.Task, error) {
+	for {
+		if d.failed || d.closed {
+			return engine.Task{}, io.EOF
+		}
+		raw, err := d.next()
+		if err != nil {
+			if err != io.EOF {
+				d.failed = true
+			}
+			return engine.Task{}, err
+		}
+
+		var msg ControlMessage
+		if json.Unmarshal(raw, &msg) == nil && msg.Cmd != "" {
+			if err := d.handleControl(msg); err != nil {
+				return engine.Task{}, err
+			}
+			continue
+		}
+		var decoded struct {
+			engine.Task
+			Effects EffectList `json:"effects"` //takes the place of Task.Effects, so effects can be objects
+		}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return engine.Task{}, err
+		}
+		t := decoded.Task
+		t.Effects = decoded.Effects
+		if err := checkTask(&t); err != nil {
+			return engine.Task{}, err
+		}
+		return t, nil
+	}
+}
+
+// Checks the fields of a freshly decoded task, converting its paths to the form the OS takes them in
+func checkTask(t *engine.Task) error {
+	if t.Overwrite != "" && !isOverwritePolicy(t.Overwrite) {
+		return fmt.Errorf("task %s has an unknown overwrite policy %q, expected error, skip, overwrite or "+
+			"version-suffix", t.InPath, t.Overwrite)
+	}
+	if len(t.InPaths) > 0 {
+		if len(t.InPaths) < 2 || t.InPath != "" {
+			return fmt.Errorf("task %s must have either an inPath or at least two inPaths to merge", t.OutPath)
+		}
+		t.InPath = t.InPaths[0] //what the task goes by in messages, routes and -preserve-times
+	}
+	if t.Merge != "" && (len(t.InPaths) == 0 || (t.Merge != mergeExposure && t.Merge != mergeFocus &&
+		t.Merge != mergeStitch)) {
+		return fmt.Errorf("task %s has merge %q, expected exposure, focus or stitch along with inPaths", t.OutPath,
+			t.Merge)
+	}
+	if t.Merge == mergeStitch {
+		rows, cols, ok := parseRowsByCols(t.Grid)
+		if !ok || rows*cols != len(t.InPaths) {
+			return fmt.Errorf("task %s stitches %d inPaths with grid %q, expected [rows]x[cols] with as many cells "+
+				"as inPaths, such as 2x3 for 6", t.OutPath, len(t.InPaths), t.Grid)
+		}
+		if t.Overlap < 0 {
+			return fmt.Errorf("task %s has overlap %d, expected 0 or more pixels", t.OutPath, t.Overlap)
+		}
+	} else if t.Grid != "" || t.Overlap != 0 {
+		return fmt.Errorf("task %s has a grid or overlap, which only go with merge stitch", t.OutPath)
+	}
+	if t.JPEGQuality < 0 || t.JPEGQuality > 100 {
+		return fmt.Errorf("task %s has jpegQuality %d, expected 1 to 100", t.InPath, t.JPEGQuality)
+	}
+	if t.MaxBytes < 0 {
+		return fmt.Errorf("task %s has maxBytes %d, expected a positive number of bytes", t.InPath, t.MaxBytes)
+	}
+	if _, err := engine.ParseHexColor(t.Background); t.Background != "" && err != nil {
+		return fmt.Errorf("task %s has background %q, expected #rrggbb", t.InPath, t.Background)
+	}
+	return checkTaskPaths(t)
+}
+
+// Returns the next JSON value of the input, whether it is a task or a control message
+func (d *TaskDecoder) next() (json.RawMessage, error) {
+	if d.dec == nil {
+		isArray, err := d.startsWithArray()
+		if err != nil {
+			return nil, err
+		}
+		d.dec = json.NewDecoder(d.reader)
+		if isArray {
+			d.inArray = true
+			if _, err := d.dec.Token(); err != nil { //consume the opening bracket
+				return nil, err
+			}
+		}
+	}
+	if d.inArray && !d.dec.More() {
+		return nil, io.EOF //anything after the closing bracket is ignored
+	}
+	var raw json.RawMessage
+	err := d.dec.Decode(&raw)
+	return raw, err
+}
+
+// Skips leading whitespace and reports whether the first remaining character opens an array
+func (d *TaskDecoder) startsWithArray() (bool, error) {
+	for {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if !unicode.IsSpace(rune(c)) {
+			return c == '[', d.reader.UnreadByte()
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"proj2/engine"
+	"proj2/png"
+	"sort"
+	"sync"
+)
+
+// Report written by -dedup
+type DedupReport struct {
+	SchemaVersion  int             `json:"schemaVersion"`
+	Inputs         int             `json:"inputs"`         // distinct inPaths read
+	Duplicates     [][]string      `json:"duplicates"`     // groups of inputs whose files are byte for byte identical
+	NearDuplicates []NearDuplicate `json:"nearDuplicates"` // pairs of inputs that look alike but aren't identical
+	Errors         []InputError    `json:"errors"`
+}
+
+// Two inputs whose perceptual hashes are at most -max-distance bits apart
+type NearDuplicate struct {
+	Paths    [2]string `json:"paths"`
+	Distance int       `json:"distance"` // bits the hashes differ in, out of 64
+}
+
+// An input that couldn't be read or decoded
+type InputError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Hashes of one input
+type inputHash struct {
+	path       string
+	sha        string
+	perceptual uint64
+	err        error
+}
+
+// Reads every task from src, such as the tasks on Stdin, without processing it, hashes the distinct inPaths with
+// numThreads goroutines and writes a report of exact duplicates (same SHA-256) and near-duplicates (perceptual hashes
+// at most maxDistance bits apart) to reportPath, or Stdout if empty, so redundant inputs can be pruned before a run
+func processDedup(src engine.TaskSource, numThreads int, reportPath string, maxDistance int) {
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, t := range readTasks(src) {
+		for _, path := range taskInputs(t) {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	hashes := make([]inputHash, len(paths))
+	var wg sync.WaitGroup
+	nextPath := make(chan int)
+	for i := 0; i < numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pathIndex := range nextPath {
+				hashes[pathIndex] = hashInput(paths[pathIndex])
+			}
+		}()
+	}
+	for i := range paths {
+		nextPath <- i
+	}
+	close(nextPath)
+	wg.Wait()
+
+	report := DedupReport{SchemaVersion: dedupSchemaVersion, Inputs: len(paths), Duplicates: [][]string{},
+		NearDuplicates: []NearDuplicate{}, Errors: []InputError{}}
+	var hashed []inputHash
+	bySHA := make(map[string][]string)
+	for _, h := range hashes {
+		if h.err != nil {
+			report.Errors = append(report.Errors, InputError{Path: h.path, Error: h.err.Error()})
+			continue
+		}
+		if len(bySHA[h.sha]) == 0 {
+			hashed = append(hashed, h) //only one copy of identical files is compared for near-duplicates
+		}
+		bySHA[h.sha] = append(bySHA[h.sha], h.path)
+	}
+	for _, group := range bySHA {
+		if len(group) > 1 {
+			report.Duplicates = append(report.Duplicates, group)
+		}
+	}
+	sort.Slice(report.Duplicates, func(i int, j int) bool { return report.Duplicates[i][0] < report.Duplicates[j][0] })
+	report.NearDuplicates = findNearDuplicates(hashed, maxDistance)
+	writeJSONReport(reportPath, report)
+}
+
+// Returns the SHA-256 of the file at path and the perceptual hash of the image in it
+func hashInput(path string) inputHash {
+	h := inputHash{path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	defer f.Close()
+	sha := sha256.New()
+	if _, err := io.Copy(sha, f); err != nil {
+		h.err = err
+		return h
+	}
+	h.sha = hex.EncodeToString(sha.Sum(nil))
+
+	img, err := decodeFile(path)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	h.perceptual = png.DifferenceHash(img)
+	return h
+}
+
+// Returns every pair of hashes at most maxDistance bits apart. Comparing every pair would take too long for large
+// datasets, so the 64 bits are split into maxDistance+1 bands: hashes that differ in at most maxDistance bits must
+// be equal in at least one band, so only hashes sharing a band are compared
+func findNearDuplicates(hashes []inputHash, maxDistance int) []NearDuplicate {
+	near := []NearDuplicate{}
+	numBands := maxDistance + 1
+	if numBands > 64 {
+		numBands = 64
+	}
+	compared := make(map[[2]int]bool)
+	for band := 0; band < numBands; band++ {
+		low, high := band*64/numBands, (band+1)*64/numBands
+		mask := (uint64(1)<<(high-low) - 1) << low
+		if high-low == 64 {
+			mask = ^uint64(0)
+		}
+		byBand := make(map[uint64][]int)
+		for i, h := range hashes {
+			byBand[h.perceptual&mask] = append(byBand[h.perceptual&mask], i)
+		}
+		for _, candidates := range byBand {
+			for a := 0; a < len(candidates); a++ {
+				for b := a + 1; b < len(candidates); b++ {
+					pair := [2]int{candidates[a], candidates[b]}
+					if compared[pair] {
+						continue
+					}
+					compared[pair] = true
+					distance := png.HashDistance(hashes[pair[0]].perceptual, hashes[pair[1]].perceptual)
+					if distance <= maxDistance {
+						near = append(near, NearDuplicate{
+							Paths: [2]string{hashes[pair[0]].path, hashes[pair[1]].path}, Distance: distance})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(near, func(i int, j int) bool {
+		if near[i].Distance != near[j].Distance {
+			return near[i].Distance < near[j].Distance
+		}
+		return near[i].Paths[0] < near[j].Paths[0]
+	})
+	return near
+}
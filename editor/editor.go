@@ -1,274 +1,1218 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	stdpng "image/png"
 	"io"
-	"math"
 	"os"
+	"proj2/engine"
+	"proj2/imageio"
 	"proj2/png"
-	"runtime"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// Settings that apply to every task in a run, filled in from the command line flags
+var settings struct {
+	floatPipeline bool // keep the working image in float32 between effects instead of quantizing after each one
+	effects engine.Settings // parameters of the effects
+	encodeOptions imageio.EncodeOptions // encoder settings used when saving every output
+	verifyFraction float64 // fraction of parallel tasks that are recomputed sequentially and compared
+	optimize bool // rewrite effect chains into cheaper equivalent ones before running them
+	verbose bool // print extra information about what the editor is doing
+	watchdog time.Duration // how long a task can go without finishing a strip before it counts as stuck, 0 for never
+	watchdogRetries int // times a stuck task is abandoned and started over before it is skipped
+	preserveTimes bool // give each output the modification time of its input
+	noMetadata bool // don't record the effect chain in outputs
+	allowInPlace bool // let tasks replace their own input
+	stamp bool // write a summary of the effects applied into a corner of each output
+	clipping bool // record the pixels the effects clipped to black or white in the manifest
+	blurHashX, blurHashY int // components of the BlurHash recorded for each output in the manifest, 0 for none
+	clippingOverlay bool // paint the pixels the effects clipped to black or white in each output
+	overwrite string // overwrite policy of tasks that don't have their own
+	keepPalette bool // save outputs of indexed inputs with a palette when the effects allow it
+	maxBytes int64 // size budget of outputs of tasks without their own maxBytes, 0 for none
+	minJPEGQuality int // lowest quality JPEG outputs are lowered to to fit their size budget
+	adaptMin, adaptMax int // bounds of the number of threads -adapt-threads picks, 0 without it
+	adaptInterval time.Duration // how often -adapt-threads measures the load
+	ioNice int // niceness added to the threads decoding and encoding images, 0 to run them like any other
+	coerceFormats bool // save outputs to formats that can't hold all of them, with a WARNING, instead of refusing
+	maxGoroutines int // goroutines over which workers wait before starting a task, 0 for no limit
+	strict bool // fail tasks that would otherwise only print a WARNING
+	grid gridLayout // panels every output is split into, with no rows without -grid
+	noAutoFlatten bool // don't flatten outputs to formats without alpha over the background
+	parallelism parallelism // how the parallel version splits its threads between images and their strips
+	warnKernelSum bool // warn about convolve kernels that change the brightness of images
+}
+
 // Instructions for input args
 func printUsage() {
-	usage := "editor [-p=[number of threads]]\n" +
-	"\t-p=[number of threads] = An optional flag to run the editor in its parallel version.\n" +
-	"\t\tCall and pass the runtime.GOMAXPROCS(...) function the integer\n" +
-	"\t\tspecified by [number of threads].\n"
+	usage := "editor [-p=[number of threads]] [-k=[worker depth]] [-float32] [-validate [-report=[path]]]\n" +
+	"\tFlags can be written with - or --, e.g. --jpeg-quality=80, and one letter flags can be combined,\n" +
+	"\te.g. -vp4 for -v -p=4. A flag that isn't given falls back to the environment variable named\n" +
+	"\tEDITOR_ and its long name in upper case with _ for -, e.g. EDITOR_THREADS=8 or EDITOR_JPEG_QUALITY=80.\n" +
+	"\t--help lists every flag with its default and environment variable.\n" +
+	"\t-p=[number of threads], --threads=[number of threads] = An optional flag to run the editor in its\n" +
+	"\t\tparallel version. Call and pass the runtime.GOMAXPROCS(...) function the integer\n" +
+	"\t\tspecified by [number of threads].\n" +
+	"\t-k=[worker depth], --worker-depth=[worker depth] = An optional flag for the parallel version\n" +
+	"\t\tsetting how many worker pipelines run for every 5 threads (see -parallelism), so reading the\n" +
+	"\t\tnext tasks overlaps with processing and writing the previous ones. Defaults to 1. Idle workers\n" +
+	"\t\ttake tasks queued for busy ones, and the strips of every image in flight run on one shared pool\n" +
+	"\t\tof [number of threads] goroutines, so a higher -k keeps more images in flight to fill it.\n" +
+	"\t-parallelism=[policy] = How the parallel version splits its threads between images and the pixels\n" +
+	"\t\tof each image. images keeps one image in flight per thread, each processed on one thread, for\n" +
+	"\t\tmany small images. pixels processes one image at a time, every effect split across every\n" +
+	"\t\tthread, for a few huge images. hybrid (the default) keeps -k images in flight for every 5\n" +
+	"\t\tthreads, each split across every thread, and hybrid:[threads per image] keeps -k images in\n" +
+	"\t\tflight for every [threads per image] threads, each split across that many, e.g. hybrid:4.\n" +
+	"\t\t-k only applies to hybrid. With -adapt-threads, images keeps -p images in flight.\n" +
+	"\t\tWhen fewer images are queued or in progress than would keep every thread busy, such as in a\n" +
+	"\t\tbatch of a few images, each image starting is split across an equal share of the threads instead.\n" +
+	"\t\tImages are never split into more strips than they have rows (and strips are at least as tall as\n" +
+	"\t\ttheir kernel reaches), the threads left over working on other images.\n" +
+	"\t-chunk=[rows] = Rows per strip effects are split into in the parallel version. Defaults to 0,\n" +
+	"\t\tone strip per thread, or four per thread for images of a megapixel or more.\n" +
+	"\t-float32 = Keep each image in float32 per channel from decode to encode, so chained effects are not\n" +
+	"\t\tclamped or rounded to uint16 in between.\n" +
+	"\t-levels-low=[percent], -levels-high=[percent] = Percent of darkest/brightest pixels clipped per\n" +
+	"\t\tchannel by the auto-levels effect \"L\". Default to 0.5.\n" +
+	"\t-shadows=[strength], -highlights=[strength] = Strength from 0 to 1 of the shadow/highlight\n" +
+	"\t\trecovery effect \"H\". Default to 0.5.\n" +
+	"\t-curve=[in:out,...] = Control points (0-255) of the tone curve effect \"C\" for all channels.\n" +
+	"\t\t-curve-r, -curve-g and -curve-b set a curve for a single channel, applied before -curve.\n" +
+	"\t-adaptive-strength=[strength], -adaptive-radius=[pixels], -adaptive-noise=[level] = Settings of\n" +
+	"\t\tthe adaptive sharpen effect \"A\", which sharpens less where the local standard deviation is\n" +
+	"\t\tnear the noise level (0-255). Default to 1, 2 and 5. The radius must be from 1 to 5.\n" +
+	"\t-key-color=[#rrggbb], -key-tolerance=[distance], -key-feather=[distance] = Settings of the chroma\n" +
+	"\t\tkey effect \"K\", which makes pixels within [tolerance] of the key color's hue transparent,\n" +
+	"\t\tfading back to opaque over [feather]. Default to #00ff00, 40 and 20 (distances are 0-255).\n" +
+	"\t-background=[#rrggbb] = Color the flatten effect \"FL\" composites transparent images over, leaving\n" +
+	"\t\tevery pixel opaque. Defaults to #ffffff. A task's own \"background\" field takes precedence.\n" +
+	"\t-no-auto-flatten = Don't flatten outputs to formats without alpha (jpeg, gif and pfm) over the\n" +
+	"\t\tbackground. Without it, \"FL\" is added to the end of their effects, unless they already end with\n" +
+	"\t\ta flatten, so transparent pixels take on the background instead of coming out black.\n" +
+	"\t-dark-frame=[path], -dark-hot=[level] = Calibration frame subtracted by the dark frame effect \"D\",\n" +
+	"\t\twith its values above [level] (0-255, default 255) lowered to it first to tame hot pixels.\n" +
+	"\t-flat-field=[path] = Calibration frame divided out (normalized by its mean) by the flat field\n" +
+	"\t\teffect \"F\". Frames are lined up with the top left corner of each image.\n" +
+	"\t-lens-k1=[k1], -lens-k2=[k2] = Radial distortion coefficients (-1 to 1, default 0) of the lens\n" +
+	"\t\tdistortion correction \"LD\", which reads each pixel at distance r from the center (as a fraction\n" +
+	"\t\tof half the diagonal) from r*(1 + k1*r^2 + k2*r^4). Negative k1 straightens barrel distortion,\n" +
+	"\t\tpositive k1 pincushion distortion. Pixels pulled in from past the edges follow -edge-mode.\n" +
+	"\t-vignette=[fraction], -vignette-falloff=[exponent] = Settings of the vignetting compensation \"LV\",\n" +
+	"\t\twhich brightens each pixel by 1/(1 - fraction*r^exponent) to make up for the [fraction] (0-0.95,\n" +
+	"\t\tdefault 0) of brightness the corners lose. The exponent (1-8) defaults to 2. -flat-field corrects\n" +
+	"\t\ta measured vignette instead.\n" +
+	"\t-gradient=[#rrggbb:position,...] = Stops of the gradient map effect \"M\", which recolors each pixel\n" +
+	"\t\tby where its luminance falls on the gradient, positions going from 0 (black) to 1 (white). Leave\n" +
+	"\t\tout every position to space the stops evenly, e.g. #1b2a49,#e8a33d for a duotone. Defaults to\n" +
+	"\t\t#000000:0,#ffffff:1.\n" +
+	"\t-cvd-severity=[severity] = Severity from 0 (normal vision) to 1 (dichromacy, the default) of the\n" +
+	"\t\tcolor vision deficiency simulated by the effects \"VP\" (protanopia), \"VD\" (deuteranopia) and\n" +
+	"\t\t\"VT\" (tritanopia), and corrected for by the daltonization effects \"XP\", \"XD\" and \"XT\", which\n" +
+	"\t\tshift the color differences the deficiency hides into colors it still tells apart.\n" +
+	"\t-trim-tolerance=[difference] = Settings of the trim report effect \"TR\", which finds the uniform\n" +
+	"\t\tborders of the image (rows and columns along the edges whose pixels are all within [difference],\n" +
+	"\t\t0-255 per channel, of the top left pixel) and records the rectangle left inside them as \"trim\"\n" +
+	"\t\tin the task's manifest line, without changing the image. Defaults to 8.\n" +
+	"\t-quality=[fast|balanced|best] = Selects encoder settings and precision for the whole run. fast\n" +
+	"\t\tfavors encoding speed over file size, best compresses harder and also turns on -float32\n" +
+	"\t\tunless -float32 is given. Defaults to balanced.\n" +
+	"\t-manifest=[path] = Write one JSON line per completed task to [path].\n" +
+	"\t-retry-file=[path] = At the end of the run, list the tasks that failed (those that printed an ERROR\n" +
+	"\t\tand weren't processed or saved, and those -watchdog-retries gave up on) with why, and write them\n" +
+	"\t\tto [path] as JSON tasks with their original fields, followed by the command that reruns them:\n" +
+	"\t\tthis one, reading its tasks from [path]. [path] is written, empty, even if no task failed.\n" +
+	"\t-edge-mode=[zero|wrap-x|extend] = How the kernel effects (S, E, B, T and convolve and blur objects)\n" +
+	"\t\tread pixels past the image's edges. zero (the default) treats them as black, wrap-x reads pixels\n" +
+	"\t\tpast the left and right edges from the opposite edge, so blurred 360 degree equirectangular\n" +
+	"\t\tpanoramas have no seam (pixels past the top and bottom edges are still black), and extend\n" +
+	"\t\trepeats the nearest edge pixel, so borders don't darken, even on images a pixel wide or tall.\n" +
+	"\t-debug-color=[#rrggbb], -debug-clamp=[amount] = Paint pixels of the kernel effects S, E and B in\n" +
+	"\t\t[#rrggbb] (e.g. #ff00ff) where a channel comes out NaN or infinite, or is clamped by more\n" +
+	"\t\tthan [amount] (0-255, default 255), to spot numerically unstable kernels.\n" +
+	"\t-effect-stats=[path] = Write the runs, time, heap allocated and peak heap in use of each effect\n" +
+	"\t\tto [path] as JSON once the run is done. Memory is sampled for the whole process.\n" +
+	"\t-resources = Print what the run used once it is done: CPU time against wall time, as the threads\n" +
+	"\t\tbusy on average out of those given by -p (1 for the sequential version), peak RSS, bytes of image\n" +
+	"\t\tfiles decoded and encoded, and the GC cycles and their total pause. CPU time and peak RSS are only\n" +
+	"\t\tread on Linux. Encoded bytes include outputs saved again to fit their -max-bytes budget.\n" +
+	"\t-otlp-endpoint=[url] = Send OpenTelemetry trace spans to the OTLP/HTTP collector at [url], e.g.\n" +
+	"\t\thttp://localhost:4318: one for the run, one per task under it, and under each task's, one for\n" +
+	"\t\tdecoding, one per effect and one for encoding. If TRACEPARENT holds a W3C trace context, the\n" +
+	"\t\trun's span joins the caller's trace. OTEL_SERVICE_NAME names the service, editor by default.\n" +
+	"\t\tNot available in minimal builds.\n" +
+	"\t-verify=[fraction] = In the parallel version, recompute about [fraction] of the tasks\n" +
+	"\t\tsequentially and compare them pixel for pixel, flagging mismatches in the manifest.\n" +
+	"\t-optimize = Drop effects that provably don't change the output, like a repeated grayscale.\n" +
+	"\t-v, -verbose = Print extra information, such as the effect chains rewritten by -optimize.\n" +
+	"\t-config=[path] = A JSON config file. Its \"aliases\" object maps effect names used in task files\n" +
+	"\t\tto one effect or an array of effects, e.g. {\"aliases\": {\"blur3\": \"B\", \"edge\": [\"G\", \"E\"]}}.\n" +
+	"\t\tIts \"routes\" array changes the effects of tasks whose input matches a condition on its header,\n" +
+	"\t\te.g. {\"routes\": [{\"if\": {\"minWidth\": 4000, \"format\": \"jpeg\"}, \"prepend\": [\"B\"]}]}. Conditions\n" +
+	"\t\tare format, minWidth, maxWidth, minHeight, maxHeight, orientation (landscape, portrait or\n" +
+	"\t\tsquare) and bitDepth. A route can replace (\"effects\"), \"prepend\" and \"append\" effects.\n" +
+	"\t\tOnly the first matching route applies. Its \"maxStrips\" object caps how many strips of one image an\n" +
+	"\t\teffect runs at once, by effect code or effect object type, e.g. {\"maxStrips\": {\"A\": 8, \"blur\": 4}},\n" +
+	"\t\tfor effects that get slower past some number of threads (say once their strips no longer fit in\n" +
+	"\t\tthe CPU cache). The strip pool's other threads work on other images meanwhile, and the output is\n" +
+	"\t\tthe same. \"editor effects\" lists the ceilings in effect, 0 for none. Its \"macros\" object defines\n" +
+	"\t\teffect chains with parameters, used as $name in their effects and given when the macro is invoked,\n" +
+	"\t\te.g. {\"macros\": {\"soft(radius)\": [{\"type\": \"blur\", \"radius\": \"$radius\"}, \"S\"]}} lets a task\n" +
+	"\t\tuse \"soft(3)\". A task invoking a macro with the wrong number of arguments, or arguments that make\n" +
+	"\t\tan invalid effect, fails with an ERROR. Aliases and macros aren't expanded inside a macro.\n" +
+	"\t-cost-model=[path] = A cost model written by \"editor calibrate\". In the parallel version, each task\n" +
+	"\t\tgoes to the worker with the least estimated work queued or in progress, instead of the next one\n" +
+	"\t\tin turn, so workers finish at about the same time, and with -verbose the estimated time left for\n" +
+	"\t\tthe tasks read so far is printed as each output is saved.\n" +
+	"\t-complexity-strips = In the parallel version, size the strips each effect is split into so they\n" +
+	"\t\thold equal amounts of detail (edge density) instead of equal numbers of rows.\n" +
+	"\t-deterministic = Guarantee output that is bit-identical whatever -p is. Effects whose result\n" +
+	"\t\tdepends on how the image is split (such as error diffusion) are applied to the whole image\n" +
+	"\t\ton one thread instead. Every current effect already gives the same bits at any -p, which\n" +
+	"\t\t\"editor selftest\" checks, so this only changes anything for such effects.\n" +
+	"\t-no-mkdir = Fail when an outPath's directory doesn't exist instead of creating it.\n" +
+	"\t-file-mode=[octal] = Permissions of output files, e.g. 0640. They are set exactly, ignoring the\n" +
+	"\t\tumask. Defaults to 0666 less the umask.\n" +
+	"\t-jpeg-quality=[quality] = Quality from 1 to 100 of outputs whose outPath ends in .jpg or .jpeg.\n" +
+	"\t\tDefaults to 90. A task's own \"jpegQuality\" field takes precedence. Outputs ending in .gif are\n" +
+	"\t\treduced to 256 colors, anything else not listed below is saved as PNG. Inputs can be PNG, JPEG\n" +
+	"\t\tor GIF whatever their extension.\n" +
+	"\t-progressive = Save PNG outputs interlaced (Adam7) and JPEG outputs progressive, so browsers show\n" +
+	"\t\ta coarse version of the whole image before it has finished downloading. The pixels are the\n" +
+	"\t\tsame, the files usually a little larger. Other formats are saved as usual. A task's own\n" +
+	"\t\t\"progressive\" field (true or false) takes precedence.\n" +
+	"\t-output-depth=[bits] = Bits per channel of the outputs, 8 or 16. Defaults to 0, each format's\n" +
+	"\t\town: 16 for PNG, 8 for JPEG and GIF. With 8, each channel is rounded to the nearest 8 bit level\n" +
+	"\t\tinstead of truncated, and PNG outputs are saved at 8 bits, about half the size. With 16, outputs\n" +
+	"\t\tin 8 bit formats fail with an ERROR, as for 16 bit sources (unless -coerce-formats).\n" +
+	"\t-dither = Diffuse the rounding error of outputs quantized to 8 bits per channel, by -output-depth=8\n" +
+	"\t\tor by their format, to the neighboring pixels (Floyd-Steinberg), so smooth gradients come out as\n" +
+	"\t\tfine grain instead of bands. Outputs kept at 16 bits aren't dithered.\n" +
+	"\t-max-bytes=[bytes] = Size budget of each output, for destinations with hard size limits. An\n" +
+	"\t\toutput over it is saved again with stronger settings until it fits: PNGs with the best\n" +
+	"\t\tcompression and then, if they have at most 256 colors, a palette (both lossless), JPEGs with\n" +
+	"\t\tthe quality lowered 10 at a time down to -min-jpeg-quality=[quality] (default 50). Other\n" +
+	"\t\tformats aren't retried. An output that still doesn't fit is kept with a WARNING. The final\n" +
+	"\t\tsize and settings are recorded in the manifest. Defaults to 0, no limit. A task's own\n" +
+	"\t\t\"maxBytes\" field takes precedence.\n" +
+	"\t-overwrite=[policy] = What to do when a task's outPath already exists: error (print an ERROR and\n" +
+	"\t\tskip the task), skip (quietly), overwrite (the default) or version-suffix (save to out_1.png,\n" +
+	"\t\tout_2.png... instead). A task's own \"overwrite\" field takes precedence. With outPath == inPath,\n" +
+	"\t\tanything but overwrite protects the original.\n" +
+	"\t-stamp = Write the effects applied, their settings and the time the task took (including\n" +
+	"\t\tdecoding) in the bottom left corner of each output, for telling review renders apart.\n" +
+	"\t-clipping = Record in each task's manifest line how many pixels (and what fraction of them) the\n" +
+	"\t\teffects clipped to black, with a channel at 0, or to white, with a channel at the maximum, that\n" +
+	"\t\tweren't clipped that way in the input, to spot destructive settings across a batch.\n" +
+	"\t-blurhash=[x]x[y] = Record in each task's manifest line a BlurHash of its output with [x] by [y]\n" +
+	"\t\tcomponents (each 1-9, e.g. 4x3): a short string web pages turn into a blurred placeholder while\n" +
+	"\t\tthe image loads (see blurha.sh). The output is averaged down to 64 pixels a side first.\n" +
+	"\t-grid=[rows]x[cols] = Split each output into a grid of panels, e.g. 2x3 for 2 rows of 3, saved\n" +
+	"\t\tto files of their own instead of outPath, for posters printed in parts. Rows and columns are as\n" +
+	"\t\teven as whole pixels allow. Each panel is saved like an output: following the overwrite policy\n" +
+	"\t\t(checked for every panel before the task is processed), fitted to the size budget on its own,\n" +
+	"\t\tand so on. The manifest records the panels' paths, row by row, as \"panels\".\n" +
+	"\t-grid-overlap=[pixels] = Extend each panel [pixels] into the panels right of and below it, so\n" +
+	"\t\tneighboring panels share a strip to glue or trim. Defaults to 0.\n" +
+	"\t-grid-name=[template] = Path of each panel, where {name} is outPath without its extension, {ext}\n" +
+	"\t\tits extension, and {row} and {col} the panel's row and column from 1. Defaults to\n" +
+	"\t\t{name}_r{row}_c{col}{ext}, e.g. poster_r1_c2.png.\n" +
+	"\t-clipping-overlay = Paint those pixels in each output, blue where shadows are clipped, red where\n" +
+	"\t\thighlights are and magenta where both are, like the clipping warning of a raw converter.\n" +
+	"\t-allow-in-place = Let tasks whose outPath is their own inPath (under any name) replace it. Without\n" +
+	"\t\tit they print an ERROR and are skipped. The output is written to a temporary file and renamed\n" +
+	"\t\tover the input once complete, so a failure never leaves the input truncated.\n" +
+	"\t-preserve-times = Give each output the modification time of its input.\n" +
+	"\t-keep-palette = Save PNG outputs of indexed (paletted) inputs with a palette again, rather than\n" +
+	"\t\tas much larger truecolor images, when every effect applied is a point effect (listed as such\n" +
+	"\t\tby \"editor effects\"), which map each color to a single color. The palette is the output's own\n" +
+	"\t\tcolors at 8 bits per channel, so nothing is dithered; outputs that still end up with more than 256\n" +
+	"\t\tcolors (say from -stamp or the calibration effects) are saved in truecolor.\n" +
+	"\t-coerce-formats = Save outputs to formats that can't hold all of them anyway, with a WARNING: a\n" +
+	"\t\tjpeg, gif or pfm output of an image with transparent pixels with -no-auto-flatten (which come out\n" +
+	"\t\tblack), or a jpeg or gif output of a 16 bit input (reduced to 8 bits). Without it, such outputs aren't saved, with an\n" +
+	"\t\tERROR naming the formats that can hold them. \"editor version -json\" lists what each format holds.\n" +
+	"\t-strict = Fail every task that would otherwise print a WARNING about its output, with an ERROR:\n" +
+	"\t\teffects that aren't recognized or used without their calibration frame, outputs coerced by\n" +
+	"\t\t-coerce-formats, outputs over their size budget (left on disk) and parallel results -verify finds\n" +
+	"\t\tdifferent. Outputs whose format can't record the effect chain fail too, unless -no-metadata is set.\n" +
+	"\t\tFailed tasks aren't saved or recorded in the manifest, go to any -retry-file, and make the editor\n" +
+	"\t\texit with status 1 once every task is done.\n" +
+	"\t-no-metadata = Don't record the effect chain, its settings and the engine version in an\n" +
+	"\t\tEffectChain text chunk of each PNG output (or the sidecar of .raw outputs).\n" +
+	"\t-prefetch=[count] = In the parallel version, decode the inputs of up to [count] upcoming tasks, in\n" +
+	"\t\tthe order they are handed to workers, while earlier tasks are processed, so decoding is off\n" +
+	"\t\tthe workers' critical path. Defaults to 0, off: each worker decodes its own input.\n" +
+	"\t-prefetch-mb=[megabytes] = Maximum memory held by images decoded ahead, estimated from their\n" +
+	"\t\tdimensions. Defaults to 0, no limit beyond -prefetch.\n" +
+	"\t-max-dimension=[pixels], -max-decoded-mb=[megabytes] = Largest width or height, and largest size\n" +
+	"\t\tof the decoded pixels, of any image the editor reads. They are checked against the header\n" +
+	"\t\tbefore decoding, so a broken or malicious file claiming to be, say, 100000x100000 fails with an\n" +
+	"\t\terror instead of exhausting memory. -max-decoded-mb covers decoding only: applying effects\n" +
+	"\t\ttakes another 16 bytes per pixel on top of it. Default to 50000 and 4096, 0 for no limit.\n" +
+	"\t-watchdog=[duration] = If a task finishes no strip of any effect for [duration] (e.g. 30s), print\n" +
+	"\t\ta WARNING and a dump of every goroutine's stack to Stderr. Defaults to 0, off.\n" +
+	"\t-watchdog-retries=[count] = Abandon a stuck task and start it over up to [count] times, then skip\n" +
+	"\t\tit. Defaults to 0, which only reports the task and keeps waiting for it.\n" +
+	"\t-io-nice=[niceness] = Decode inputs and encode outputs on threads whose niceness is raised by\n" +
+	"\t\t[niceness] (0-19), so the OS favors the threads applying effects, and any interactive service\n" +
+	"\t\tsharing the machine, over file work. Defaults to 0, off. Only supported on Linux; elsewhere it\n" +
+	"\t\tprints a WARNING and has no effect.\n" +
+	"\t-adapt-threads=[min]:[max] = In the parallel version, measure every -adapt-interval=[duration]\n" +
+	"\t\t(default 5s) how many CPUs other processes kept busy and how much time the hypervisor stole,\n" +
+	"\t\tand set the number of threads to the CPUs left over, between [min] and [max], so overnight\n" +
+	"\t\tbatches back off when other jobs land on the machine and take the CPUs back once they finish.\n" +
+	"\t\tThe run starts with -p threads, and a \"set\" control message only lasts until the next\n" +
+	"\t\tmeasurement. With -v, every change is printed. Only supported on Linux.\n" +
+	"\t-max-goroutines=[count] = In the parallel version, a worker waits before starting its next task\n" +
+	"\t\twhile the process has more than [count] goroutines, e.g. abandoned -watchdog attempts or\n" +
+	"\t\toutputs still being encoded, and goes ahead once the number stops going down. Prints a WARNING\n" +
+	"\t\tthe first time. Defaults to 0, no limit. Strips never start goroutines: every effect is split\n" +
+	"\t\tover one pool of -p goroutines, whose use -v prints at the end of the run.\n" +
+	"\t-tui = Instead of printing as it goes, redraw a dashboard on the terminal: a row with a progress\n" +
+	"\t\tbar for every task in flight, the tasks finished in each of the last 60 seconds, and the last\n" +
+	"\t\tlines of output. Everything printed meanwhile is printed in full once the tasks are done.\n" +
+	"\t\tNeeds Stdout to be a terminal; otherwise it prints a WARNING and has no effect.\n" +
+	"\t-validate = Only check that every task's inPath decodes (no effects are applied) and write one\n" +
+	"\t\tJSON line per image to the report. Images are checked with the same png, jpeg and gif decoders\n" +
+	"\t\ttasks read them with, so an image reported valid can be processed.\n" +
+	"\t-dedup = Only hash every task's inPath (no effects are applied) and write a JSON report of the\n" +
+	"\t\tinputs that are identical files and of pairs that look alike, whose perceptual hashes differ\n" +
+	"\t\tin at most -max-distance=[bits] of 64 (default 5).\n" +
+	"\t-report=[path] = Where -validate and -dedup write their report. Defaults to Stdout. When tasks are\n" +
+	"\t\tprocessed, writes a static HTML page to [path] (e.g. report.html) once they are done, for\n" +
+	"\t\treviewing a batch in a browser: for every output saved, thumbnails of its input and output side\n" +
+	"\t\tby side, the time it took to decode and apply the effects, and each effect with its settings.\n" +
+	"\t\tThe thumbnails are embedded in the page, so it can be shared on its own.\n" +
+	"\t-root=[dir] = Resolve every path of the tasks under [dir], for running the editor as a batch step\n" +
+	"\t\ton tasks that can't be trusted, e.g. in a container with its volume at /data, started with\n" +
+	"\t\tdocker run -i ... -root=/data (or EDITOR_ROOT=/data) and given tasks on Stdin. Relative paths\n" +
+	"\t\tare taken from [dir], absolute ones have to be under it. Tasks with a path whose .. climb above\n" +
+	"\t\t[dir], or that leads out of it through a symbolic link, aren't processed. Prints a WARNING when\n" +
+	"\t\tStdin is a terminal or /dev/null rather than a pipe, as in a container run without -i.\n" +
+	"\t-tasks=[path] = Read tasks from [path], a file or a FIFO, instead of Stdin, which is - . Can be given\n" +
+	"\t\tseveral times to merge several streams into one run, each read as its tasks arrive, e.g.\n" +
+	"\t\t-tasks=static.json -tasks=<(./generate-tasks) with shell process substitution.\n" +
+	"Besides tasks, Stdin can carry control messages: {\"cmd\":\"flush\"} waits for every task read so far,\n" +
+	"{\"cmd\":\"set\",\"threads\":[n]} changes the number of threads and {\"cmd\":\"shutdown\"} stops reading.\n" +
+	"Every -tasks stream can carry them too, a shutdown only stopping the stream it comes in.\n" +
+	"In the parallel version, {\"cmd\":\"cancel\",\"id\":[id]} cancels the task whose \"id\" field is [id],\n" +
+	"whether it is queued or in progress. It stops before its next effect and isn't saved, and an output\n" +
+	"being saved when the cancel arrives is removed once written, unless it replaced the task's input.\n" +
+	"Tasks with an id can't share it with another task queued or in progress, which fails with an ERROR.\n" +
+	"SIGINT (Ctrl-C) or SIGTERM stops reading tasks like a shutdown: the tasks already read finish, the\n" +
+	"manifest and reports are written and the editor exits with status 1. A second one stops it at once.\n" +
+	"Besides codes, a task's effects can be objects: {\"type\":\"convolve\",\"kernel\":[[...],...]} applies a\n" +
+	"square kernel with an odd number of rows (\"normalize\":true divides it by its sum) and\n" +
+	"{\"type\":\"blur\",\"radius\":[pixels]} a Gaussian blur. Kernels reach at most 50 pixels (101x101)\n" +
+	"and their weights must be finite. Strips are never split thinner than the pixels their kernel reaches,\n" +
+	"so a kernel reaching across most of an image is applied to it whole. With -warn-kernel-sum, a convolve\n" +
+	"kernel whose weights add up to neither 1 nor 0 (an edge detector) without \"normalize\" gets a WARNING,\n" +
+	"an ERROR with -strict, since it brightens or darkens the image.\n" +
+	"{\"type\":\"gradient-map\",\"gradient\":\"#rrggbb:position,...\"} is a gradient map with its own stops.\n" +
+	"{\"type\":\"flatten\",\"background\":\"#rrggbb\"} flattens over its own background color.\n" +
+	"A task can merge bracketed exposures of one scene instead of reading a single inPath, with\n" +
+	"\"inPaths\":[\"dark.png\",\"mid.png\",\"bright.png\"]. They are fused (Mertens exposure fusion, each\n" +
+	"pyramid level split across the threads) into one image, which the effects are then applied to.\n" +
+	"With \"merge\":\"focus\", inPaths are instead a series of aligned images focused at different\n" +
+	"distances, stacked into one image in focus everywhere by taking each pixel from the image where\n" +
+	"the Laplacian (as in effect \"E\") is strongest around it.\n" +
+	"With \"merge\":\"stitch\", inPaths are tiles of a larger image, row by row, put back together in a\n" +
+	"grid of \"grid\":\"[rows]x[cols]\" before the effects are applied. Tiles of a row must have the same height\n" +
+	"and tiles of a column the same width. With \"overlap\":[pixels], neighboring tiles share that many\n" +
+	"pixels, blended from one to the other, so the panels -grid saves with -grid-overlap stitch back exactly.\n" +
+	"Tiles are decoded -p at a time and placed in strips across the threads.\n" +
+	"Windows paths can be written with / or with backslashes, escaped (C:\\\\in.png) or not (C:\\in.png),\n" +
+	"though unescaped ones that form a JSON escape such as \\n are rejected. Long paths get the \\\\?\\ prefix.\n" +
+	"Built with the minimal tag (go build -tags minimal), the editor leaves out integrations\n" +
+	"that pull in large dependencies, for a small static binary with every effect, PNG and JPEG, and Stdin\n" +
+	"tasks, e.g. for a scratch container. So far that is only -otlp-endpoint, which needs net/http.\n"
+	usage += "editor compare-dirs [oldDir] [newDir] [-report=[path]] [-p=[threads]] [-min-psnr=[dB]] [-min-ssim=[index]]\n" +
+	"\tPairs the files of both directories by name, reports their PSNR and SSIM as JSON and exits with\n" +
+	"\tstatus 1 if any pair falls below the thresholds (default 40 dB and 0.99). With -diff-dir=[dir],\n" +
+	"\tsaves an image per differing pair showing identical pixels in green, pixels no channel of which\n" +
+	"\tdiffers by more than -small-diff=[level] (0-255, default 2) in yellow, and the rest in red.\n" +
+	"editor sweep -effect=[code or name] -param=[name]=[start]:[end]:[step] [in.png] [outdir] [-p=[renders]]\n" +
+	"\tRenders the effect once for every value of the setting from start to end, in parallel, saving\n" +
+	"\t[outdir]/[in]_[name]_[value].png for each, e.g. -effect=A -param=adaptive-strength=0.5:3:0.5.\n" +
+	"editor calibrate [-out=[path]] [-sizes=[pixels,...]] [-repeat=[count]]\n" +
+	"\tTimes decoding, encoding and every effect on one thread on generated images of each size (default\n" +
+	"\t256,512,1024 pixels square, the fastest of [count] runs, default 2) and writes a cost model of a\n" +
+	"\tfixed time plus a time per megapixel for each to [path] (default costs.json), for -cost-model.\n" +
+	"editor effects\n" +
+	"\tLists every effect with its kind and settings, including their defaults and ranges.\n" +
+	"editor version [-json]\n" +
+	"\tPrints the engine version. With -json, describes the build as JSON for programs to check before\n" +
+	"\tsubmitting tasks: the input and output formats, every effect with a schema of its settings, the\n" +
+	"\teffect object types, which platform or build dependent flags work, and the concurrency defaults.\n" +
+	"editor selftest [effect settings]\n" +
+	"\tRuns every effect on generated images sequentially and in parallel at 1, 2, 4 and 8 threads, in\n" +
+	"\tevery -edge-mode, and checks that the results match. Then saves images with transparent pixels and\n" +
+	"\t16 bit sources to every output format, checking which are refused. Exits with status 1 if any check\n" +
+	"\tfails.\n"
 	fmt.Printf("Usage: " + usage)
 }
 
 func main() {
-	if len(os.Args) > 2 {
-		printUsage()
-		os.Exit(0)
+	if len(os.Args) > 1 && os.Args[1] == "compare-dirs" {
+		runCompareDirs(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sweep" {
+		runSweep(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "calibrate" {
+		runCalibrate(os.Args[2:])
+		return
+	}
+	selftest := len(os.Args) > 1 && os.Args[1] == "selftest"
+	if selftest {
+		os.Args = append(os.Args[:1], os.Args[2:]...) //the effect setting flags still apply to selftest
+	}
+	listEffects := len(os.Args) > 1 && os.Args[1] == "effects"
+	if listEffects {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
+	version := len(os.Args) > 1 && os.Args[1] == "version"
+	versionJSON := false
+	if version {
+		//version takes no other flags, but the effect setting flags still have to be defined for their defaults
+		versionFlags := flag.NewFlagSet("version", flag.ExitOnError)
+		versionFlags.BoolVar(&versionJSON, "json", false, "describe every format, effect and feature as JSON")
+		versionFlags.Parse(os.Args[2:])
+		os.Args = os.Args[:1]
+	}
+
 	numThreads := flag.Int("p", 0, "an int representing number of threads")
-	flag.Parse()
+	workerDepth := flag.Int("k", 1, "an int representing number of worker pipelines for every 5 threads")
+	parallelismPolicy := flag.String("parallelism", parallelHybrid,
+		"images, pixels, hybrid or hybrid:[threads per image], how threads are split between images and their pixels")
+	var taskPaths taskStreams
+	flag.Var(&taskPaths, "tasks", "a file or FIFO to read tasks from, - for Stdin, repeatable (defaults to Stdin)")
+	validate := flag.Bool("validate", false, "only check that input images decode and report corrupt ones")
+	dedup := flag.Bool("dedup", false, "only report duplicate and near-duplicate input images")
+	maxDistance := flag.Int("max-distance", 5, "bits (0-63) perceptual hashes of -dedup near-duplicates can differ in")
+	reportPath := flag.String("report", "", "a filepath for the -validate or -dedup report, defaults to Stdout, or "+
+		"for an HTML gallery of the outputs")
+	flag.BoolVar(&settings.floatPipeline, "float32", false, "keep working images in float32 between effects")
+	defaults := engine.DefaultSettings()
+	flag.Float64Var(&settings.effects.LevelsLowClip, "levels-low", defaults.LevelsLowClip,
+		"percent of darkest pixels clipped by the L effect")
+	flag.Float64Var(&settings.effects.LevelsHighClip, "levels-high", defaults.LevelsHighClip,
+		"percent of brightest pixels clipped by the L effect")
+	flag.Float64Var(&settings.effects.Shadows, "shadows", defaults.Shadows, "shadow recovery strength (0-1) of the H effect")
+	flag.Float64Var(&settings.effects.Highlights, "highlights", defaults.Highlights,
+		"highlight recovery strength (0-1) of the H effect")
+	curveRGB := flag.String("curve", "", "control points in:out,in:out,... of the C effect for all channels")
+	curveRed := flag.String("curve-r", "", "control points of the C effect for the red channel")
+	curveGreen := flag.String("curve-g", "", "control points of the C effect for the green channel")
+	curveBlue := flag.String("curve-b", "", "control points of the C effect for the blue channel")
+	flag.Float64Var(&settings.effects.AdaptiveStrength, "adaptive-strength", defaults.AdaptiveStrength,
+		"strength of the A effect")
+	flag.IntVar(&settings.effects.AdaptiveRadius, "adaptive-radius", defaults.AdaptiveRadius,
+		"neighborhood radius (1-5) of the A effect")
+	flag.Float64Var(&settings.effects.AdaptiveNoise, "adaptive-noise", defaults.AdaptiveNoise,
+		"noise level (0-255) the A effect doesn't sharpen")
+	keyColor := flag.String("key-color", formatHexColor(defaults.KeyColor),
+		"backdrop color #rrggbb made transparent by the K effect")
+	flag.Float64Var(&settings.effects.KeyTolerance, "key-tolerance", defaults.KeyTolerance,
+		"chroma distance (0-255) fully keyed out by the K effect")
+	flag.Float64Var(&settings.effects.KeyFeather, "key-feather", defaults.KeyFeather,
+		"chroma distance over which the K effect fades edges")
+	background := flag.String("background", formatHexColor(defaults.Background),
+		"color #rrggbb the FL effect flattens transparent images over")
+	flag.BoolVar(&settings.warnKernelSum, "warn-kernel-sum", false,
+		"warn about convolve kernels whose weights add up to neither 1 nor 0 and aren't normalized")
+	flag.BoolVar(&settings.noAutoFlatten, "no-auto-flatten", false,
+		"don't flatten outputs to formats without alpha over -background")
+	quality := flag.String("quality", "balanced", "speed/quality profile: fast, balanced or best")
+	flag.Float64Var(&settings.verifyFraction, "verify", 0, "fraction of parallel tasks double-checked sequentially")
+	manifestPath := flag.String("manifest", "", "a filepath to write one JSON line per completed task to")
+	flag.BoolVar(&settings.optimize, "optimize", false, "rewrite effect chains into cheaper equivalent ones")
+	flag.BoolVar(&settings.verbose, "verbose", false, "print extra information, such as optimized effect chains")
+	costModelPath := flag.String("cost-model", "", "a filepath to a cost model written by editor calibrate")
+	configPath := flag.String("config", "", "a filepath to a JSON config file, e.g. defining effect aliases")
+	root := flag.String("root", "", "a directory every task path is resolved and confined under, e.g. a container volume")
+	darkFrame := flag.String("dark-frame", "", "a filepath to the calibration frame subtracted by the D effect")
+	flag.Float64Var(&settings.effects.HotPixel, "dark-hot", defaults.HotPixel,
+		"level (0-255) the D effect lowers hot dark frame pixels to")
+	flatField := flag.String("flat-field", "", "a filepath to the calibration frame divided out by the F effect")
+	flag.Float64Var(&settings.effects.LensK1, "lens-k1", defaults.LensK1, "radial distortion coefficient k1 (-1 to 1) the LD effect undoes")
+	flag.Float64Var(&settings.effects.LensK2, "lens-k2", defaults.LensK2, "radial distortion coefficient k2 (-1 to 1) the LD effect undoes")
+	flag.Float64Var(&settings.effects.Vignette, "vignette", defaults.Vignette,
+		"fraction (0-0.95) of brightness the corners lose that the LV effect makes up for")
+	flag.Float64Var(&settings.effects.VignetteFalloff, "vignette-falloff", defaults.VignetteFalloff,
+		"exponent (1-8) of the distance from the center the LV effect's vignetting grows with")
+	flag.Float64Var(&settings.effects.TrimTolerance, "trim-tolerance", defaults.TrimTolerance,
+		"difference (0-255) from the corner color the TR effect still counts as border")
+	gradient := flag.String("gradient", "#000000:0,#ffffff:1", "stops #rrggbb:position,... of the M effect")
+	flag.Float64Var(&settings.effects.CVDSeverity, "cvd-severity", defaults.CVDSeverity,
+		"severity (0-1) of the color vision deficiency of the V and X effects")
+	flag.BoolVar(&settings.effects.ComplexityStrips, "complexity-strips", false,
+		"split images into strips of equal detail instead of equal height")
+	flag.BoolVar(&settings.effects.Deterministic, "deterministic", false,
+		"never split effects whose output would depend on the number of threads")
+	flag.IntVar(&settings.effects.ChunkRows, "chunk", 0, "rows per strip effects are split into, 0 to pick from -p")
+	edgeMode := flag.String("edge-mode", "zero", "how kernel effects read pixels past the edges: zero, wrap-x or extend")
+	debugColor := flag.String("debug-color", "", "#rrggbb color kernel effects paint unstable pixels in, off if empty")
+	flag.Float64Var(&png.KernelDebug.ClampThreshold, "debug-clamp", 255,
+		"amount (0-255) a channel must be clamped by for -debug-color to flag it")
+	effectStatsPath := flag.String("effect-stats", "", "a filepath to write the time and memory used by each effect to")
+	resourceSummary := flag.Bool("resources", false, "print the CPU time, peak memory, bytes decoded and encoded and GC pauses of the run at its end")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector to send trace spans to, e.g. http://localhost:4318")
+	noMkdir := flag.Bool("no-mkdir", false, "fail instead of creating missing output directories")
+	fileMode := flag.String("file-mode", "", "octal permissions of output files, e.g. 0644, instead of 0666 less the umask")
+	flag.IntVar(&settings.encodeOptions.JPEGQuality, "jpeg-quality", 90, "quality (1-100) of .jpg and .jpeg outputs")
+	flag.BoolVar(&settings.encodeOptions.Progressive, "progressive", false,
+		"save PNG outputs interlaced and JPEG outputs progressive, for web delivery")
+	flag.IntVar(&settings.encodeOptions.BitDepth, "output-depth", 0, "bits per channel (8 or 16) of the outputs, 0 for each format's own")
+	flag.BoolVar(&settings.encodeOptions.Dither, "dither", false, "dither outputs quantized to 8 bits per channel instead of rounding them")
+	flag.Int64Var(&settings.maxBytes, "max-bytes", 0, "largest size in bytes of each output, 0 for no limit")
+	flag.IntVar(&settings.minJPEGQuality, "min-jpeg-quality", 50,
+		"lowest quality (1-100) JPEG outputs are lowered to to fit -max-bytes")
+	flag.StringVar(&settings.overwrite, "overwrite", overwriteReplace,
+		"what to do when an outPath exists: error, skip, overwrite or version-suffix")
+	flag.BoolVar(&settings.stamp, "stamp", false, "write the effect chain, settings and time into a corner of each output")
+	flag.BoolVar(&settings.clipping, "clipping", false, "record pixels the effects clipped to black or white in the manifest")
+	grid := flag.String("grid", "", "[rows]x[cols] panels to split each output into, each saved to a file of its own")
+	gridOverlap := flag.Int("grid-overlap", 0, "pixels each -grid panel extends into the panels right of and below it")
+	gridName := flag.String("grid-name", defaultGridName, "template of the paths of -grid panels")
+	blurHash := flag.String("blurhash", "", "[x]x[y] components of a BlurHash of each output to record in the manifest")
+	flag.BoolVar(&settings.clippingOverlay, "clipping-overlay", false,
+		"paint pixels the effects clipped to black (blue) or white (red) in each output")
+	flag.BoolVar(&settings.allowInPlace, "allow-in-place", false, "let tasks whose outPath is their inPath replace it")
+	flag.BoolVar(&settings.preserveTimes, "preserve-times", false, "give outputs the modification time of their inputs")
+	flag.BoolVar(&settings.keepPalette, "keep-palette", false,
+		"save outputs of indexed inputs with a palette when only point effects were applied")
+	flag.BoolVar(&settings.noMetadata, "no-metadata", false, "don't record the effect chain in a text chunk of each output")
+	prefetchCount := flag.Int("prefetch", 0, "input images decoded ahead of the workers in the parallel version, 0 to disable")
+	prefetchMB := flag.Int64("prefetch-mb", 0, "maximum megabytes of images decoded ahead, 0 for no limit")
+	flag.IntVar(&imageio.DecodeLimits.MaxDimension, "max-dimension", imageio.DecodeLimits.MaxDimension,
+		"largest width or height in pixels of images read, 0 for no limit")
+	maxDecodedMB := flag.Int64("max-decoded-mb", imageio.DecodeLimits.MaxDecodedBytes>>20,
+		"largest size in megabytes of the decoded pixels of images read, 0 for no limit, not counting "+
+			"the 16 bytes per pixel applying effects takes")
+	flag.DurationVar(&settings.watchdog, "watchdog", 0, "time without progress after which a task counts as stuck, 0 to disable")
+	flag.IntVar(&settings.watchdogRetries, "watchdog-retries", 0, "times a stuck task is restarted before it is skipped")
+	flag.IntVar(&settings.ioNice, "io-nice", 0, "niceness (0-19) added to the threads decoding and encoding images")
+	flag.BoolVar(&settings.coerceFormats, "coerce-formats", false, "save outputs to formats that can't hold their alpha or bit depth anyway")
+	flag.IntVar(&settings.maxGoroutines, "max-goroutines", 0, "goroutines over which workers wait before starting a task, 0 for no limit")
+	retryPath := flag.String("retry-file", "", "a filepath to write the tasks that failed to, to rerun them")
+	flag.BoolVar(&settings.strict, "strict", false, "fail tasks with an ERROR instead of printing a WARNING about their output")
+	tui := flag.Bool("tui", false, "show a live dashboard of the tasks in flight on the terminal")
+	adaptThreadsBounds := flag.String("adapt-threads", "", "[min]:[max] threads to pick from, by the load of other processes")
+	flag.DurationVar(&settings.adaptInterval, "adapt-interval", 5*time.Second, "how often -adapt-threads measures the load")
+	aliasFlag(flag.CommandLine, "p", "threads")
+	aliasFlag(flag.CommandLine, "k", "worker-depth")
+	aliasFlag(flag.CommandLine, "verbose", "v")
+	flag.Usage = func() { printFlagHelp(flag.CommandLine) }
+	parseFlags(flag.CommandLine, os.Args[1:])
+	if err := validateFlags(); err != nil {
+		exitFlagError(err)
+	}
+	imageio.DecodeLimits.MaxDecodedBytes = *maxDecodedMB << 20
+	if !applyQualityProfile(*quality) {
+		exitFlagError(fmt.Errorf("-quality must be fast, balanced or best, got %q", *quality))
+	}
+	var err error
+	if *configPath != "" {
+		if err = loadConfig(*configPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		settings.effects.MaxStrips = config.MaxStrips
+	}
+	if *root != "" {
+		if err = setupRoot(*root); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *costModelPath != "" {
+		if err = loadCostModel(*costModelPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if settings.effects.KeyColor, err = engine.ParseHexColor(*keyColor); err != nil {
+		exitFlagError(fmt.Errorf("-key-color: %v", err))
+	}
+	if settings.effects.Background, err = engine.ParseHexColor(*background); err != nil {
+		exitFlagError(fmt.Errorf("-background: %v", err))
+	}
+	if *blurHash != "" {
+		if settings.blurHashX, settings.blurHashY, err = parseBlurHashComponents(*blurHash); err != nil {
+			exitFlagError(fmt.Errorf("-blurhash: %v", err))
+		}
+	}
+	if *grid != "" {
+		if settings.grid, err = parseGrid(*grid, *gridOverlap, *gridName); err != nil {
+			exitFlagError(fmt.Errorf("-grid: %v", err))
+		}
+	}
+	if settings.parallelism, err = parseParallelism(*parallelismPolicy); err != nil {
+		exitFlagError(fmt.Errorf("-parallelism: %v", err))
+	}
+	if settings.encodeOptions.Dither && settings.encodeOptions.BitDepth == 16 {
+		fmt.Println("WARNING: -dither only applies to outputs quantized to 8 bits, not to -output-depth=16")
+	}
+	if *numThreads == 0 && *parallelismPolicy != parallelHybrid {
+		fmt.Println("WARNING: -parallelism only applies to the parallel version, set -p")
+	}
+	if *adaptThreadsBounds != "" {
+		if settings.adaptMin, settings.adaptMax, err = parseThreadBounds(*adaptThreadsBounds); err != nil {
+			exitFlagError(fmt.Errorf("-adapt-threads: %v", err))
+		}
+		if *numThreads == 0 {
+			fmt.Println("WARNING: -adapt-threads only applies to the parallel version, set -p")
+		}
+	}
+	edges, ok := edgeModes[*edgeMode]
+	if !ok {
+		exitFlagError(fmt.Errorf("-edge-mode must be zero, wrap-x or extend, got %q", *edgeMode))
+	}
+	png.Edges = edges
+	if settings.effects.Gradient, err = engine.ParseGradient(*gradient); err != nil {
+		exitFlagError(fmt.Errorf("-gradient: %v", err))
+	}
+	if *debugColor != "" {
+		if png.KernelDebug.Color, err = engine.ParseHexColor(*debugColor); err != nil {
+			exitFlagError(fmt.Errorf("-debug-color: %v", err))
+		}
+	}
+	settings.encodeOptions.CreateDirs = !*noMkdir
+	if *fileMode != "" {
+		mode, err := strconv.ParseUint(*fileMode, 8, 32)
+		if err != nil || mode > 0777 {
+			exitFlagError(fmt.Errorf("-file-mode must be octal permissions such as 0644, got %q", *fileMode))
+		}
+		settings.encodeOptions.FileMode = os.FileMode(mode)
+	}
+	if *darkFrame != "" {
+		if settings.effects.DarkFrame, err = decodeFile(*darkFrame); err != nil {
+			exitFlagError(fmt.Errorf("-dark-frame: %v", err))
+		}
+	}
+	if *flatField != "" {
+		flat, err := decodeFile(*flatField)
+		if err != nil {
+			exitFlagError(fmt.Errorf("-flat-field: %v", err))
+		}
+		settings.effects.FlatField = png.NewFlatField(flat)
+	}
+	curves := []*[]png.CurvePoint{
+		&settings.effects.CurveRGB, &settings.effects.CurveRed, &settings.effects.CurveGreen, &settings.effects.CurveBlue}
+	curveFlags := []string{"curve", "curve-r", "curve-g", "curve-b"}
+	for i, curve := range []string{*curveRGB, *curveRed, *curveGreen, *curveBlue} {
+		if *curves[i], err = parseCurve(curve); err != nil {
+			exitFlagError(fmt.Errorf("-%s: %v", curveFlags[i], err))
+		}
+	}
+
+	if selftest {
+		runSelftest()
+		return
+	}
+	if listEffects {
+		printEffects()
+		return
+	}
+	if version {
+		printVersion(versionJSON)
+		return
+	}
 
-	if *numThreads == 0 {
-		processSequential()
+	//registered first so it runs last, once everything the interrupted run did is written
+	defer func() {
+		if interrupted() {
+			os.Exit(1)
+		}
+	}()
+	completed := false
+	if settings.strict && !*validate && !*dedup {
+		//registered first so it runs last, once the manifest and any -retry-file are written
+		startFailures()
+		defer func() {
+			if completed && countFailures() > 0 {
+				os.Exit(1)
+			}
+		}()
+	}
+	if *resourceSummary {
+		//registered early so it runs once the outputs and reports are written
+		threads := *numThreads
+		if threads == 0 {
+			threads = 1
+		}
+		startResources(threads)
+		defer printResources()
+	}
+	if *manifestPath != "" {
+		openManifest(*manifestPath)
+		defer closeManifest()
+	}
+	if *reportPath != "" && !*validate && !*dedup {
+		startGallery()
+		defer writeGallery(*reportPath)
+	}
+	if *retryPath != "" && !*validate && !*dedup {
+		startFailures()
+		defer writeRetryFile(*retryPath)
+	}
+	if *effectStatsPath != "" {
+		startEffectStats()
+		defer writeEffectStats(*effectStatsPath)
+	}
+	if *otlpEndpoint != "" && !tracingSupported {
+		fmt.Println("WARNING: -otlp-endpoint isn't supported by this minimal build, the run isn't traced")
+	} else if *otlpEndpoint != "" {
+		startTracing(*otlpEndpoint)
+		defer stopTracing()
+	}
+	if *tui && !*validate && !*dedup && startDashboard() {
+		defer stopDashboard()
+	}
+
+	tasks, err := openTaskStreams(taskPaths)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	handleInterrupts()
+	tasks = untilInterrupted(tasks)
+	if *validate {
+		processValidate(tasks, *numThreads, *reportPath)
+	} else if *dedup {
+		processDedup(tasks, *numThreads, *reportPath, *maxDistance)
+	} else if *numThreads == 0 {
+		processSequential(tasks)
 	} else {
-		processParallel(*numThreads)
+		var prefetch *prefetcher
+		if *prefetchCount > 0 {
+			prefetch = newPrefetcher(*prefetchCount, *prefetchMB<<20)
+		}
+		processParallel(tasks, *numThreads, *workerDepth, prefetch)
 	}
+	completed = true
 }
 
-func processSequential(){
-	imageTasks := readJSONInputTasks()
-	for i:=0; i < len(imageTasks); i++{
-		processTask(imageTasks[i])
+// Processes each task as soon as it is read from src, such as the tasks on Stdin, so a parent process can keep feeding
+// the editor tasks
+func processSequential(src engine.TaskSource){
+	for {
+		task, err := src.Next()
+		if err != nil {
+			if err == io.EOF{
+				break
+			}
+			if err == errFlush {
+				flushTasks() //every task read so far is already written
+				continue
+			}
+			fmt.Println(err)
+			continue
+		}
+		t := ImageTask{Task: task}
+		t.trace = startTaskSpan(t)
+		countTaskRead()
+		t.row = showTask(0, t)
+		processTask(t)
+		t.trace.finish()
 	}
 }
 
-func processParallel(numThreads int){
-	runtime.GOMAXPROCS(numThreads)
-	numReaders := int(math.Ceil(float64(numThreads) * (1.0/5.0)))
-	readerDone := make(chan bool)
-
-	var readerMutex sync.Mutex // a lock to allow us to have multiple threads read from Stdin in thread safe manner
-	blockSize := 2 //number of JSON tasks a reader should attempt to chunk and grab
-	dec := json.NewDecoder(os.Stdin)
+// Reads src on this goroutine alone and hands the tasks to worker pipelines through a sharded queue, so no
+// lock is taken per task. Each worker owns a shard, so workers never contend with each other for tasks
+func processParallel(src engine.TaskSource, numThreads int, workerDepth int, prefetch *prefetcher){
+	//strips of every image in flight share one pool of numThreads goroutines
+	settings.effects.Pool = engine.NewPool(numThreads)
+	setThreads(numThreads)
+	if settings.adaptMax > 0 {
+		go adaptThreads(settings.adaptMin, settings.adaptMax, settings.adaptInterval)
+	}
+	numWorkers := settings.parallelism.workers(numThreads, workerDepth)
+	queue := newTaskQueue(numWorkers, queueShardSize)
+	workerDone := make(chan bool)
+	for i := 0; i < numWorkers; i++ {
+		go worker(queue, i, workerDone)
+	}
 
-	for i := 0; i < numReaders; i++ {
-		go reader(numThreads, blockSize, readerDone, &readerMutex, dec, i)
+	for {
+		task, err := src.Next()
+		if err != nil {
+			if err == io.EOF{
+				break
+			}
+			if err == errFlush {
+				flushTasks() //every task read so far has already been handed to a worker
+				continue
+			}
+			fmt.Println(err)
+			continue
+		}
+		t := ImageTask{Task: task}
+		if !registerTask(&t) {
+			continue
+		}
+		t.trace = startTaskSpan(t)
+		countTaskRead()
+		t.cost = estimateTask(t)
+		addQueuedWork(t.cost)
+		pendingTasks.Add(1)
+		atomic.AddInt64(&activeImages, 1)
+		if prefetch != nil {
+			prefetch.start(&t)
+		}
+		queue.push(t)
 	}
+	queue.close()
 
-	//wait until all readers are done using a channel
-	for i := 0; i < numReaders; i++{
-		<- readerDone
+	//wait until all workers are done using a channel
+	for i := 0; i < numWorkers; i++{
+		<- workerDone
 	}
+	printConcurrency()
 }
 
-// Reads in JSON tasks from Stdin and do any preparation needed before applying their effects. Each reader is associated
-// with a single pipeline of workers
-func reader(numThreads int, blockSize int, readerDone chan bool, mutex *sync.Mutex, dec *json.Decoder, readerId int){
-	for true {
-		imageTasksChannel := readJSONInputTasksParallel(mutex, blockSize, dec)
-		numTasks := len(imageTasksChannel)
-		if numTasks == 0 {
-			readerDone <- true
+// Pipeline workers are in charge of performing the filtering effects. Each stage should be dedicated to a
+// specific filtering effect. Effects are decomposed into the number of threads current when the task starts. A
+// worker takes tasks from shard own of the queue, stealing from the others when it runs dry, and starts on its
+// next task while the previous output is still being encoded
+func worker(queue *taskQueue, own int, workerDone chan bool) {
+	writerDone := make(chan bool, 1)
+	writerDone <- true
+	for {
+		waitForGoroutines()
+		imageTask, ok := queue.pop(own)
+		if !ok { //the queue is closed and every shard is empty
 			break
 		}
+		imageTask.row = showTask(own, imageTask)
+		var effects []string
+		ok = !taskCancelled(imageTask) && shouldProcess(imageTask)
+		if ok {
+			effects, ok = planEffects(imageTask)
+		}
+		if !ok {
+			atomic.AddInt64(&activeImages, -1)
+			if imageTask.prefetch != nil {
+				imageTask.prefetch.take() //free its place among the images decoded ahead
+			}
+			queue.done(own, imageTask)
+			finishTask(imageTask, "")
+			continue
+		}
+		numThreads := settings.parallelism.imageThreads(currentThreads(), int(atomic.LoadInt64(&activeImages)))
+		imageTask.row.plan(effects)
+		started := clock.Now()
+		var clipped []uint8
+		var before template.URL
+		pngImg := runWatched(imageTask, func(pngImg *png.Image) {
+			clipped = inputClipping(pngImg)
+			before = inputThumbnail(pngImg)
+			if settings.floatPipeline {
+				processEffectsFloat(pngImg, effects, numThreads)
+			} else {
+				processEffectsPipeline(pngImg, effects, numThreads)
+			}
+		})
+		queue.done(own, imageTask)
+		atomic.AddInt64(&activeImages, -1)
+		if pngImg == nil || taskCancelled(imageTask) {
+			finishTask(imageTask, "")
+			continue
+		}
 
-		//every reader spawns a single worker pipeline goroutine
-		workerDone := make(chan bool, 1)
-		go worker(numThreads, numTasks, imageTasksChannel, workerDone)
-		close(imageTasksChannel) //close out the imageTasksChannel once worker is done processing it
+		//for a sample of tasks, redo the effects sequentially and compare, to catch decomposition bugs
+		entry := ManifestEntry{InPath: imageTask.InPath, InPaths: imageTask.InPaths, Merge: imageTask.Merge,
+			OutPath: imageTask.OutPath, Effects: effects}
+		if sampleForVerification() {
+			entry.Verified = true
+			var failed bool
+			if entry.MismatchedPixels, failed = verifyAgainstSequential(imageTask, effects, pngImg); failed {
+				finishTask(imageTask, "")
+				continue
+			}
+		}
+		entry.Clipping = clippingWarning(pngImg, clipped)
+		entry.Trim = engine.TakeFindings(pngImg).Trim
 
-		//wait until worker goroutine finishes
-		<- workerDone
+		//save image
+		card := newGalleryCard(imageTask, effects, before, pngImg, since(started))
+		stampSummary(pngImg, effects, started)
+		entry.BlurHash = outputBlurHash(pngImg)
+		<- writerDone //at most one output per worker is being encoded at a time
+		go writer(pngImg, imageTask, effects, entry, card, writerDone)
 	}
+	<- writerDone //wait until the last writer goroutine finishes
+	workerDone <- true
 }
 
-// Pipeline workers are in charge of performing the filtering effects. Each stage should be dedicated to a
-// specific filtering effect
-func worker(numThreads int, numTasks int, imageTasksChannel <- chan ImageTask, workerDone chan bool) {
-	for taskCounter:=0; taskCounter < numTasks; taskCounter++ { //loop through the JSON tasks we took from Stdin, upper bounded by blockSize
-		imageTask := <- imageTasksChannel
-		effects := imageTask.Effects
-		pngImg, err := png.Load(imageTask.InPath)
-		if err != nil {
-			panic(err)
-		}
-
-		//**BEGINNING OF PIPELINE SECTION**
-		//pipeline workers using the take-and-repeat pipeline structure
-		//where each effect must be applied in order and within each effect we perform data decomposition in parallel
-		processEffectParallel := func(effectsDone <- chan interface{}, effects []string, effectsCounter *int, pngImg *png.Image) <- chan *png.Image {
-			imgStream := make(chan *png.Image)
-			go func() {
-				defer close(imgStream)
-				for i := 0; i < len(effects); i++{
-					effect := effects[*effectsCounter]
-					pngImg :=parallelDecomposeEffect(pngImg, effect, numThreads)
-
-					//if we're not on the final effect, pass the in img to out img to stack effects
-					if i != len(effects) -1 {
-						pngImg.SetImgOutToIn()
-					}
-					select {
-					case <-effectsDone:
-						return
-					case imgStream <- pngImg:
-						*effectsCounter++
-					}
-				}
-			}()
-			return imgStream
-		}
-
-		pipelineEffects := func(effectsDone <- chan interface{}, imgStream <- chan *png.Image, numEffects int) <- chan *png.Image {
-			takeImgStream := make(chan *png.Image)
-			go func() {
-				defer close(takeImgStream)
-				for effectsCounter := 0; effectsCounter < numEffects; effectsCounter++{
-					select {
-					case <-effectsDone:
-						return
-					case takeImgStream <- <-imgStream:
-					}
+// Applies the effects in order using the take-and-repeat pipeline, decomposing each effect across numThreads
+// goroutines
+func processEffectsPipeline(pngImg *png.Image, effects []string, numThreads int) {
+	if len(effects) == 0 { //nothing fills the output, so it's saved as the input was
+		pngImg.KeepInput()
+		return
+	}
+	//**BEGINNING OF PIPELINE SECTION**
+	//pipeline workers using the take-and-repeat pipeline structure
+	//where each effect must be applied in order and within each effect we perform data decomposition in parallel
+	processEffectParallel := func(effectsDone <- chan interface{}, effects []string, effectsCounter *int, pngImg *png.Image) <- chan *png.Image {
+		imgStream := make(chan *png.Image)
+		go func() {
+			defer close(imgStream)
+			for i := 0; i < len(effects); i++{
+				effect := effects[*effectsCounter]
+				//a cancelled task's remaining effects are skipped, but its image still goes through every stage
+				if !imageCancelled(pngImg) {
+					measureEffect(pngImg, effect, func() { parallelDecomposeEffect(pngImg, effect, numThreads) })
 				}
-			}()
-			return takeImgStream
-		}
 
-		effectsDone := make(chan interface{})
-		effectsCounter := new(int)
-		*effectsCounter = 0
-		for range pipelineEffects(effectsDone,
-			processEffectParallel(effectsDone, effects, effectsCounter, pngImg),
-			len(effects)){}
-		close(effectsDone)
-		// **END OF PIPELINE SECTION**
+				//if we're not on the final effect, pass the in img to out img to stack effects
+				if i != len(effects) -1 {
+					pngImg.SetImgOutToIn()
+				}
+				select {
+				case <-effectsDone:
+					return
+				case imgStream <- pngImg:
+					*effectsCounter++
+				}
+			}
+		}()
+		return imgStream
+	}
 
-		//save image
-		writerDone := make(chan bool, 1)
-		go writer(pngImg, imageTask.OutPath, writerDone)
-		<- writerDone //wait until writer goroutine finishes
+	pipelineEffects := func(effectsDone <- chan interface{}, imgStream <- chan *png.Image, numEffects int) <- chan *png.Image {
+		takeImgStream := make(chan *png.Image)
+		go func() {
+			defer close(takeImgStream)
+			for effectsCounter := 0; effectsCounter < numEffects; effectsCounter++{
+				select {
+				case <-effectsDone:
+					return
+				case takeImgStream <- <-imgStream:
+				}
+			}
+		}()
+		return takeImgStream
 	}
-	workerDone <- true
+
+	effectsDone := make(chan interface{})
+	effectsCounter := new(int)
+	*effectsCounter = 0
+	for range pipelineEffects(effectsDone,
+		processEffectParallel(effectsDone, effects, effectsCounter, pngImg),
+		len(effects)){}
+	close(effectsDone)
+	// **END OF PIPELINE SECTION**
 }
 
-// Writers save the filtered image to its outpath file
-func writer(pngImg *png.Image, outPath string, writerDone chan bool){
-	err := pngImg.Save(outPath)
+// Writers save the filtered image to its outpath file, record entry in the manifest with the path it was saved to
+// (nothing if the task's overwrite policy kept it from being saved), mark the task done, then send true. A task
+// cancelled before it is saved isn't, and one cancelled while it is being saved has its outputs removed
+func writer(pngImg *png.Image, t ImageTask, effects []string, entry ManifestEntry, card *galleryCard, writerDone chan bool){
+	var outPath string
+	var panels []string
+	var budget *SizeBudget
+	var err error
+	if !taskCancelled(t) {
+		outPath, panels, budget, err = saveOutput(t, pngImg, effects)
+	}
 	if err != nil {
-		panic(err)
+		reportSaveError(t, err)
+		outPath, panels = "", nil
+	}
+	if outPath != "" && taskCancelled(t) {
+		removeCancelledOutputs(t, outPath, panels)
+		outPath, panels = "", nil
 	}
+	entry.Panels, entry.SizeBudget = panels, budget
+	if entry.OutPath = outPath; outPath != "" {
+		recordManifest(entry)
+		recordGallery(card, outPath)
+	}
+	finishTask(t, outPath)
 	writerDone <- true
 }
 
-//spawns numThread number of goRoutines, which will decompose a single image and perform effect on horizontally sliced subimages in parallel
-func parallelDecomposeEffect(pngImg *png.Image, effect string, numThreads int) *png.Image{
-	subImageWaitChannel := make(chan bool)
-	height := pngImg.GetHeight()
-	sectionHeight := math.Ceil(float64(height) / float64(numThreads))
+// Ends t once it was saved to outPath, or with outPath "" once it was skipped, failed or cancelled: takes it off the
+// queued work, the trace, the dashboard and the tasks that can be cancelled, and marks it done
+func finishTask(t ImageTask, outPath string) {
+	finishQueuedWork(outPath, t.cost, currentThreads())
+	t.trace.finish()
+	t.row.done(outPath)
+	forgetTask(t)
+	pendingTasks.Done()
+}
 
-	for sectionIndex := 0; sectionIndex < numThreads; sectionIndex++ {
-		floor := float64(sectionIndex) * sectionHeight + 1
-		if sectionIndex == 0 {
-			floor = float64(0)
+// Saves the output of pngImg, made by applying effects, to t's outPath following its overwrite policy and, with
+// -preserve-times, gives it the modification time of t's inPath. An output replacing its own input is written to a
+// temporary file first and renamed over it, so the input is never left truncated. An output over its size budget is
+// saved again with stronger settings. With -grid, each panel of the output is saved that way to a file of its own.
+// Returns the path the output was saved to, or "" if it wasn't saved, the paths of its panels, nil without -grid,
+// and how it was fitted to its budget, nil if it has none or was split into panels
+func saveOutput(t ImageTask, pngImg *png.Image, effects []string) (string, []string, *SizeBudget, error) {
+	defer t.trace.child("encode").finish()
+	t.row.at("encoding")
+	opts := outputOptions(effects, &settings.effects, settings.floatPipeline)
+	if t.JPEGQuality != 0 {
+		opts.JPEGQuality = t.JPEGQuality
+	}
+	if t.Progressive != nil {
+		opts.Progressive = *t.Progressive
+	}
+	opts.Paletted = keepsPalette(t, effects) //before saving, since saving can replace the input
+	opts.SourceBitDepth = inputBitDepth(t)
+	first := outputTasks(t)[0] //every panel of a -grid has the same format
+	if opts.Coerce = settings.coerceFormats; opts.Coerce && warnCoerced(first, pngImg.Output(), opts.KeptBitDepth()) {
+		return "", nil, nil, nil
+	}
+	if settings.strict && len(opts.Text) > 0 && !imageio.KeepsText(first.OutPath) && taskWarning(t, "outPath",
+		first.OutPath, "of", t.InPath, "would be saved without its effect chain, which",
+		imageio.OutputFormat(first.OutPath), "outputs can't record (use -no-metadata to allow it)") {
+		return "", nil, nil, nil
+	}
+	var inInfo os.FileInfo
+	if settings.preserveTimes {
+		//read before saving, since saving can replace the input
+		var err error
+		if inInfo, err = os.Stat(t.InPath); err != nil {
+			return "", nil, nil, err
 		}
-		ceil := float64(sectionIndex + 1) * sectionHeight
-		go processPartialImg(subImageWaitChannel, pngImg, effect, floor, ceil)
-
 	}
+	if settings.grid.rows == 0 {
+		outPath, budget, err := saveFile(t, pngImg.Output(), opts, inInfo)
+		return outPath, nil, budget, err
+	}
+	panels, err := saveGrid(t, pngImg.Output(), opts, inInfo)
+	if err != nil || panels == nil {
+		return "", nil, nil, err
+	}
+	return t.OutPath, panels, nil, nil
+}
 
-	//wait to make sure all subimages complete by emptying out channel
-	for sectionIndex := 0; sectionIndex < numThreads; sectionIndex++ {
-		<- subImageWaitChannel
+// Fails t with an ERROR saying why its output couldn't be saved. An output saved before the error, such as one whose
+// modification time couldn't be set, is left as it is but not recorded in the manifest
+func reportSaveError(t ImageTask, err error) {
+	fmt.Println("ERROR: outPath", t.OutPath, "of", strings.Join(taskInputs(t), "+"), "not saved:", err)
+	recordFailure(t, err.Error())
+}
+
+// Saves img to t's outPath like saveOutput, with opts and, if inInfo isn't nil, the modification time of inInfo
+func saveFile(t ImageTask, img image.Image, opts imageio.EncodeOptions, inInfo os.FileInfo) (string, *SizeBudget,
+	error) {
+	var outPath string
+	var budget *SizeBudget
+	var err error
+	opts.Atomic = replacesInput(t)
+	atIOPriority(func() { outPath, budget, err = saveWithinBudget(t, img, opts) })
+	if capErr, ok := err.(*imageio.CapabilityError); ok {
+		fmt.Println("ERROR: outPath", t.OutPath, "of", t.InPath, "not saved:", capErr, "(or use -coerce-formats)")
+		recordFailure(t, capErr.Error())
+		return "", nil, nil
 	}
-	return pngImg
+	if err != nil || outPath == "" || inInfo == nil {
+		return outPath, budget, err
+	}
+	return outPath, budget, os.Chtimes(outPath, inInfo.ModTime(), inInfo.ModTime())
 }
 
-func processPartialImg(subImageWaitChannel chan bool, pngImg *png.Image, effect string, floor float64, ceil float64) {
-	subImg := png.NewImg(pngImg.GetSubImg(int(floor)-5, int(ceil)+5)) // need small buffers on floor and ceil so subimage can convolute on subimages' edges properly
-	processEffect(subImg, effect)
-	pngImg.UseSubsetImg(subImg, int(floor), int(ceil))
-	subImageWaitChannel <- true
+// Loads the image at path in any format imageio reads, detected from its header, on a thread niced by -io-nice
+func loadImage(path string) (*png.Image, error) {
+	var img image.Image
+	var err error
+	atIOPriority(func() { img, _, err = imageio.Load(path) })
+	if err != nil {
+		return nil, err
+	}
+	return png.FromImage(img), nil
 }
 
-// Reads in Stdin JSON inputs in a thread safe manner by locking each time it's called. Reader goroutines will
-// all attempt to access Stdin through this function. Outputs a channel of ImageTasks that gets passed downstream to
-// worker goroutine
-func readJSONInputTasksParallel(lock *sync.Mutex, blockSize int, dec *json.Decoder) chan ImageTask{
-	lock.Lock()
-	imageTasksChannel := make(chan ImageTask, blockSize)
-	for i:=0; i < blockSize; i++{ //loop through blocksize amount of each json objects as ImageTask
-		var t ImageTask
-		err := dec.Decode(&t)
-		if err != nil {
-			if err == io.EOF{
-				break
-			}
-		}
-		imageTasksChannel <- t
+//spawns numThread number of goRoutines, which will decompose a single image and perform effect on horizontally sliced subimages in parallel
+func parallelDecomposeEffect(pngImg *png.Image, effect string, numThreads int) *png.Image{
+	stripDone := func() { markProgress(pngImg) }
+	if err := engine.DecomposeProgress(pngImg, effect, numThreads, &settings.effects, stripDone); err != nil {
+		fmt.Println("WARNING: Effect command:", effect, " not recognized")
 	}
-	lock.Unlock()
-	return imageTasksChannel
+	return pngImg
 }
 
-// Reads in Stdin JSON inputs sequentially
-func readJSONInputTasks() []ImageTask{
+// Reads in every task from src, such as the JSON inputs on Stdin, which like in the parallel version can be a stream
+// of JSON objects or a JSON array of them
+func readTasks(src engine.TaskSource) []ImageTask{
 	var imageTasks []ImageTask
-	dec := json.NewDecoder(os.Stdin)
 	for { //loop through and process each json object as task
-		var t ImageTask
-		err := dec.Decode(&t)
+		task, err := src.Next()
 		if err != nil {
 			if err == io.EOF{
 				break
 			}
-			fmt.Println(err)
+			if err != errFlush { //nothing has been processed yet, so there is nothing to flush
+				fmt.Println(err)
+			}
+			continue
 		}
-		imageTasks = append(imageTasks, t)
+		imageTasks = append(imageTasks, ImageTask{Task: task})
 	}
 	return imageTasks
 }
 
 // Sequentially execute each effect in order without image decomposition
 func processTask(t ImageTask) {
-	pngImg, err := png.Load(t.InPath)
+	if !shouldProcess(t) {
+		t.row.done("")
+		return
+	}
+	effects, ok := planEffects(t)
+	if !ok {
+		t.row.done("")
+		return
+	}
+	t.row.plan(effects)
+	started := clock.Now()
+	var clipped []uint8
+	var before template.URL
+	pngImg := runWatched(t, func(pngImg *png.Image) {
+		clipped = inputClipping(pngImg)
+		before = inputThumbnail(pngImg)
+		applyEffectsSequential(pngImg, effects)
+	})
+	if pngImg == nil {
+		t.row.done("")
+		return
+	}
+	clipping := clippingWarning(pngImg, clipped)
+	trim := engine.TakeFindings(pngImg).Trim
+	card := newGalleryCard(t, effects, before, pngImg, since(started))
+	stampSummary(pngImg, effects, started)
+	blurHash := outputBlurHash(pngImg)
+	outPath, panels, budget, err := saveOutput(t, pngImg, effects)
 	if err != nil {
-		panic(err)
+		reportSaveError(t, err)
+		outPath, panels = "", nil
+	}
+	if outPath != "" {
+		recordManifest(ManifestEntry{InPath: t.InPath, InPaths: t.InPaths, Merge: t.Merge, OutPath: outPath,
+			Panels: panels, Effects: effects, Clipping: clipping, Trim: trim, SizeBudget: budget, BlurHash: blurHash})
+		recordGallery(card, outPath)
 	}
+	t.row.done(outPath)
+}
 
-	for i := 0; i < len(t.Effects); i++ {
-		effect := t.Effects[i]
-		processEffect(pngImg, effect)
+// Applies the effects in order on a single goroutine without image decomposition
+func applyEffectsSequential(pngImg *png.Image, effects []string) {
+	if settings.floatPipeline {
+		processEffectsFloat(pngImg, effects, 1)
+		return
+	}
+	if len(effects) == 0 { //nothing fills the output, so it's saved as the input was
+		pngImg.KeepInput()
+		return
+	}
+	for i := 0; i < len(effects); i++ {
+		if imageCancelled(pngImg) { //the task was cancelled, so its remaining effects are skipped
+			return
+		}
+		effect := effects[i]
+		measureEffect(pngImg, effect, func() { processEffect(pngImg, effect) })
+		markProgress(pngImg)
 
 		//if we're not on the final effect, pass the in img to out img to stack effects
-		if i != len(t.Effects) - 1 {
+		if i != len(effects) - 1 {
 			pngImg.SetImgOutToIn()
 		}
 	}
-	err = pngImg.Save(t.OutPath)
-	if err != nil {
-		panic(err)
-	}
 }
 
 // Based on the input effect command string, execute the effect on the image
 func processEffect(pngImg *png.Image, effect string){
-	if effect == "G"{
-		pngImg.Grayscale()
-	} else if effect == "S"{
-		pngImg.Sharpen()
-	} else if effect == "E"{
-		pngImg.EdgeDetect()
-	} else if effect == "B"{
-		pngImg.Blur()
-	} else {
+	if err := engine.Apply(pngImg, effect, &settings.effects); err != nil {
 		fmt.Println("WARNING: Effect command:", effect, " not recognized")
 	}
 }
 
-// Each line from Stdin represents a JSON task which has an image's inpath, outputh, and an array of effects we want
+// Edge modes of -edge-mode by name
+var edgeModes = map[string]png.EdgeMode{"zero": png.EdgeZero, "wrap-x": png.EdgeWrapX, "extend": png.EdgeExtend}
+
+// Sets the encoder and precision settings for one of the fast, balanced or best profiles, leaving the precision
+// alone if -float32 was given. Returns false if the profile name is not recognized
+func applyQualityProfile(quality string) bool {
+	if quality == "fast" {
+		settings.encodeOptions.Compression = stdpng.BestSpeed
+	} else if quality == "balanced" {
+		settings.encodeOptions.Compression = stdpng.DefaultCompression
+	} else if quality == "best" {
+		settings.encodeOptions.Compression = stdpng.BestCompression
+		if !flagGiven("float32") {
+			settings.floatPipeline = true
+		}
+	} else {
+		return false
+	}
+	return true
+}
+
+// Returns true if the flag called name was given on the command line, rather than left at its default
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// Formats a color as #rrggbb, the inverse of engine.ParseHexColor
+func formatHexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// Parses curve control points written as "in:out,in:out,..." with levels from 0 to 255
+func parseCurve(s string) ([]png.CurvePoint, error) {
+	var points []png.CurvePoint
+	if s == "" {
+		return points, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		in, out, ok := strings.Cut(pair, ":")
+		var p png.CurvePoint
+		var inErr, outErr error
+		p.In, inErr = strconv.ParseFloat(in, 64)
+		p.Out, outErr = strconv.ParseFloat(out, 64)
+		if !ok || inErr != nil || outErr != nil {
+			return nil, fmt.Errorf("invalid curve point %q, expected in:out", pair)
+		}
+		//written so that NaN levels fail it too
+		if !(p.In >= 0 && p.In <= 255 && p.Out >= 0 && p.Out <= 255) {
+			return nil, fmt.Errorf("curve point %q is outside of 0-255", pair)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// Each line from Stdin represents a JSON task which has an image's inpath, outputh, and an array of effects we want.
+// A task's overwrite, jpegQuality, progressive, maxBytes and background override -overwrite, -jpeg-quality,
+// -progressive, -max-bytes and -background
 type ImageTask struct {
-	InPath string `json:"inPath"` // filepath of images to read in
-	OutPath string `json:"outPath"`// filepath to save the image after applying effects
-	Effects []string `json:"effects"`// array of effects applied onto image
+	engine.Task
+	prefetch *prefetchedImage // the input being decoded ahead with -prefetch, nil otherwise
+	cost float64 // seconds the task should take on one thread according to -cost-model, 0 without one
+	trace *span // the task's span with -otlp-endpoint, nil otherwise
+	row *taskRow // the task's row on the -tui dashboard, nil otherwise
+	gridOf string // the task's own outPath, when OutPath is that of one of its -grid panels
+	cancel *cancellation // set once the task is cancelled, nil if it has no id or isn't run by the parallel version
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"proj2/engine"
+	"proj2/imageio"
+	"strings"
+	"text/tabwriter"
+)
+
+// Prints every effect with its kind and settings for "editor effects". Defaults and descriptions come from the
+// flags that set each parameter, so they're only written down once
+func printEffects() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, effect := range engine.Effects {
+		kind := effect.Kind
+		if effect.Kind == engine.Neighborhood {
+			kind = fmt.Sprintf("%s (radius %d)", kind, effect.Radius)
+		}
+		if !effect.PreservesAlpha {
+			kind += ", changes alpha (kept by " + strings.Join(imageio.FormatsWithAlpha(), ", ") + " outputs)"
+		}
+		if effect.OrderDependent {
+			kind += ", order dependent"
+		}
+		if ceiling := engine.StripCeiling(effect.Code, &settings.effects); ceiling > 0 {
+			kind += fmt.Sprintf(", at most %d strips at once", ceiling)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", effect.Code, effect.Name, kind)
+		for _, param := range effect.Params {
+			f := flag.Lookup(param.Name)
+			fmt.Fprintf(w, "\t  -%s=%s\t%s (range %s)\n", f.Name, f.DefValue, f.Usage, param.Range)
+		}
+	}
+	w.Flush()
+}
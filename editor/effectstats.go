@@ -0,0 +1,129 @@
+package main
+
+import (
+	"proj2/png"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How often the heap is sampled while effects run, to catch peaks between the start and end of an effect
+const heapSampleInterval = 10 * time.Millisecond
+
+// Time and memory used by one effect over a whole run, written by -effect-stats. Memory is measured for the whole
+// process, so when tasks run at once, allocations and peaks of concurrent effects are counted in each of them
+type EffectStats struct {
+	Effect         string  `json:"effect"`
+	Runs           int     `json:"runs"`
+	Seconds        decimal `json:"seconds"`
+	AllocatedBytes uint64  `json:"allocatedBytes"` // heap allocated while the effect ran, summed over its runs
+	PeakHeapBytes  uint64  `json:"peakHeapBytes"`  // largest heap in use seen while the effect ran
+}
+
+// Report written by -effect-stats
+type EffectStatsReport struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Effects       []EffectStats `json:"effects"`
+}
+
+var effectStats struct {
+	sync.Mutex
+	enabled bool
+	byCode  map[string]*EffectStats
+	running map[string]int // number of runs of each effect in progress
+	stop    chan bool
+}
+
+// Starts collecting effect stats and sampling the heap in the background
+func startEffectStats() {
+	effectStats.enabled = true
+	effectStats.byCode = make(map[string]*EffectStats)
+	effectStats.running = make(map[string]int)
+	effectStats.stop = make(chan bool)
+	go sampleHeap(effectStats.stop)
+}
+
+// Records the heap in use as a peak of every effect currently running, until stop is closed
+func sampleHeap(stop chan bool) {
+	ticker := clock.NewTicker(heapSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			effectStats.Lock()
+			for code, running := range effectStats.running {
+				if running > 0 {
+					updatePeak(code, mem.HeapInuse)
+				}
+			}
+			effectStats.Unlock()
+		}
+	}
+}
+
+// Returns the stats of effect, creating them if needed. Must be called with effectStats locked
+func statsFor(effect string) *EffectStats {
+	stats, ok := effectStats.byCode[effect]
+	if !ok {
+		stats = &EffectStats{Effect: effect}
+		effectStats.byCode[effect] = stats
+	}
+	return stats
+}
+
+// Must be called with effectStats locked
+func updatePeak(effect string, heapInuse uint64) {
+	if stats := statsFor(effect); heapInuse > stats.PeakHeapBytes {
+		stats.PeakHeapBytes = heapInuse
+	}
+}
+
+// Runs apply, an application of effect, recording its time and memory if -effect-stats is on
+func measureEffect(pngImg *png.Image, effect string, apply func()) {
+	defer taskSpan(pngImg).child("effect").set("editor.effect", effect).finish()
+	row := rowOf(pngImg)
+	row.at(effect)
+	defer row.effectDone()
+	if !effectStats.enabled {
+		apply()
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	effectStats.Lock()
+	effectStats.running[effect]++
+	updatePeak(effect, before.HeapInuse)
+	effectStats.Unlock()
+
+	start := clock.Now()
+	apply()
+	elapsed := since(start)
+
+	runtime.ReadMemStats(&after)
+	effectStats.Lock()
+	defer effectStats.Unlock()
+	effectStats.running[effect]--
+	stats := statsFor(effect)
+	stats.Runs++
+	stats.Seconds += decimal(elapsed.Seconds())
+	stats.AllocatedBytes += after.TotalAlloc - before.TotalAlloc
+	updatePeak(effect, after.HeapInuse)
+}
+
+// Stops sampling and writes the stats of every effect that ran to path as JSON
+func writeEffectStats(path string) {
+	close(effectStats.stop)
+	effectStats.Lock()
+	defer effectStats.Unlock()
+	report := EffectStatsReport{SchemaVersion: effectStatsSchemaVersion, Effects: []EffectStats{}}
+	for _, stats := range effectStats.byCode {
+		report.Effects = append(report.Effects, *stats)
+	}
+	sort.Slice(report.Effects, func(i int, j int) bool { return report.Effects[i].Effect < report.Effects[j].Effect })
+	writeJSONReport(path, report)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"proj2/engine"
+	"proj2/imageio"
+	"strings"
+)
+
+// Returns effects with t's flattens: over its own background if it has one, and one more at the end if its outputs
+// are in a format without alpha, unless -no-auto-flatten is set or the effects already end with a flatten
+func flattenEffects(t ImageTask, effects []string) []string {
+	flatten := "FL"
+	if t.Background != "" {
+		//checkTask made sure the background is a color, so the object is valid
+		flatten, _ = engine.ParseEffectObject([]byte(fmt.Sprintf(`{"type":"flatten","background":%q}`, t.Background)))
+	}
+	flattened := make([]string, 0, len(effects)+1)
+	for _, effect := range effects {
+		if effect == "FL" {
+			effect = flatten
+		}
+		flattened = append(flattened, effect)
+	}
+	endsFlat := len(flattened) > 0 && isFlatten(flattened[len(flattened)-1])
+	if !settings.noAutoFlatten && !endsFlat && !imageio.KeepsAlpha(outputTasks(t)[0].OutPath) {
+		flattened = append(flattened, flatten)
+	}
+	return flattened
+}
+
+// Reports whether code is the flatten effect or a flatten object, with any background
+func isFlatten(code string) bool {
+	effect, ok := engine.Lookup(code)
+	return ok && (effect.Code == "FL" || strings.HasPrefix(effect.Name, "flatten over "))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"proj2/engine"
+	"proj2/png"
+)
+
+// Applies every effect to pngImg keeping the working pixels in float32, so nothing is clamped or rounded until the
+// final result is stored in pngImg's output. Each effect's rows are split into engine.StripCount strips, run on
+// the strip pool in the parallel version, at most the effect's engine.StripCeiling at once, and checked with an
+// engine.StripLedger in stripcheck builds. Effects without a float32 implementation are applied to pngImg as
+// usual, which quantizes the image at that step
+func processEffectsFloat(pngImg *png.Image, effects []string, numThreads int) {
+	src := png.NewFloatImage(pngImg)
+	dst := png.NewFloatImageLike(src)
+	for _, effect := range effects {
+		if imageCancelled(pngImg) { //the task was cancelled, so its remaining effects are skipped
+			return
+		}
+		//an empty row range only checks whether the effect has a float32 version
+		if !applyFloatEffect(src, dst, effect, src.Rect.Min.Y, src.Rect.Min.Y) {
+			src.Store(pngImg)
+			pngImg.SetImgOutToIn()
+			measureEffect(pngImg, effect, func() {
+				if numThreads > 1 {
+					parallelDecomposeEffect(pngImg, effect, numThreads)
+				} else {
+					processEffect(pngImg, effect)
+				}
+			})
+			pngImg.SetImgOutToIn()
+			src = png.NewFloatImage(pngImg)
+			continue
+		}
+
+		measureEffect(pngImg, effect, func() {
+			ledger := engine.NewStripLedger(effect, src.Rect.Min.Y, src.Rect.Max.Y)
+			numStrips := engine.StripCount(src.Rect.Dx(), src.Rect.Dy(), numThreads, &settings.effects)
+			sectionHeight := (src.Rect.Dy() + numStrips - 1) / numStrips
+			var strips []func()
+			for minY := src.Rect.Min.Y; minY < src.Rect.Max.Y; minY += sectionHeight {
+				maxY := minY + sectionHeight
+				if maxY > src.Rect.Max.Y {
+					maxY = src.Rect.Max.Y
+				}
+				minY := minY
+				strips = append(strips, func() {
+					applyFloatEffect(src, dst, effect, minY, maxY)
+					if ledger != nil {
+						ledger.Claim(minY, maxY, dst.Checksum(minY, maxY))
+					}
+					markProgress(pngImg)
+				})
+			}
+			settings.effects.Pool.RunAtMost(strips, engine.StripCeiling(effect, &settings.effects))
+			ledger.Verify(dst.Checksum)
+		})
+		src, dst = dst, src
+	}
+	src.Store(pngImg)
+}
+
+// Applies the float32 version of effect to rows [minY, maxY) of src, writing into dst. Returns false if the
+// effect has no float32 version
+func applyFloatEffect(src *png.FloatImage, dst *png.FloatImage, effect string, minY int, maxY int) bool {
+	if effect == "G" {
+		src.Grayscale(dst, minY, maxY)
+	} else if effect == "S" {
+		src.Sharpen(dst, minY, maxY)
+	} else if effect == "E" {
+		src.EdgeDetect(dst, minY, maxY)
+	} else if effect == "B" {
+		src.Blur(dst, minY, maxY)
+	} else {
+		return false
+	}
+	return true
+}
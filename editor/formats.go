@@ -0,0 +1,31 @@
+package main
+
+import (
+	"image"
+	"proj2/imageio"
+)
+
+// Returns the most bits per channel of t's inputs, 0 if none of them can be probed
+func inputBitDepth(t ImageTask) int {
+	depth := 0
+	for _, path := range taskInputs(t) {
+		if info, err := imageio.Probe(path); err == nil && info.BitDepth > depth {
+			depth = info.BitDepth
+		}
+	}
+	return depth
+}
+
+// With -coerce-formats, prints a WARNING naming what the format of t's outPath drops from img, whose source has
+// sourceBitDepth bits per channel, if anything. Returns true if the task fails instead, which it only does with
+// -strict
+func warnCoerced(t ImageTask, img image.Image, sourceBitDepth int) bool {
+	err := imageio.CheckCapabilities(t.OutPath, img, sourceBitDepth)
+	if err == nil {
+		return false
+	}
+	if settings.strict {
+		return taskWarning(t, "outPath", t.OutPath, "of", t.InPath+":", err)
+	}
+	return taskWarning(t, "outPath", t.OutPath, "of", t.InPath+":", err, "(saved anyway, -coerce-formats)")
+}
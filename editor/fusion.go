@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"proj2/engine"
+	"proj2/imageio"
+	"proj2/png"
+	"sync"
+)
+
+// Ways the inPaths of a task can be merged
+const (
+	mergeExposure = "exposure" // exposure fusion of bracketed exposures, the default
+	mergeFocus    = "focus"    // focus stacking of images focused at different distances
+	mergeStitch   = "stitch"   // stitching of tiles of a larger image, given row by row
+)
+
+// Returns the paths of every input of t: its bracketed exposures if it merges some, its inPath otherwise
+func taskInputs(t ImageTask) []string {
+	if len(t.InPaths) > 0 {
+		return t.InPaths
+	}
+	return []string{t.InPath}
+}
+
+// Loads t's input. For a task with inPaths, loads every image, numThreads at a time, and merges them with exposure
+// fusion, focus stacking or stitching, splitting each step across numThreads threads
+func loadTaskInput(t ImageTask, numThreads int) (*png.Image, error) {
+	defer t.trace.child("decode").finish()
+	if len(t.InPaths) == 0 {
+		return loadImage(t.InPath)
+	}
+	images, err := loadImages(t.InPaths, numThreads)
+	if err != nil {
+		return nil, err
+	}
+	merge := engine.FuseExposures
+	if t.Merge == mergeFocus {
+		merge = engine.StackFocus
+	} else if t.Merge == mergeStitch {
+		rows, cols, _ := parseRowsByCols(t.Grid)
+		merge = func(tiles []image.Image, numThreads int, s *engine.Settings) (image.Image, error) {
+			return engine.Stitch(tiles, rows, cols, t.Overlap, numThreads, s)
+		}
+	}
+	merged, err := merge(images, numThreads, &settings.effects)
+	if err != nil {
+		return nil, fmt.Errorf("can't merge the inPaths of %s: %v", t.OutPath, err)
+	}
+	return png.FromImage(merged), nil
+}
+
+// Loads the images at paths, numThreads at a time. Returns the first error, if any
+func loadImages(paths []string, numThreads int) ([]image.Image, error) {
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	images := make([]image.Image, len(paths))
+	errs := make([]error, len(paths))
+	loading := make(chan bool, numThreads)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		i, path := i, path
+		loading <- true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			atIOPriority(func() { images[i], _, errs[i] = imageio.Load(path) })
+			<-loading
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	stdpng "image/png"
+	"os"
+	"path/filepath"
+	"proj2/engine"
+	"proj2/png"
+	"testing"
+)
+
+// Returns an opaque image of width by height filled with a fixed pseudo-random pattern, the same on every run
+func patternImage(width int, height int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			seed = seed*1664525 + 1013904223
+			img.SetRGBA64(x, y, color.RGBA64{uint16(seed >> 16), uint16(seed >> 8), uint16(seed), 0xffff})
+		}
+	}
+	return img
+}
+
+func TestStitchWithoutEffects(t *testing.T) {
+	original := patternImage(61, 47)
+	grid := gridLayout{rows: 2, cols: 2, overlap: 8}
+	task := ImageTask{Task: engine.Task{Merge: mergeStitch, Grid: "2x2", Overlap: grid.overlap}}
+	for row := 1; row <= grid.rows; row++ {
+		for col := 1; col <= grid.cols; col++ {
+			r := grid.panel(original.Bounds(), row, col)
+			panel := image.NewRGBA64(image.Rect(0, 0, r.Dx(), r.Dy()))
+			draw.Draw(panel, panel.Bounds(), original, r.Min, draw.Src)
+			path := filepath.Join(t.TempDir(), "panel.png")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := stdpng.Encode(f, panel); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			task.InPaths = append(task.InPaths, path)
+		}
+	}
+
+	for name, apply := range map[string]func(*png.Image){
+		"sequential": func(img *png.Image) { applyEffectsSequential(img, nil) },
+		"pipeline":   func(img *png.Image) { processEffectsPipeline(img, nil, 4) },
+	} {
+		img, err := loadTaskInput(task, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apply(img)
+		//with no effects, the panels are saved put back together as they were cut
+		out := img.Output()
+		if out.Bounds() != original.Bounds() {
+			t.Fatalf("%s: the stitched output is %v, expected %v", name, out.Bounds(), original.Bounds())
+		}
+		for y := 0; y < original.Rect.Dy(); y++ {
+			for x := 0; x < original.Rect.Dx(); x++ {
+				if got, want := color.RGBA64Model.Convert(out.At(x, y)), original.RGBA64At(x, y); got != want {
+					t.Fatalf("%s: pixel (%d, %d) is %v, expected %v", name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"os"
+	"proj2/engine"
+	"proj2/png"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest width and height of the thumbnails in the -report gallery
+const thumbnailSize = 240
+
+// Quality of the JPEG thumbnails embedded in the -report gallery
+const thumbnailQuality = 80
+
+// One task of the -report gallery
+type galleryCard struct {
+	InPath  string
+	OutPath string
+	Effects []string      // each effect applied with its settings, one per line
+	Time    time.Duration // from the start of the task until the effects were done, decoding included
+	Before  template.URL  // thumbnail of the input as a data URL
+	After   template.URL  // thumbnail of the output as a data URL
+}
+
+var gallery struct {
+	sync.Mutex
+	enabled bool
+	cards   []galleryCard
+	started time.Time
+}
+
+// Starts collecting the cards of the gallery written by writeGallery
+func startGallery() {
+	gallery.enabled = true
+	gallery.started = clock.Now()
+}
+
+// Returns a thumbnail of pngImg's input for the gallery, before the effects are applied, or "" without -report
+func inputThumbnail(pngImg *png.Image) template.URL {
+	if !gallery.enabled {
+		return ""
+	}
+	return thumbnailURL(pngImg.Input())
+}
+
+// Returns the card of t, whose output pngImg was made from an input with thumbnail before by applying effects, elapsed
+// since the task started, or nil without -report. Its OutPath is filled in by recordGallery once the output is saved
+func newGalleryCard(t ImageTask, effects []string, before template.URL, pngImg *png.Image,
+	elapsed time.Duration) *galleryCard {
+	if !gallery.enabled {
+		return nil
+	}
+	card := &galleryCard{InPath: t.InPath, Time: elapsed.Round(time.Millisecond), Before: before,
+		After: thumbnailURL(pngImg.Output())}
+	if len(t.InPaths) > 0 {
+		card.InPath = strings.Join(t.InPaths, ", ")
+	}
+	for _, step := range engine.DescribeChain(effects, &settings.effects, givenFlag).Effects {
+		card.Effects = append(card.Effects, describeStep(step))
+	}
+	return card
+}
+
+// Adds card to the gallery with the path its output was saved to. Does nothing for a nil card
+func recordGallery(card *galleryCard, outPath string) {
+	if card == nil {
+		return
+	}
+	card.OutPath = outPath
+	gallery.Lock()
+	defer gallery.Unlock()
+	gallery.cards = append(gallery.cards, *card)
+}
+
+// Returns img scaled down to a thumbnail and encoded as a data URL, so the gallery is a single file that can be
+// mailed or moved without the images it shows
+func thumbnailURL(img image.Image) template.URL {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, png.Thumbnail(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		panic(err)
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// Writes the gallery to path as a static HTML page: a card for every task saved, sorted by outPath, with its input
+// and output side by side, the time it took and the settings its effects were applied with
+func writeGallery(path string) {
+	gallery.Lock()
+	defer gallery.Unlock()
+	sort.Slice(gallery.cards, func(i int, j int) bool { return gallery.cards[i].OutPath < gallery.cards[j].OutPath })
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	err = galleryTemplate.Execute(f, map[string]interface{}{"Cards": gallery.cards, "Engine": engine.Version,
+		"Started": gallery.started.Format(time.RFC1123), "Elapsed": since(gallery.started).Round(time.Second)})
+	if err != nil {
+		panic(err)
+	}
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Editor report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.card { border: 1px solid #ccc; border-radius: 6px; padding: 1em; margin-bottom: 1em; }
+.images { display: flex; gap: 1em; align-items: flex-start; }
+figure { margin: 0; }
+figcaption { font-size: 0.8em; color: #666; }
+ul { margin: 0.5em 0 0; padding-left: 1.2em; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Editor report</h1>
+<p>{{len .Cards}} outputs, started {{.Started}}, took {{.Elapsed}} (engine {{.Engine}})</p>
+{{range .Cards}}<div class="card">
+<h2>{{.OutPath}}</h2>
+<div class="images">
+<figure><img src="{{.Before}}" alt="before"><figcaption>Before: {{.InPath}}</figcaption></figure>
+<figure><img src="{{.After}}" alt="after"><figcaption>After, in {{.Time}}</figcaption></figure>
+</div>
+<ul>{{range .Effects}}<li>{{.}}</li>{{else}}<li>no effects</li>{{end}}</ul>
+</div>
+{{end}}</body>
+</html>
+`))
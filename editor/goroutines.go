@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often a worker held back by -max-goroutines checks the number of goroutines again
+const goroutineCheckInterval = 100 * time.Millisecond
+
+// Printed once when workers are first held back by -max-goroutines
+var goroutineLimitWarning sync.Once
+
+// Most goroutines seen at once, sampled whenever a worker takes a task and whenever the dashboard is redrawn
+var peakGoroutines int64
+
+// Returns the number of goroutines, recording it if it is the most seen so far
+func countGoroutines() int {
+	n := runtime.NumGoroutine()
+	for {
+		peak := atomic.LoadInt64(&peakGoroutines)
+		if int64(n) <= peak || atomic.CompareAndSwapInt64(&peakGoroutines, peak, int64(n)) {
+			return n
+		}
+	}
+}
+
+// With -max-goroutines, holds a worker back from starting its next task while the process has more goroutines than
+// that, so a run whose abandoned watchdog attempts or pending writers pile up slows down instead of running out of
+// memory. The limit is soft: a worker goes ahead anyway once the number stops going down between checks, since
+// then nothing it could wait for is finishing
+func waitForGoroutines() {
+	n := countGoroutines()
+	if settings.maxGoroutines == 0 || n <= settings.maxGoroutines {
+		return
+	}
+	goroutineLimitWarning.Do(func() {
+		fmt.Println("WARNING:", n, "goroutines are running, over -max-goroutines, workers are waiting for some to finish")
+	})
+	ticker := clock.NewTicker(goroutineCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		last := n
+		if n = countGoroutines(); n <= settings.maxGoroutines || n >= last {
+			return
+		}
+	}
+}
+
+// With -verbose, prints how many strips the pool ran and the most goroutines seen at once
+func printConcurrency() {
+	if !settings.verbose {
+		return
+	}
+	stats := settings.effects.Pool.Stats()
+	fmt.Println("Ran", stats.Finished, "strips on a pool of", stats.Size, "goroutines, and at most",
+		atomic.LoadInt64(&peakGoroutines), "goroutines were seen running at once")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"proj2/imageio"
+	"strconv"
+	"strings"
+)
+
+// Name of each panel of a -grid, by default
+const defaultGridName = "{name}_r{row}_c{col}{ext}"
+
+// The -grid every output is split into, with no rows without it
+type gridLayout struct {
+	rows, cols int
+	overlap    int    // pixels each panel extends into the panels right of and below it
+	name       string // template of the panels' paths
+}
+
+// Reads -grid, written [rows]x[cols], and checks that -grid-name tells the panels apart
+func parseGrid(s string, overlap int, name string) (gridLayout, error) {
+	var grid gridLayout
+	var ok bool
+	if grid.rows, grid.cols, ok = parseRowsByCols(s); !ok {
+		return gridLayout{}, fmt.Errorf("invalid -grid %q, expected [rows]x[cols] such as 2x3", s)
+	}
+	if overlap < 0 {
+		return gridLayout{}, fmt.Errorf("invalid -grid-overlap %d, expected 0 or more pixels", overlap)
+	}
+	if (grid.rows > 1 && !strings.Contains(name, "{row}")) || (grid.cols > 1 && !strings.Contains(name, "{col}")) {
+		return gridLayout{}, fmt.Errorf("invalid -grid-name %q, which must contain {row} and {col} for the "+
+			"panels to have names of their own", name)
+	}
+	grid.overlap, grid.name = overlap, name
+	return grid, nil
+}
+
+// Reads a grid written [rows]x[cols], such as 2x3. Returns false if s isn't one
+func parseRowsByCols(s string) (int, int, bool) {
+	var rows, cols int
+	n, err := fmt.Sscanf(s, "%dx%d", &rows, &cols)
+	return rows, cols, err == nil && n == 2 && rows >= 1 && cols >= 1 && fmt.Sprintf("%dx%d", rows, cols) == s
+}
+
+// Returns the path of the panel at row and col (from 1) of an output to outPath
+func (g gridLayout) panelPath(outPath string, row int, col int) string {
+	ext := filepath.Ext(outPath)
+	return strings.NewReplacer("{name}", strings.TrimSuffix(outPath, ext), "{ext}", ext,
+		"{row}", strconv.Itoa(row), "{col}", strconv.Itoa(col)).Replace(g.name)
+}
+
+// Returns the part of an image with bounds that the panel at row and col (from 1) holds. Rows and columns split the
+// image as evenly as whole pixels allow, and each panel but the last of its row and column extends overlap pixels
+// further
+func (g gridLayout) panel(bounds image.Rectangle, row int, col int) image.Rectangle {
+	r := image.Rect(bounds.Min.X+(col-1)*bounds.Dx()/g.cols, bounds.Min.Y+(row-1)*bounds.Dy()/g.rows,
+		bounds.Min.X+col*bounds.Dx()/g.cols, bounds.Min.Y+row*bounds.Dy()/g.rows)
+	if col < g.cols {
+		r.Max.X += g.overlap
+	}
+	if row < g.rows {
+		r.Max.Y += g.overlap
+	}
+	return r.Intersect(bounds)
+}
+
+// Returns a task saving each file t's output goes to: t itself, or with -grid one per panel, row by row, whose
+// outPath is the panel's
+func outputTasks(t ImageTask) []ImageTask {
+	if settings.grid.rows == 0 {
+		return []ImageTask{t}
+	}
+	var panels []ImageTask
+	for row := 1; row <= settings.grid.rows; row++ {
+		for col := 1; col <= settings.grid.cols; col++ {
+			panel := t
+			panel.OutPath = settings.grid.panelPath(t.OutPath, row, col)
+			panel.gridOf = t.OutPath
+			panels = append(panels, panel)
+		}
+	}
+	return panels
+}
+
+// Saves every panel of img, t's output, to its own file like saveFile. Returns the paths the panels were saved to,
+// row by row, or nil if the output wasn't saved in full, after an ERROR if the image has fewer pixels than the
+// grid has panels across or down
+func saveGrid(t ImageTask, img image.Image, opts imageio.EncodeOptions, inInfo os.FileInfo) ([]string, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() < settings.grid.cols || bounds.Dy() < settings.grid.rows {
+		fmt.Printf("ERROR: outPath %s of %s not saved: the output is %dx%d pixels, too small for a grid of %dx%d\n",
+			t.OutPath, t.InPath, bounds.Dx(), bounds.Dy(), settings.grid.rows, settings.grid.cols)
+		recordFailure(t, "output too small for the -grid")
+		return nil, nil
+	}
+	var paths []string
+	for i, panelTask := range outputTasks(t) {
+		row, col := i/settings.grid.cols+1, i%settings.grid.cols+1
+		r := settings.grid.panel(bounds, row, col)
+		panel := image.NewRGBA64(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(panel, panel.Bounds(), img, r.Min, draw.Src)
+		outPath, _, err := saveFile(panelTask, panel, opts, inInfo)
+		if err != nil || outPath == "" {
+			return nil, err
+		}
+		paths = append(paths, outPath)
+	}
+	return paths, nil
+}
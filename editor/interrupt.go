@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"proj2/engine"
+	"syscall"
+)
+
+// Closed once the run receives SIGINT or SIGTERM
+var interruption = make(chan struct{})
+
+// Stops reading tasks on the first SIGINT or SIGTERM, so the tasks already read finish and main returns through its
+// deferred finalizers, which write the manifest, the -retry-file, the -report and the like. The signals then get
+// their default handling back, so a second one ends the run at once
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("WARNING: Interrupted, no more tasks are read; the tasks in progress finish first " +
+			"(interrupt again to stop at once)")
+		close(interruption)
+	}()
+}
+
+// Returns whether the run was interrupted
+func interrupted() bool {
+	select {
+	case <-interruption:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns src, ending with io.EOF once the run is interrupted, even while src is waiting for its next task such as
+// on a pipe nothing is written to
+func untilInterrupted(src engine.TaskSource) engine.TaskSource {
+	type result struct {
+		task engine.Task
+		err  error
+	}
+	return engine.TaskSourceFunc(func() (engine.Task, error) {
+		if interrupted() {
+			return engine.Task{}, io.EOF
+		}
+		next := make(chan result, 1)
+		go func() {
+			t, err := src.Next()
+			next <- result{t, err}
+		}()
+		select {
+		case r := <-next:
+			return r.task, r.err
+		case <-interruption:
+			return engine.Task{}, io.EOF
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A macro invocation or definition, name(arg, ...), such as web(800) or web(size)
+var macroCall = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)\((.*)\)$`)
+
+// The names of a macro's parameters, written $name in its effects
+var macroParam = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// A parameter used in the effects of a macro
+var macroParamUse = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// A macro of the config, an effect chain with parameters
+type macro struct {
+	params  []string
+	effects []interface{} // the effects as decoded JSON, numbers kept as json.Number
+}
+
+// The macros of the loaded -config file by name
+var macros map[string]macro
+
+// Reads the "macros" of the config, each defined as "name(param, ...)": [effects], and checks that their effects
+// only use the parameters they declare
+func parseMacros(defs map[string][]json.RawMessage) error {
+	macros = make(map[string]macro)
+	for def, effects := range defs {
+		match := macroCall.FindStringSubmatch(def)
+		if match == nil {
+			return fmt.Errorf("macro %q must be defined as name(param, ...), e.g. web(size)", def)
+		}
+		if _, ok := macros[match[1]]; ok {
+			return fmt.Errorf("macro %s is defined more than once", match[1])
+		}
+		m := macro{params: splitArgs(match[2])}
+		declared := map[string]bool{}
+		for _, param := range m.params {
+			if !macroParam.MatchString(param) || declared[param] {
+				return fmt.Errorf("macro %q has an invalid or repeated parameter %q", def, param)
+			}
+			declared[param] = true
+		}
+		for _, raw := range effects {
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			var effect interface{}
+			if err := dec.Decode(&effect); err != nil {
+				return fmt.Errorf("macro %q: %v", def, err)
+			}
+			m.effects = append(m.effects, effect)
+		}
+		text, err := json.Marshal(m.effects)
+		if err != nil {
+			return err
+		}
+		for _, used := range macroParamUse.FindAllStringSubmatch(string(text), -1) {
+			if !declared[used[1]] {
+				return fmt.Errorf("macro %q uses $%s, which isn't one of its parameters", def, used[1])
+			}
+		}
+		macros[match[1]] = m
+	}
+	return nil
+}
+
+// Splits the arguments or parameters of a macro at commas, trimming spaces. Returns none for an empty list
+func splitArgs(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	args := strings.Split(s, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	return args
+}
+
+// Returns the effects an invocation of a macro, such as web(800), stands for, and false if effect doesn't invoke
+// one. Each parameter is replaced by its argument: a string of the effects that is just $param becomes the argument,
+// as a number if it is one, and $param within longer strings is replaced by the argument's text. The effects are
+// then checked like those of a task
+func expandMacro(effect string) (EffectList, bool, error) {
+	match := macroCall.FindStringSubmatch(effect)
+	if match == nil {
+		return nil, false, nil
+	}
+	m, ok := macros[match[1]]
+	if !ok {
+		return nil, false, nil
+	}
+	args := splitArgs(match[2])
+	if len(args) != len(m.params) {
+		return nil, true, fmt.Errorf("macro %s takes %d arguments (%s), got %d in %s", match[1], len(m.params),
+			strings.Join(m.params, ", "), len(args), effect)
+	}
+	values := map[string]interface{}{}
+	var replacements []string
+	order := make([]int, len(m.params))
+	for i := range order {
+		order[i] = i
+	}
+	//longer names first, so $size isn't taken for $s followed by ize
+	sort.Slice(order, func(i int, j int) bool { return len(m.params[order[i]]) > len(m.params[order[j]]) })
+	for _, i := range order {
+		values["$"+m.params[i]] = args[i]
+		if _, err := strconv.ParseFloat(args[i], 64); err == nil && json.Valid([]byte(args[i])) {
+			values["$"+m.params[i]] = json.Number(args[i])
+		}
+		replacements = append(replacements, "$"+m.params[i], args[i])
+	}
+	substituted, err := json.Marshal(substitute(m.effects, values, strings.NewReplacer(replacements...)))
+	if err != nil {
+		return nil, true, err
+	}
+	var expanded EffectList
+	if err := json.Unmarshal(substituted, &expanded); err != nil {
+		return nil, true, fmt.Errorf("macro %s: %v", effect, err)
+	}
+	return expanded, true, nil
+}
+
+// Returns v, decoded JSON, with every string equal to a key of values replaced by its value, and every other string
+// rewritten by replacer
+func substitute(v interface{}, values map[string]interface{}, replacer *strings.Replacer) interface{} {
+	switch v := v.(type) {
+	case string:
+		if value, ok := values[v]; ok {
+			return value
+		}
+		return replacer.Replace(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = substitute(v[i], values, replacer)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			obj[key] = substitute(value, values, replacer)
+		}
+		return obj
+	}
+	return v
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"proj2/engine"
+	"sync"
+)
+
+// One line of the run manifest, recording a task once its output has been written
+type ManifestEntry struct {
+	SchemaVersion    int                `json:"schemaVersion"`
+	Seq              uint64             `json:"seq"` // 1 for the first task completed in the run, 2 for the next and so on
+	InPath           string             `json:"inPath"`
+	InPaths          []string           `json:"inPaths,omitempty"` // the images merged into the input, if more than one
+	Merge            string             `json:"merge,omitempty"`   // how inPaths were merged, if not by exposure fusion
+	OutPath          string             `json:"outPath"`
+	Panels           []string           `json:"panels,omitempty"` // where the panels of a -grid output were saved
+	Effects          EffectList         `json:"effects"`
+	Verified         bool               `json:"verified,omitempty"`         // true if the result was checked against a sequential run
+	MismatchedPixels int                `json:"mismatchedPixels,omitempty"` // pixels that differed from the sequential run
+	Clipping         *ClippingStats     `json:"clipping,omitempty"`         // pixels the effects clipped, with -clipping
+	Trim             *engine.TrimReport `json:"trim,omitempty"`             // where the TR effect would trim uniform borders
+	SizeBudget       *SizeBudget        `json:"sizeBudget,omitempty"`       // how an output with a maxBytes was encoded
+	BlurHash         string             `json:"blurHash,omitempty"`         // placeholder of the output, with -blurhash
+}
+
+// Entries waiting to be written are queued for a single writer goroutine, so every line is written whole and in
+// the order given by its sequence number. A full queue makes workers wait rather than grow without bound
+const manifestQueueSize = 64
+
+// A request to the manifest writer: an entry to write, or (if synced isn't nil) a request to sync the file once
+// everything queued before it has been written
+type manifestRequest struct {
+	entry  ManifestEntry
+	synced chan error
+}
+
+var manifest struct {
+	sync.Mutex // held while assigning a sequence number and queueing, so entries are queued in sequence order
+	file       *os.File
+	queue      chan manifestRequest
+	done       chan error // receives the writer's first error once the queue is closed and drained
+	seq        uint64
+}
+
+// Creates the manifest file at path and starts its writer. Until this is called, recordManifest does nothing
+func openManifest(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	manifest.file = f
+	manifest.queue = make(chan manifestRequest, manifestQueueSize)
+	manifest.done = make(chan error, 1)
+	go writeManifest(f, manifest.queue, manifest.done)
+}
+
+// Writes every queued entry to f as a single JSON line until queue is closed
+func writeManifest(f *os.File, queue <-chan manifestRequest, done chan<- error) {
+	enc := json.NewEncoder(f)
+	var firstErr error
+	for req := range queue {
+		if req.synced != nil {
+			err := firstErr
+			if err == nil {
+				err = f.Sync()
+			}
+			req.synced <- err
+			continue
+		}
+		if err := enc.Encode(req.entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	done <- firstErr
+}
+
+// Numbers entry and queues it to be appended to the manifest as a single JSON line
+func recordManifest(entry ManifestEntry) {
+	manifest.Lock()
+	defer manifest.Unlock()
+	if manifest.queue == nil {
+		return
+	}
+	manifest.seq++
+	entry.SchemaVersion = manifestSchemaVersion
+	entry.Seq = manifest.seq
+	manifest.queue <- manifestRequest{entry: entry}
+}
+
+// Writes every queued entry, then closes the manifest file, if one was opened
+func closeManifest() {
+	manifest.Lock()
+	defer manifest.Unlock()
+	if manifest.queue == nil {
+		return
+	}
+	close(manifest.queue)
+	err := <-manifest.done
+	if closeErr := manifest.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		panic(err)
+	}
+	manifest.file, manifest.queue = nil, nil
+}
+
+// Commits everything recorded in the manifest so far to disk
+func syncManifest() {
+	manifest.Lock()
+	if manifest.queue == nil {
+		manifest.Unlock()
+		return
+	}
+	synced := make(chan error)
+	manifest.queue <- manifestRequest{synced: synced}
+	manifest.Unlock()
+	if err := <-synced; err != nil {
+		panic(err)
+	}
+}
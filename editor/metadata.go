@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"proj2/engine"
+	"proj2/imageio"
+)
+
+// Keyword of the PNG text chunk each output records the effect chain that made it in
+const chainKeyword = "EffectChain"
+
+// The effect chain recorded in outputs, along with the editor settings that also change the output
+type outputChain struct {
+	engine.Chain
+	Float32 bool `json:"float32,omitempty"` // the effects were applied with the -float32 pipeline
+}
+
+// Returns the encode options for an output made by applying effects with s, which record the chain in the output
+// unless -no-metadata is set. Settings that aren't numbers are recorded as they were given on the command line
+func outputOptions(effects []string, s *engine.Settings, float32 bool) imageio.EncodeOptions {
+	opts := settings.encodeOptions
+	if settings.noMetadata {
+		return opts
+	}
+	chain, err := json.Marshal(outputChain{Chain: engine.DescribeChain(effects, s, givenFlag), Float32: float32})
+	if err != nil {
+		panic(err)
+	}
+	opts.Text = map[string]string{chainKeyword: string(chain)}
+	return opts
+}
+
+// Returns the value of the flag setting an effect parameter as it was given, or "" if there is no such flag
+func givenFlag(name string) string {
+	if f := flag.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"proj2/engine"
+)
+
+// Returns the effects to run for task t, changed by the config file's routes, with its aliases expanded and its
+// flattens added (see flattenEffects). With -optimize, the chain is also rewritten into a cheaper one that produces
+// exactly the same output:
+//   - effects that leave every pixel unchanged (a curves effect without any control points) are dropped
+//   - a grayscale directly following another grayscale is dropped, since grayscale of a gray pixel is itself, but
+//     not with -float32, whose average of a gray pixel's three channels can differ from them in the last bit
+//
+// With -verbose, rewritten chains are printed. Returns false if the task fails instead, which it only does with
+// -strict, for an effect that would leave the image unchanged or isn't recognized
+func planEffects(t ImageTask) ([]string, bool) {
+	effects, err := expandAliases(routeEffects(t))
+	if err != nil {
+		fmt.Println("ERROR:", t.InPath, "not processed:", err)
+		recordFailure(t, err.Error())
+		return nil, false
+	}
+	effects = flattenEffects(t, effects)
+	failed := false
+	for _, effect := range effects {
+		if effect == "D" && settings.effects.DarkFrame == nil {
+			failed = taskWarning(t, "Effect D used without -dark-frame, leaving", t.InPath, "unchanged by it") || failed
+		} else if effect == "F" && settings.effects.FlatField == nil {
+			failed = taskWarning(t, "Effect F used without -flat-field, leaving", t.InPath, "unchanged by it") || failed
+		} else if sum, ok := engine.KernelSum(effect); ok && settings.warnKernelSum && math.Abs(sum-1) > 1e-6 &&
+			math.Abs(sum) > 1e-6 {
+			failed = taskWarning(t, "Convolve kernel of", t.InPath, "has weights adding up to", fmt.Sprintf("%g,", sum),
+				"which scales its brightness, set \"normalize\":true to keep it") || failed
+		} else if _, ok := engine.Lookup(effect); !ok && settings.strict {
+			//without -strict, the effect is reported when it is applied
+			failed = taskWarning(t, "Effect command:", effect, "not recognized") || failed
+		}
+	}
+	if failed {
+		return nil, false
+	}
+	if !settings.optimize {
+		return effects, true
+	}
+
+	var plan []string
+	for _, effect := range effects {
+		if effect == "C" && isIdentityCurves() {
+			continue
+		}
+		if effect == "G" && len(plan) > 0 && plan[len(plan)-1] == "G" && !settings.floatPipeline {
+			continue
+		}
+		plan = append(plan, effect)
+	}
+
+	if settings.verbose && len(plan) != len(effects) {
+		fmt.Println("Optimized effects for", t.InPath, "from", effects, "to", plan)
+	}
+	return plan, true
+}
+
+// Returns true if the curves effect was given no control points, which makes every curve the identity
+func isIdentityCurves() bool {
+	return len(settings.effects.CurveRGB) < 2 && len(settings.effects.CurveRed) < 2 &&
+		len(settings.effects.CurveGreen) < 2 && len(settings.effects.CurveBlue) < 2
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"proj2/imageio"
+	"strconv"
+	"strings"
+)
+
+// Overwrite policies, which decide what happens to a task whose outPath already exists
+const (
+	overwriteError   = "error"          // print an error and don't process the task
+	overwriteSkip    = "skip"           // don't process the task, keeping the existing file
+	overwriteReplace = "overwrite"      // replace the existing file
+	overwriteVersion = "version-suffix" // save to the first of out_1.png, out_2.png... that doesn't exist
+)
+
+func isOverwritePolicy(policy string) bool {
+	return policy == overwriteError || policy == overwriteSkip || policy == overwriteReplace ||
+		policy == overwriteVersion
+}
+
+// Returns the overwrite policy of t: its own if it has one, else -overwrite
+func overwritePolicy(t ImageTask) string {
+	if t.Overwrite != "" {
+		return t.Overwrite
+	}
+	return settings.overwrite
+}
+
+// Reports whether t should be processed, which it shouldn't if its outPath exists and its policy is error or skip,
+// or if it would replace its own input without -allow-in-place. With -grid, that goes for the path of each panel.
+// Only saves the work of processing the task: the file could still appear before the output is saved, which
+// saveWithPolicy handles
+func shouldProcess(t ImageTask) bool {
+	for _, out := range outputTasks(t) {
+		if !shouldWrite(out) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether t's output should be saved to its outPath, like shouldProcess. An output that is its own input
+// is only replaced with the overwrite policy and -allow-in-place: version-suffix saves it to out_1.png... like any
+// existing outPath, and error and skip treat it like one
+func shouldWrite(t ImageTask) bool {
+	policy := overwritePolicy(t)
+	if policy != overwriteError && policy != overwriteSkip {
+		if policy == overwriteReplace && !settings.allowInPlace && isInPlace(t) {
+			fmt.Println("ERROR: outPath", t.OutPath, "is the input", t.InPath, "itself, task not processed "+
+				"(use -allow-in-place to replace inputs)")
+			recordFailure(t, "outPath is the input itself")
+			return false
+		}
+		return true
+	}
+	if _, err := os.Stat(t.OutPath); err != nil {
+		return true
+	}
+	reportExisting(t, policy)
+	return false
+}
+
+func reportExisting(t ImageTask, policy string) {
+	if policy == overwriteError {
+		fmt.Println("ERROR: outPath", t.OutPath, "of", t.InPath, "already exists, task not processed")
+		recordFailure(t, "outPath already exists")
+	} else if settings.verbose {
+		fmt.Println("Skipped", t.InPath, "since", t.OutPath, "already exists")
+	}
+}
+
+// Reports whether saving t's output replaces its own input: its policy is overwrite, -allow-in-place is set and its
+// outPath is one of its inputs. Only then is it saved atomically, since every other policy creates the file
+// exclusively instead
+func replacesInput(t ImageTask) bool {
+	return overwritePolicy(t) == overwriteReplace && settings.allowInPlace && isInPlace(t)
+}
+
+// Reports whether t's outPath is one of its inputs, under any name (a different spelling, a link...)
+func isInPlace(t ImageTask) bool {
+	outInfo, err := os.Stat(t.OutPath)
+	if err != nil {
+		return false
+	}
+	for _, path := range taskInputs(t) {
+		if inInfo, err := os.Stat(path); err == nil && os.SameFile(inInfo, outInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// Saves img to t's outPath with opts, following t's overwrite policy. Unless the policy is overwrite, the file is
+// created exclusively, so two tasks with the same outPath can't both write it. Returns the path img was saved to,
+// or "" if the policy said not to save it
+func saveWithPolicy(t ImageTask, img image.Image, opts imageio.EncodeOptions) (string, error) {
+	policy := overwritePolicy(t)
+	opts.Exclusive = policy != overwriteReplace
+	outPath := t.OutPath
+	for version := 1; ; version++ {
+		err := imageio.Save(outPath, img, opts)
+		if err == nil {
+			return outPath, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		if policy != overwriteVersion {
+			reportExisting(t, policy)
+			return "", nil
+		}
+		ext := filepath.Ext(t.OutPath)
+		outPath = strings.TrimSuffix(t.OutPath, ext) + "_" + strconv.Itoa(version) + ext
+	}
+}
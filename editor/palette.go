@@ -0,0 +1,23 @@
+package main
+
+import (
+	"proj2/engine"
+	"proj2/imageio"
+)
+
+// Returns true if, with -keep-palette, t's output should be saved with a palette again: its input is an indexed
+// image and every effect is a point effect, which mostly maps each color to a single color, so the output keeps
+// about as few colors as the input's palette. The colors are counted again when saving, since the calibration
+// effects, -stamp and -clipping-overlay can add some
+func keepsPalette(t ImageTask, effects []string) bool {
+	if !settings.keepPalette || len(t.InPaths) > 0 {
+		return false
+	}
+	for _, code := range effects {
+		if effect, ok := engine.Lookup(code); !ok || effect.Kind != engine.Point {
+			return false
+		}
+	}
+	info, err := imageio.Probe(t.InPath)
+	return err == nil && info.Indexed
+}
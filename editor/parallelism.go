@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Policies of -parallelism
+const (
+	parallelImages = "images" // many images in flight, each on one thread
+	parallelPixels = "pixels" // one image at a time, split across every thread
+	parallelHybrid = "hybrid" // a few images in flight, each split across several threads
+)
+
+// How the parallel version splits its threads between images in flight and the strips of each image
+type parallelism struct {
+	policy          string
+	threadsPerImage int // threads each image is split across with hybrid:[threads], 0 for every thread
+}
+
+// Reads -parallelism, written images, pixels, hybrid or hybrid:[threads per image]
+func parseParallelism(s string) (parallelism, error) {
+	fields := strings.Split(s, ":")
+	switch {
+	case len(fields) == 1 && (s == parallelImages || s == parallelPixels || s == parallelHybrid):
+		return parallelism{policy: s}, nil
+	case len(fields) == 2 && fields[0] == parallelHybrid:
+		if n, err := strconv.Atoi(fields[1]); err == nil && n >= 1 {
+			return parallelism{policy: parallelHybrid, threadsPerImage: n}, nil
+		}
+	}
+	return parallelism{}, fmt.Errorf("invalid -parallelism %q, expected images, pixels, hybrid or "+
+		"hybrid:[threads per image] such as hybrid:4", s)
+}
+
+// Returns how many worker pipelines, each processing one image at a time, run with numThreads threads. Only hybrid
+// keeps -k worker pipelines for every threadsPerImage threads (5 without a ratio)
+func (p parallelism) workers(numThreads int, workerDepth int) int {
+	switch p.policy {
+	case parallelImages:
+		return numThreads
+	case parallelPixels:
+		return 1
+	}
+	perImage := p.threadsPerImage
+	if perImage == 0 {
+		perImage = 5
+	}
+	return int(math.Ceil(float64(numThreads)/float64(perImage))) * workerDepth
+}
+
+// Images queued or having their effects applied in the parallel version, counting the one a worker is about to
+// start
+var activeImages int64
+
+// Returns how many threads the effects of an image are decomposed across when numThreads threads are current and
+// active images, this one included, are queued or in progress. When too few images are active to keep every thread
+// busy at the policy's threads per image, such as at the end of a batch or in a batch of a few images, each gets an
+// equal share of the threads instead, so the surplus isn't left idle
+func (p parallelism) imageThreads(numThreads int, active int) int {
+	perImage := numThreads
+	if p.policy == parallelImages {
+		perImage = 1
+	} else if p.threadsPerImage > 0 && p.threadsPerImage < numThreads {
+		perImage = p.threadsPerImage
+	}
+	if active > 0 && numThreads/active > perImage {
+		return numThreads / active
+	}
+	return perImage
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"proj2/engine"
+)
+
+// Reads JSON from r, escaping every backslash inside a string that doesn't start a valid JSON escape, so task
+// files with Windows paths written as "C:\images\in.png" decode instead of failing on "\i". Backslashes that do
+// start an escape, as in "C:\new", still decode as that escape, which checkTaskPaths then reports
+type lenientEscapes struct {
+	r        *bufio.Reader
+	inString bool
+	pending  []byte // bytes to return before reading more of r
+}
+
+func (l *lenientEscapes) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.pending) > 0 {
+			p[n] = l.pending[0]
+			l.pending = l.pending[1:]
+			n++
+			continue
+		}
+		if n > 0 && l.r.Buffered() == 0 {
+			break //don't wait for more input when there is some to return, since tasks can arrive one at a time
+		}
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if c == '"' {
+			l.inString = !l.inString
+		} else if c == '\\' && l.inString {
+			if l.validEscape() {
+				escaped, _ := l.r.ReadByte() //pass the escaped character through, so \" doesn't end the string
+				l.pending = append(l.pending, escaped)
+			} else {
+				l.pending = append(l.pending, '\\')
+			}
+		}
+		p[n] = c
+		n++
+	}
+	return n, nil
+}
+
+// Reports whether the input after a backslash is a valid JSON escape. Only a \u escape needs more than one byte
+// of lookahead, and its four hex digits are always followed by more of the string
+func (l *lenientEscapes) validEscape() bool {
+	next, err := l.r.Peek(1)
+	if err != nil {
+		return false
+	}
+	switch next[0] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		return true
+	case 'u':
+		hex, err := l.r.Peek(5)
+		if err != nil {
+			return false
+		}
+		for _, c := range hex[1:] {
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Checks that t's paths have no control characters, which only end up in a path when a Windows path's
+// backslashes weren't escaped and happened to form a JSON escape, such as the \n of "C:\new", resolves them under
+// -root and converts them to the form the OS takes them in
+func checkTaskPaths(t *engine.Task) error {
+	for _, path := range append([]string{t.InPath, t.OutPath}, t.InPaths...) {
+		for _, c := range path {
+			if c < ' ' || c == 0x7f {
+				return fmt.Errorf("path %q contains a control character, write backslashes in task JSON as \\\\ or "+
+					"use / instead", path)
+			}
+		}
+	}
+	var err error
+	if t.InPath, err = rootedPath(t.InPath); err != nil {
+		return err
+	}
+	if t.OutPath, err = rootedPath(t.OutPath); err != nil {
+		return err
+	}
+	for i := range t.InPaths {
+		if t.InPaths[i], err = rootedPath(t.InPaths[i]); err != nil {
+			return err
+		}
+	}
+	t.InPath = nativePath(t.InPath)
+	t.OutPath = nativePath(t.OutPath)
+	for i := range t.InPaths {
+		t.InPaths[i] = nativePath(t.InPaths[i])
+	}
+	return nil
+}
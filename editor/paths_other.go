@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// Returns path unchanged, since only Windows needs paths converted
+func nativePath(path string) string {
+	return path
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Length from which Windows file APIs need the \\?\ prefix on a path
+const maxPath = 260
+
+// Returns path with backslash separators and, if it is too long for the Windows file APIs, made absolute and
+// given the \\?\ prefix (\\?\UNC\ for network shares), which lifts the MAX_PATH limit. Paths that already have
+// the prefix are left alone, since Windows doesn't clean them
+func nativePath(path string) string {
+	if path == "" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	path = filepath.FromSlash(path)
+	if len(path) < maxPath {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"proj2/imageio"
+	"proj2/png"
+	"sync"
+)
+
+// Decodes the inputs of upcoming tasks in the background while the workers are busy with earlier ones, so a
+// worker taking a task usually finds its image already decoded. At most slots images are decoded ahead at once,
+// and, if budget isn't 0, they take at most budget bytes together
+type prefetcher struct {
+	mu     sync.Mutex
+	freed  *sync.Cond // signalled whenever a worker takes a prefetched image
+	slots  int
+	budget int64
+	held   int64 // estimated bytes of the images being decoded or waiting for a worker
+}
+
+// An input image being decoded ahead of its task
+type prefetchedImage struct {
+	done   chan struct{} // closed once img and err are set
+	img    *png.Image
+	err    error
+	size   int64
+	parent *prefetcher
+}
+
+func newPrefetcher(slots int, budget int64) *prefetcher {
+	p := &prefetcher{slots: slots, budget: budget}
+	p.freed = sync.NewCond(&p.mu)
+	return p
+}
+
+// Starts decoding t's input, once a slot and enough of the budget are free. Waits for them, which holds the
+// producer back the same way a full task queue does. An image bigger than the whole budget is still decoded once
+// nothing else is held, so it can't block every task after it
+func (p *prefetcher) start(t *ImageTask) {
+	size := int64(0)
+	if info, err := imageio.Probe(t.InPath); err == nil {
+		size = int64(info.Width) * int64(info.Height) * 16 //a 64 bit pixel for the decoded input and the output
+	}
+
+	p.mu.Lock()
+	for p.slots == 0 || (p.budget != 0 && p.held > 0 && p.held+size > p.budget) {
+		p.freed.Wait()
+	}
+	p.slots--
+	p.held += size
+	p.mu.Unlock()
+
+	prefetch := &prefetchedImage{done: make(chan struct{}), size: size, parent: p}
+	t.prefetch = prefetch
+	go func() {
+		prefetch.img, prefetch.err = loadTaskInput(*t, currentThreads())
+		close(prefetch.done)
+	}()
+}
+
+// Waits for the image to be decoded and returns it, handing its slot and share of the budget to the next task
+func (prefetch *prefetchedImage) take() (*png.Image, error) {
+	<-prefetch.done
+	p := prefetch.parent
+	p.mu.Lock()
+	p.slots++
+	p.held -= prefetch.size
+	p.mu.Unlock()
+	p.freed.Broadcast()
+	return prefetch.img, prefetch.err
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Printed once if a thread's priority can't be lowered
+var ioNiceWarning sync.Once
+
+// Runs f, which decodes or encodes an image, on a thread of its own whose niceness is raised by -io-nice, and
+// waits for it to return, so file work yields the CPU to the effects and to other programs on a shared machine.
+// Without -io-nice, f simply runs on the calling goroutine
+func atIOPriority(f func()) {
+	if settings.ioNice == 0 {
+		f()
+		return
+	}
+	done := make(chan bool)
+	go func() {
+		//never unlocked, so the thread exits with this goroutine rather than running other goroutines at its
+		//lowered priority, which an unprivileged process can't raise back
+		runtime.LockOSThread()
+		if err := lowerThreadPriority(settings.ioNice); err != nil {
+			ioNiceWarning.Do(func() { fmt.Println("WARNING: -io-nice has no effect:", err) })
+		}
+		f()
+		done <- true
+	}()
+	<-done
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"syscall"
+)
+
+// Raises the niceness of the calling thread by increment, up to the maximum of 19. On Linux, setpriority with a
+// thread id only changes that thread
+func lowerThreadPriority(increment int) error {
+	tid := syscall.Gettid()
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+	if err != nil {
+		return err
+	}
+	nice := 20 - prio + increment //the raw system call returns 20 - niceness
+	if nice > 19 {
+		nice = 19
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// Threads can only be given their own priority on Linux
+func lowerThreadPriority(increment int) error {
+	return errors.New("thread priorities are only supported on Linux")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Tasks each worker's shard holds before the producer has to look for another shard with room
+const queueShardSize = 2
+
+// A multi-consumer task queue split into one buffered channel per worker. A single producer pushes every task, so
+// the only synchronization on a shard is between the producer and that shard's worker, instead of every worker
+// contending for one channel or for a lock around the decoder. A worker whose shard runs dry steals from the
+// others, so tasks don't wait behind a worker stuck on a big image while another worker is idle. With a cost model,
+// tasks go to the worker with the least estimated work committed to it instead, which keeps the workers finishing
+// at about the same time
+type taskQueue struct {
+	shards []chan ImageTask
+	next   int           // shard the next task is offered to first
+	pushed chan struct{} // gets a token whenever a task is pushed, waking a worker waiting to steal it
+	closed chan struct{} // closed once every task has been pushed
+
+	mu    sync.Mutex
+	loads []float64 // estimated seconds of the tasks in each shard and the task its worker is processing
+
+	// Called, if not nil, whenever the worker owning shard own takes t from shard, before it processes t. Tests
+	// can block in it to force the interleaving of workers they want to check
+	onTake func(shard int, own int, t ImageTask)
+}
+
+func newTaskQueue(numShards int, shardSize int) *taskQueue {
+	q := &taskQueue{shards: make([]chan ImageTask, numShards), pushed: make(chan struct{}, numShards),
+		closed: make(chan struct{}), loads: make([]float64, numShards)}
+	for i := range q.shards {
+		q.shards[i] = make(chan ImageTask, shardSize)
+	}
+	return q
+}
+
+// Gives t to the first shard with room, starting after the shard that got the previous task, so idle workers get
+// tasks before busy ones. If every shard is full, waits for room in the next shard in turn. Only one goroutine may
+// push
+func (q *taskQueue) push(t ImageTask) {
+	defer q.wake()
+	if costModel != nil {
+		q.pushLeastLoaded(t)
+		return
+	}
+	for i := 0; i < len(q.shards); i++ {
+		shard := q.shards[(q.next+i)%len(q.shards)]
+		select {
+		case shard <- t:
+			q.next = (q.next + i + 1) % len(q.shards)
+			return
+		default:
+		}
+	}
+	q.shards[q.next] <- t
+	q.next = (q.next + 1) % len(q.shards)
+}
+
+// Gives t to the shard with room whose worker has the least estimated work, or if every shard is full, waits for
+// room in the one with the least
+func (q *taskQueue) pushLeastLoaded(t ImageTask) {
+	q.mu.Lock()
+	order := make([]int, len(q.shards))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return q.loads[order[i]] < q.loads[order[j]] })
+	q.mu.Unlock()
+
+	for _, i := range order {
+		q.addLoad(i, t.cost) //before the task can be taken, so taking it never drives the load negative
+		select {
+		case q.shards[i] <- t:
+			return
+		default:
+			q.addLoad(i, -t.cost)
+		}
+	}
+	q.addLoad(order[0], t.cost)
+	q.shards[order[0]] <- t
+}
+
+func (q *taskQueue) addLoad(shard int, seconds float64) {
+	q.mu.Lock()
+	q.loads[shard] += seconds
+	q.mu.Unlock()
+}
+
+// Moves the estimated work of a task taken from shard to the worker owning shard own, which is now processing it
+func (q *taskQueue) take(shard int, own int, t ImageTask) {
+	if q.onTake != nil {
+		q.onTake(shard, own, t)
+	}
+	if shard != own {
+		q.mu.Lock()
+		q.loads[shard] -= t.cost
+		q.loads[own] += t.cost
+		q.mu.Unlock()
+	}
+}
+
+// Takes the estimated work of t off the worker owning shard own once it has processed t
+func (q *taskQueue) done(own int, t ImageTask) {
+	q.addLoad(own, -t.cost)
+}
+
+// Lets a waiting worker know a task was pushed. If tokens are already waiting, one of them will do
+func (q *taskQueue) wake() {
+	select {
+	case q.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the next task for the worker owning shard own: the oldest task of its shard, or else one stolen from
+// the other shards. Waits while every shard is empty, and returns false once the queue is closed and they all are.
+// The worker must call done once it has processed the task
+func (q *taskQueue) pop(own int) (ImageTask, bool) {
+	for {
+		//checked before the scan, so a task pushed just before the queue was closed is still found by it
+		closed := false
+		select {
+		case <-q.closed:
+			closed = true
+		default:
+		}
+		for i := 0; i < len(q.shards); i++ {
+			shard := (own + i) % len(q.shards)
+			select {
+			case t, ok := <-q.shards[shard]:
+				if ok {
+					q.take(shard, own, t)
+					return t, true
+				}
+			default:
+			}
+		}
+		if closed {
+			//every shard was empty after the last push, since the scan above came after the queue was closed
+			return ImageTask{}, false
+		}
+		select {
+		case t, ok := <-q.shards[own]:
+			if ok {
+				q.take(own, own, t)
+				return t, true
+			}
+		case <-q.pushed:
+		case <-q.closed:
+		}
+	}
+}
+
+// Closes every shard, so workers finish once every shard is empty
+func (q *taskQueue) close() {
+	for _, shard := range q.shards {
+		close(shard)
+	}
+	close(q.closed)
+}
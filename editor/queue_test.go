@@ -0,0 +1,45 @@
+package main
+
+import (
+	"proj2/engine"
+	"testing"
+)
+
+func queueTask(inPath string) ImageTask {
+	return ImageTask{Task: engine.Task{InPath: inPath}}
+}
+
+func TestTaskQueueSteal(t *testing.T) {
+	q := newTaskQueue(2, queueShardSize)
+	var takes [][2]int
+	q.onTake = func(shard int, own int, t ImageTask) {
+		takes = append(takes, [2]int{shard, own})
+	}
+	q.push(queueTask("a")) //shard 0
+	q.push(queueTask("b")) //shard 1
+
+	//worker 1 takes its own task, then steals worker 0's, as if worker 0 were stuck on a big image
+	for _, want := range []string{"b", "a"} {
+		task, ok := q.pop(1)
+		if !ok || task.InPath != want {
+			t.Fatalf("pop(1) = %q, %v, want %q", task.InPath, ok, want)
+		}
+		q.done(1, task)
+	}
+	if len(takes) != 2 || takes[0] != [2]int{1, 1} || takes[1] != [2]int{0, 1} {
+		t.Fatalf("takes (shard, worker) = %v, want [[1 1] [0 1]]", takes)
+	}
+}
+
+func TestTaskQueueClose(t *testing.T) {
+	q := newTaskQueue(2, queueShardSize)
+	q.push(queueTask("a"))
+	q.close()
+	//the task pushed before the queue was closed is still handed out, to whichever worker asks
+	if task, ok := q.pop(1); !ok || task.InPath != "a" {
+		t.Fatalf("pop(1) = %q, %v, want \"a\"", task.InPath, ok)
+	}
+	if _, ok := q.pop(0); ok {
+		t.Fatal("pop returned a task from a closed, empty queue")
+	}
+}
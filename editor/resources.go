@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"proj2/imageio"
+	"runtime"
+	"time"
+)
+
+// CPU time and memory of the whole process, as the OS accounts them
+type processUsage struct {
+	cpu     time.Duration // user and system time of every thread
+	peakRSS uint64        // largest resident set size, in bytes
+}
+
+var resources struct {
+	enabled bool
+	started time.Time
+	threads int // threads the run was given, 1 for the sequential version
+	start   processUsage
+}
+
+// Starts accounting the resources used by the run, which is given threads threads
+func startResources(threads int) {
+	resources.enabled = true
+	resources.started = clock.Now()
+	resources.threads = threads
+	resources.start, _ = readProcessUsage()
+}
+
+// Prints the resources used since startResources: CPU time against wall time, peak RSS, bytes of image files
+// decoded and encoded and the time the garbage collector paused the run, so runs of different engine versions on
+// the same machine can be compared
+func printResources() {
+	wall := since(resources.started)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	loaded, saved := imageio.Traffic()
+	usage, err := readProcessUsage()
+	if err != nil {
+		fmt.Printf("Resources: %v wall, CPU time and peak RSS unavailable (%v)\n", wall.Round(time.Millisecond), err)
+	} else {
+		cpu := usage.cpu - resources.start.cpu
+		cores := cpu.Seconds() / wall.Seconds()
+		fmt.Printf("Resources: %v CPU over %v wall, %.2f of %d threads busy on average (%.0f%% parallel "+
+			"efficiency), peak RSS %s\n", cpu.Round(time.Millisecond), wall.Round(time.Millisecond), cores,
+			resources.threads, 100*cores/float64(resources.threads), formatMiB(usage.peakRSS))
+	}
+	fmt.Printf("Resources: %s of image files decoded, %s encoded, %d GC cycles paused the run for %v\n",
+		formatMiB(uint64(loaded)), formatMiB(uint64(saved)), mem.NumGC,
+		time.Duration(mem.PauseTotalNs).Round(time.Microsecond))
+}
+
+// Formats bytes in mebibytes for the resource summary
+func formatMiB(bytes uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(bytes)/(1<<20))
+}
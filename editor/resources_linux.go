@@ -0,0 +1,17 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// Reads the CPU time and peak RSS of the editor from getrusage
+func readProcessUsage() (processUsage, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return processUsage{}, err
+	}
+	//ru_maxrss is in kilobytes on Linux
+	return processUsage{cpu: time.Duration(usage.Utime.Nano() + usage.Stime.Nano()),
+		peakRSS: uint64(usage.Maxrss) * 1024}, nil
+}
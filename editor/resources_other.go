@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// The CPU time and peak RSS of the editor are only read on Linux
+func readProcessUsage() (processUsage, error) {
+	return processUsage{}, errors.New("reading CPU time and peak RSS is only supported on Linux")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"proj2/engine"
+	"strings"
+	"sync"
+)
+
+// The tasks that failed during the run, for -retry-file and -strict: those that printed an ERROR and weren't
+// processed or saved, and those the watchdog gave up on
+var failures struct {
+	sync.Mutex
+	enabled bool
+	tasks   []failedTask
+}
+
+type failedTask struct {
+	task   engine.Task
+	reason string
+}
+
+// Starts recording the tasks that fail, to be written by writeRetryFile or counted by countFailures
+func startFailures() {
+	failures.enabled = true
+}
+
+// Records that t failed for reason. Does nothing without -retry-file or -strict
+func recordFailure(t ImageTask, reason string) {
+	if !failures.enabled {
+		return
+	}
+	task := t.Task
+	if t.gridOf != "" {
+		task.OutPath = t.gridOf //rerunning the task saves every panel again
+	}
+	failures.Lock()
+	failures.tasks = append(failures.tasks, failedTask{task: task, reason: reason})
+	failures.Unlock()
+}
+
+// Returns the number of tasks that failed so far
+func countFailures() int {
+	failures.Lock()
+	defer failures.Unlock()
+	return len(failures.tasks)
+}
+
+// Lists the tasks that failed with why, and writes them to path as JSON tasks with their original fields, one per
+// line, so they can be fed back to the editor as they are. The file is written, empty, even if no task failed, so
+// one left by an earlier run is never taken for this run's failures
+func writeRetryFile(path string) {
+	failures.Lock()
+	defer failures.Unlock()
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	for _, failed := range failures.tasks {
+		task := struct {
+			engine.Task
+			Effects EffectList `json:"effects"` //effect objects as objects, like the task had them
+		}{Task: failed.task, Effects: failed.task.Effects}
+		if err := enc.Encode(task); err != nil {
+			panic(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		panic(err)
+	}
+	if len(failures.tasks) == 0 {
+		return
+	}
+	fmt.Println(len(failures.tasks), "tasks failed:")
+	for _, failed := range failures.tasks {
+		inPath := failed.task.InPath
+		if inPath == "" {
+			inPath = strings.Join(failed.task.InPaths, "+")
+		}
+		fmt.Println("  ", inPath, "->", failed.task.OutPath+":", failed.reason)
+	}
+	fmt.Println("Rerun them with:", rerunCommand(path))
+}
+
+// Returns the command line of this run with its tasks read from path on Stdin instead, without -tasks, which would
+// be read instead of Stdin, and without -retry-file, so the rerun doesn't replace the file it reads
+func rerunCommand(path string) string {
+	args := []string{filepath.Base(os.Args[0])}
+	for i := 1; i < len(os.Args); i++ {
+		name := strings.TrimLeft(os.Args[i], "-")
+		if name == "retry-file" || name == "tasks" {
+			i++ //the path is the next argument
+			continue
+		}
+		if strings.HasPrefix(name, "retry-file=") || strings.HasPrefix(name, "tasks=") {
+			continue
+		}
+		args = append(args, shellQuote(os.Args[i]))
+	}
+	return strings.Join(args, " ") + " < " + shellQuote(path)
+}
+
+// Returns arg quoted for a POSIX shell, if it needs to be
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?[]#~;&|<>()") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRerunCommand(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"/usr/bin/editor", "-p", "4", "-tasks", "a.json", "--tasks=b.json", "-retry-file",
+		"retry.json", "--retry-file=retry2.json", "-report", "my report.txt"}
+	//the rerun reads only the failed tasks, from Stdin, and leaves the retry file it reads alone
+	want := "editor -p 4 -report 'my report.txt' < 'failed tasks.json'"
+	if got := rerunCommand("failed tasks.json"); got != want {
+		t.Fatalf("rerunCommand = %q, want %q", got, want)
+	}
+}
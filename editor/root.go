@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The directory task paths are confined to with -root, as given and with its symbolic links resolved
+var taskRoot struct {
+	path     string
+	resolved string
+}
+
+// Sets the directory every task path is resolved and confined under, which must exist
+func setupRoot(root string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fmt.Errorf("invalid -root: %v", err)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return fmt.Errorf("invalid -root: %s isn't a directory", root)
+	}
+	taskRoot.path, taskRoot.resolved = abs, resolved
+	return nil
+}
+
+// Returns path, a path of a task, resolved under -root: a relative path is taken from the root, an absolute one has
+// to be under it already, like the paths of a container with its volume mounted at the root. Paths whose .. climb
+// above the root, or that lead out of it through a symbolic link, are refused, so tasks from an untrusted source
+// can't read or write anything else. Returns path as it is without -root
+func rootedPath(path string) (string, error) {
+	if taskRoot.path == "" || path == "" {
+		return path, nil
+	}
+	joined := filepath.Clean(path)
+	if !filepath.IsAbs(path) {
+		joined = filepath.Join(taskRoot.path, path)
+	}
+	if !within(taskRoot.path, joined) {
+		return "", fmt.Errorf("path %q is outside of -root %s", path, taskRoot.path)
+	}
+	//the part of the path that exists, its links resolved, has to stay under the root too. Outputs don't exist yet,
+	//but their directories can be links
+	for existing := joined; ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !within(taskRoot.resolved, resolved) {
+				return "", fmt.Errorf("path %q leads outside of -root %s through a symbolic link", path, taskRoot.path)
+			}
+			return joined, nil
+		}
+		if _, lerr := os.Lstat(existing); lerr == nil {
+			//a link to nothing, which saving would create wherever it points
+			return "", fmt.Errorf("path %q leads through a broken symbolic link under -root %s", path, taskRoot.path)
+		}
+		if !os.IsNotExist(err) || filepath.Dir(existing) == existing {
+			return "", err
+		}
+	}
+}
+
+// Returns whether path is dir or under it. Both must be absolute and clean
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Prints a WARNING if Stdin, read for tasks with -root, is a terminal or a device such as /dev/null rather than a
+// pipe or a file, which is what a container run without docker run -i gets
+func warnStdinNotPiped() {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Println("WARNING: Stdin, read for tasks, isn't a pipe or a file; in a container, run it with " +
+			"docker run -i and pipe the tasks in")
+	}
+}
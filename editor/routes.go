@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"proj2/imageio"
+)
+
+// A config rule that changes the effects of the tasks whose input matches If, e.g.
+//
+//	{"if": {"minWidth": 4000}, "prepend": ["B"]}
+//	{"if": {"format": "jpeg", "orientation": "portrait"}, "effects": ["G", "S"]}
+//
+// Effects replaces a task's effects, then Prepend and Append are added around them. Only the first matching route
+// is applied
+type Route struct {
+	If      RouteCondition `json:"if"`
+	Effects EffectList     `json:"effects"`
+	Prepend EffectList     `json:"prepend"`
+	Append  EffectList     `json:"append"`
+}
+
+// Properties an input must have for a route to apply. Fields left out match every input
+type RouteCondition struct {
+	Format      string `json:"format"` // format name of the decoder, png or jpeg
+	MinWidth    int    `json:"minWidth"`
+	MaxWidth    int    `json:"maxWidth"`
+	MinHeight   int    `json:"minHeight"`
+	MaxHeight   int    `json:"maxHeight"`
+	Orientation string `json:"orientation"` // landscape, portrait or square
+	BitDepth    int    `json:"bitDepth"`    // bits per channel, 8 or 16
+}
+
+// Returns true if an image with the given header meets every condition in c
+func (c RouteCondition) matches(h imageio.Info) bool {
+	orientation := "square"
+	if h.Width > h.Height {
+		orientation = "landscape"
+	} else if h.Width < h.Height {
+		orientation = "portrait"
+	}
+	return (c.Format == "" || c.Format == h.Format) &&
+		(c.MinWidth == 0 || h.Width >= c.MinWidth) && (c.MaxWidth == 0 || h.Width <= c.MaxWidth) &&
+		(c.MinHeight == 0 || h.Height >= c.MinHeight) && (c.MaxHeight == 0 || h.Height <= c.MaxHeight) &&
+		(c.Orientation == "" || c.Orientation == orientation) &&
+		(c.BitDepth == 0 || c.BitDepth == h.BitDepth)
+}
+
+// Returns t's effects changed by the first config route its input matches. Only the input's header is read, and
+// only if there are routes. If the header can't be read, the effects are left as they are, so the full decode
+// reports the error
+func routeEffects(t ImageTask) []string {
+	if len(config.Routes) == 0 {
+		return t.Effects
+	}
+	header, err := imageio.Probe(t.InPath)
+	if err != nil {
+		return t.Effects
+	}
+	for i, route := range config.Routes {
+		if !route.If.matches(header) {
+			continue
+		}
+		effects := t.Effects
+		if len(route.Effects) > 0 {
+			effects = route.Effects
+		}
+		routed := append(append(append([]string{}, route.Prepend...), effects...), route.Append...)
+		if settings.verbose {
+			fmt.Println("Route", i, "matched", t.InPath, "changing effects from", t.Effects, "to", routed)
+		}
+		return routed
+	}
+	return t.Effects
+}
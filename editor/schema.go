@@ -0,0 +1,26 @@
+package main
+
+import "strconv"
+
+// Versions of the JSON formats the editor writes. A version is bumped whenever a field is renamed, removed or
+// changes meaning, so parsers can tell which layout they are reading; adding a field doesn't bump it
+const (
+	manifestSchemaVersion    = 1
+	validationSchemaVersion  = 1
+	compareSchemaVersion     = 1
+	effectStatsSchemaVersion = 1
+	dedupSchemaVersion       = 1
+	costModelSchemaVersion   = 1
+	versionSchemaVersion     = 1
+)
+
+// A float64 written to JSON with a fixed number of decimals. Go never formats numbers by locale, but the last
+// digits of a float can differ between platforms (for example where the compiler fuses multiply-adds), so
+// metrics are rounded before they're written to keep reports from different machines byte-for-byte comparable
+type decimal float64
+
+const decimalPlaces = 6
+
+func (d decimal) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(d), 'f', decimalPlaces, 64), nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"proj2/engine"
+	"proj2/imageio"
+	"proj2/png"
+	"strings"
+)
+
+// Thread counts the parallel version is checked at by selftest
+var selftestThreads = []int{1, 2, 4, 8}
+
+// Edge modes every check of selftest is run in, overriding -edge-mode
+var selftestEdgeModes = []string{"zero", "wrap-x", "extend"}
+
+// Effects whose kernels sum to 1, so with the extend edge mode they must leave an image of a single color as it is
+// right up to its edges. The blur reaches past every edge of the smaller images
+var selftestUniformEffects = []string{
+	"S",
+	"B",
+	`{"type":"convolve","kernel":[[1,1,1,1,1],[1,2,2,2,1],[1,2,4,2,1],[1,2,2,2,1],[1,1,1,1,1]],"normalize":true}`,
+	`{"type":"blur","radius":7}`,
+}
+
+// Sizes of the single color images the extend edge mode is checked on, down to a single pixel
+var selftestUniformSizes = []image.Rectangle{
+	image.Rect(0, 0, 1, 1), image.Rect(0, 0, 1, 9), image.Rect(0, 0, 9, 1), image.Rect(0, 0, 13, 5),
+}
+
+// Images selftest saves to every output format, to check the format matrix: the bits per channel of their source
+// and whether they have transparent pixels
+var selftestSources = []struct {
+	name        string
+	bitDepth    int
+	transparent bool
+}{
+	{"opaque 8 bit", 8, false},
+	{"transparent 8 bit", 8, true},
+	{"opaque 16 bit", 16, false},
+}
+
+// Effect objects selftest checks along with the registered effects. The blur reaches further than any built in
+// effect, so strips need more than the usual padding
+var selftestObjects = []string{
+	`{"type":"convolve","kernel":[[-2,-1,0],[-1,1,1],[0,1,2]]}`,
+	`{"type":"convolve","kernel":[[1,1,1,1,1],[1,2,2,2,1],[1,2,4,2,1],[1,2,2,2,1],[1,1,1,1,1]],"normalize":true}`,
+	`{"type":"blur","radius":7}`,
+	`{"type":"gradient-map","gradient":"#1b2a49:0,#c0392b:0.4,#f7dc6f:1"}`,
+	`{"type":"flatten","background":"#336699"}`,
+}
+
+// Runs "editor selftest": applies every registered effect and a few effect objects to a set of generated images,
+// sequentially and with the parallel decomposition at 1, 2, 4 and 8 threads, and checks that every run gives the same
+// pixels, keeps the image's size and, for effects that promise it, keeps the alpha channel. Then applies the chain of
+// every effect with both pipelines and checks that neither the thread count nor a strip ceiling changes a single bit of
+// the output. All of it is done in every edge mode, and the extend mode is also checked to keep images of a single
+// color as they are. Finally saves images with and without transparency and 16 bit sources to every output format,
+// checking the format capability matrix. Prints one line per failure and a summary, and exits with status 1 if anything
+// failed
+func runSelftest() {
+	effects := append([]engine.Effect{}, engine.Effects...)
+	for _, obj := range selftestObjects {
+		code, err := engine.ParseEffectObject([]byte(obj))
+		if err != nil {
+			panic(err)
+		}
+		effect, _ := engine.Lookup(code)
+		effects = append(effects, effect)
+	}
+
+	//run strips on a shared pool like the parallel version does, with fewer goroutines than most runs have strips
+	settings.effects.Pool = engine.NewPool(2)
+	passed, failed := 0, 0
+	for _, mode := range selftestEdgeModes {
+		png.Edges = edgeModes[mode]
+		for _, sample := range selftestImages() {
+			for _, effect := range effects {
+				if err := selftestEffect(sample.img, effect); err != nil {
+					fmt.Printf("FAIL %s (%s) on %s, edge mode %s: %v\n", effect.Code, effect.Name, sample.name, mode,
+						err)
+					failed++
+				} else {
+					passed++
+				}
+			}
+			if err := selftestChain(sample.img); err != nil {
+				fmt.Printf("FAIL chain on %s, edge mode %s: %v\n", sample.name, mode, err)
+				failed++
+			} else {
+				passed++
+			}
+		}
+	}
+
+	png.Edges = png.EdgeExtend
+	for _, bounds := range selftestUniformSizes {
+		for _, code := range selftestUniformEffects {
+			if err := selftestUniform(bounds, code); err != nil {
+				fmt.Printf("FAIL %s on a single color %dx%d, edge mode extend: %v\n", code, bounds.Dx(), bounds.Dy(),
+					err)
+				failed++
+			} else {
+				passed++
+			}
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "selftest")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, source := range selftestSources {
+		for _, caps := range imageio.OutputCapabilities {
+			if err := selftestFormat(dir, source.bitDepth, source.transparent, caps); err != nil {
+				fmt.Printf("FAIL %s image saved as %s: %v\n", source.name, caps.Format, err)
+				failed++
+			} else {
+				passed++
+			}
+		}
+	}
+	fmt.Printf("selftest: %d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	} else {
+		fmt.Println("PASS")
+	}
+}
+
+// Runs a single effect on src every way and compares the results. Panics are reported as failures
+func selftestEffect(src image.Image, effect engine.Effect) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	sequential := png.FromImage(src)
+	processEffect(sequential, effect.Code)
+	if err := checkInvariants(src, sequential.Output(), effect); err != nil {
+		return fmt.Errorf("sequential: %v", err)
+	}
+	for _, numThreads := range selftestThreads {
+		parallel := parallelDecomposeEffect(png.FromImage(src), effect.Code, numThreads)
+		if mismatches := parallel.MismatchedPixels(sequential); mismatches > 0 {
+			return fmt.Errorf("%d threads: %d pixels differ from the sequential result", numThreads, mismatches)
+		}
+	}
+	return nil
+}
+
+// Saves an image whose source has bitDepth bits per channel, with some transparent pixels if transparent, in the
+// output format described by caps. Checks that Save refuses it with a CapabilityError, writing nothing, exactly when
+// caps can't hold it, and saves it anyway when told to coerce. Outputs of formats Load reads must decode to an
+// image of the same size, and png outputs of 16 bit sources must keep 16 bits
+func selftestFormat(dir string, bitDepth int, transparent bool, caps imageio.FormatCapabilities) error {
+	img := image.NewRGBA64(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetRGBA64(x, y, color.RGBA64{uint16(x * 4099), uint16(y * 8191), 0x8001, 0xffff})
+		}
+	}
+	if transparent {
+		img.SetRGBA64(0, 0, color.RGBA64{})
+	}
+	ext := "." + caps.Format
+	if caps.Format == "jpeg" {
+		ext = ".jpg"
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d_%t%s", bitDepth, transparent, ext))
+	opts := imageio.EncodeOptions{SourceBitDepth: bitDepth}
+	err := imageio.Save(path, img, opts)
+
+	if refuse := caps.BitDepth < bitDepth || (transparent && !caps.Alpha); refuse {
+		if _, ok := err.(*imageio.CapabilityError); !ok {
+			return fmt.Errorf("expected a capability error, got %v", err)
+		}
+		if _, statErr := os.Stat(path); statErr == nil {
+			return fmt.Errorf("refused, but a file was written")
+		}
+		opts.Coerce = true
+		if err := imageio.Save(path, img, opts); err != nil {
+			return fmt.Errorf("coerced: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, format := range imageio.InputFormats {
+		if format != caps.Format {
+			continue
+		}
+		decoded, _, err := imageio.Load(path)
+		if err != nil {
+			return err
+		}
+		if decoded.Bounds().Size() != img.Bounds().Size() {
+			return fmt.Errorf("decoded to %v instead of %v", decoded.Bounds().Size(), img.Bounds().Size())
+		}
+		info, err := imageio.Probe(path)
+		if err != nil {
+			return err
+		}
+		if caps.Format == "png" && info.BitDepth < bitDepth {
+			return fmt.Errorf("saved at %d bits per channel, from a %d bit source", info.BitDepth, bitDepth)
+		}
+	}
+	return nil
+}
+
+// Applies the effect code to an image of a single color within bounds, sequentially and at 4 threads, and checks
+// that no pixel changes by more than rounding. Panics are reported as failures
+func selftestUniform(bounds image.Rectangle, code string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	c := color.RGBA64{40000, 20000, 10000, 65535}
+	src := image.NewRGBA64(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			src.SetRGBA64(x, y, c)
+		}
+	}
+	if strings.HasPrefix(code, "{") {
+		if code, err = engine.ParseEffectObject([]byte(code)); err != nil {
+			return err
+		}
+	}
+	sequential := png.FromImage(src)
+	processEffect(sequential, code)
+	parallel := parallelDecomposeEffect(png.FromImage(src), code, 4)
+	for name, result := range map[string]image.Image{"sequential": sequential.Output(), "4 threads": parallel.Output()} {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := result.At(x, y).RGBA()
+				if absDiff(r, uint32(c.R)) > 1 || absDiff(g, uint32(c.G)) > 1 || absDiff(b, uint32(c.B)) > 1 {
+					return fmt.Errorf("%s: pixel (%d, %d) changed from %v to {%d %d %d}", name, x, y, c, r, g, b)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func absDiff(a uint32, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// Applies every registered effect in a row to src with the pipeline and the float32 pipeline, and checks that each
+// gives the same output at every thread count as sequentially. Panics are reported as failures
+func selftestChain(src image.Image) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	var chain []string
+	for _, effect := range engine.Effects {
+		chain = append(chain, effect.Code)
+	}
+	sequential := png.FromImage(src)
+	for i, effect := range chain {
+		processEffect(sequential, effect)
+		if i != len(chain)-1 {
+			sequential.SetImgOutToIn()
+		}
+	}
+	sequentialFloat := png.FromImage(src)
+	processEffectsFloat(sequentialFloat, chain, 1)
+
+	for _, numThreads := range selftestThreads {
+		parallel := png.FromImage(src)
+		processEffectsPipeline(parallel, chain, numThreads)
+		if mismatches := parallel.MismatchedPixels(sequential); mismatches > 0 {
+			return fmt.Errorf("%d threads: %d pixels differ from the sequential result", numThreads, mismatches)
+		}
+		parallelFloat := png.FromImage(src)
+		processEffectsFloat(parallelFloat, chain, numThreads)
+		if mismatches := parallelFloat.MismatchedPixels(sequentialFloat); mismatches > 0 {
+			return fmt.Errorf("%d threads, float32: %d pixels differ from the sequential result", numThreads,
+				mismatches)
+		}
+	}
+
+	//a strip ceiling only changes how many strips run at once
+	maxStrips := settings.effects.MaxStrips
+	defer func() { settings.effects.MaxStrips = maxStrips }()
+	settings.effects.MaxStrips = make(map[string]int)
+	for _, effect := range chain {
+		settings.effects.MaxStrips[effect] = 1
+	}
+	numThreads := selftestThreads[len(selftestThreads)-1]
+	parallel := png.FromImage(src)
+	processEffectsPipeline(parallel, chain, numThreads)
+	if mismatches := parallel.MismatchedPixels(sequential); mismatches > 0 {
+		return fmt.Errorf("%d threads, 1 strip at once: %d pixels differ from the sequential result", numThreads,
+			mismatches)
+	}
+	return nil
+}
+
+// Checks that out has the same bounds as src and, if the effect preserves alpha, the same alpha values
+func checkInvariants(src image.Image, out image.Image, effect engine.Effect) error {
+	if src.Bounds() != out.Bounds() {
+		return fmt.Errorf("bounds changed from %v to %v", src.Bounds(), out.Bounds())
+	}
+	if !effect.PreservesAlpha {
+		return nil
+	}
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, srcAlpha := src.At(x, y).RGBA()
+			_, _, _, outAlpha := out.At(x, y).RGBA()
+			if srcAlpha != outAlpha {
+				return fmt.Errorf("alpha at (%d, %d) changed from %d to %d", x, y, srcAlpha, outAlpha)
+			}
+		}
+	}
+	return nil
+}
+
+type selftestImage struct {
+	name string
+	img  image.Image
+}
+
+// Generates the images selftest runs effects on: smooth gradients, hard edges, noise with varying alpha and
+// images only a pixel wide or tall, at sizes that don't divide evenly between threads
+func selftestImages() []selftestImage {
+	gradient := image.NewRGBA64(image.Rect(0, 0, 97, 61))
+	checkerboard := image.NewRGBA64(image.Rect(0, 0, 128, 128))
+	noise := image.NewNRGBA64(image.Rect(0, 0, 75, 83))
+	tall := image.NewRGBA64(image.Rect(0, 0, 1, 50))
+	wide := image.NewRGBA64(image.Rect(0, 0, 50, 1))
+
+	random := rand.New(rand.NewSource(1))
+	for _, img := range []*image.RGBA64{gradient, tall, wide} {
+		bounds := img.Bounds()
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				img.SetRGBA64(x, y, color.RGBA64{
+					uint16(65535 * x / bounds.Dx()), uint16(65535 * y / bounds.Dy()), 32768, 65535})
+			}
+		}
+	}
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			v := uint16(0)
+			if (x/8+y/8)%2 == 0 {
+				v = 65535
+			}
+			checkerboard.SetRGBA64(x, y, color.RGBA64{v, v, v, 65535})
+		}
+	}
+	for y := 0; y < 83; y++ {
+		for x := 0; x < 75; x++ {
+			noise.SetNRGBA64(x, y, color.NRGBA64{
+				uint16(random.Intn(65536)), uint16(random.Intn(65536)),
+				uint16(random.Intn(65536)), uint16(random.Intn(65536))})
+		}
+	}
+
+	return []selftestImage{
+		{"gradient 97x61", gradient},
+		{"checkerboard 128x128", checkerboard},
+		{"noise with alpha 75x83", noise},
+		{"tall 1x50", tall},
+		{"wide 50x1", wide},
+	}
+}
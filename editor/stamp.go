@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"proj2/engine"
+	"proj2/png"
+	"sort"
+	"strings"
+	"time"
+)
+
+// With -stamp, writes the effect chain applied to pngImg, each effect's settings and the time the task took since
+// started into a corner of its output, so renders of different filter candidates can be told apart at a glance
+func stampSummary(pngImg *png.Image, effects []string, started time.Time) {
+	if !settings.stamp {
+		return
+	}
+	chain := engine.DescribeChain(effects, &settings.effects, givenFlag)
+	var lines []string
+	for _, step := range chain.Effects {
+		lines = append(lines, describeStep(step))
+	}
+	lines = append(lines, fmt.Sprintf("engine %s, %v", chain.Engine, since(started).Round(time.Millisecond)))
+	pngImg.Stamp(lines)
+}
+
+// Describes an effect applied on one line: its code, or an effect object's type, followed by its settings as
+// name=value sorted by name
+func describeStep(step engine.ChainStep) string {
+	line := step.Code
+	if strings.HasPrefix(step.Code, "{") {
+		line = step.Name //an effect object's code is its JSON, too long for a line
+	}
+	names := make([]string, 0, len(step.Params))
+	for name := range step.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += fmt.Sprintf(" %s=%v", name, step.Params[name])
+	}
+	return line
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"proj2/engine"
+	"strings"
+)
+
+// The streams of tasks given with -tasks, in order, "-" standing for Stdin
+type taskStreams []string
+
+func (s *taskStreams) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *taskStreams) Set(path string) error {
+	*s = append(*s, path)
+	return nil
+}
+
+// Opens every stream of -tasks, which can be files, FIFOs such as those of shell process substitution, or "-" for
+// Stdin, and returns a TaskSource merging their tasks as they arrive. Without any, tasks are read from Stdin. Each
+// stream is decoded on its own, in any of the task formats, and a shutdown message only stops reading its own
+// stream
+func openTaskStreams(paths taskStreams) (engine.TaskSource, error) {
+	if len(paths) == 0 {
+		if taskRoot.path != "" {
+			warnStdinNotPiped()
+		}
+		return NewTaskDecoder(os.Stdin), nil
+	}
+	var sources []engine.TaskSource
+	stdin := false
+	for _, path := range paths {
+		if path == "-" {
+			if stdin {
+				return nil, errors.New("invalid -tasks: Stdin (-) can only be read once")
+			}
+			stdin = true
+			if taskRoot.path != "" {
+				warnStdinNotPiped()
+			}
+			sources = append(sources, NewTaskDecoder(os.Stdin))
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, NewTaskDecoder(f))
+	}
+	return engine.MergeSources(sources...), nil
+}
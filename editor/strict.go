@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reports a problem with task t that leaves its output other than asked for, such as an effect it skipped, as a
+// WARNING printing args. With -strict it is an ERROR instead and the task fails, and is recorded like any other
+// failed task. Returns true if the task must fail, which it never does without -strict
+func taskWarning(t ImageTask, args ...interface{}) bool {
+	if !settings.strict {
+		fmt.Println(append([]interface{}{"WARNING:"}, args...)...)
+		return false
+	}
+	fmt.Println(append(append([]interface{}{"ERROR:"}, args...), "(task failed, -strict)")...)
+	recordFailure(t, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+	return true
+}
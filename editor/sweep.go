@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"proj2/engine"
+	"proj2/imageio"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Runs "editor sweep -effect [code or name] -param [name]=[start]:[end]:[step] [in.png] [outdir]". Renders the
+// effect once per value of the parameter, in parallel, and saves each result in outdir named after the input file,
+// the parameter and its value, so the renders can be compared side by side to pick a setting for a batch. Other
+// settings keep their defaults
+func runSweep(args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	effectName := fs.String("effect", "", "code or name of the effect to render, as listed by editor effects")
+	paramRange := fs.String("param", "", "the setting to sweep and its values, as name=start:end:step")
+	numThreads := fs.Int("p", runtime.NumCPU(), "number of values rendered at once")
+	paths := parseInterspersed(fs, args)
+	if len(paths) != 2 || *effectName == "" || *paramRange == "" || *numThreads < 1 {
+		fmt.Println("Usage: editor sweep -effect=[code or name] -param=[name]=[start]:[end]:[step] [in.png] [outdir] [-p=[renders]]")
+		os.Exit(2)
+	}
+
+	effect, ok := findEffect(*effectName)
+	if !ok {
+		fmt.Println("Effect", *effectName, "not recognized, see editor effects")
+		os.Exit(2)
+	}
+	param, values, err := parseSweep(effect, *paramRange)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	//check every value up front rather than after some of the renders were saved
+	for _, value := range values {
+		s := engine.DefaultSettings()
+		if err := param.Set(&s, value); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	src, err := decodeFile(paths[0])
+	if err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(paths[1], 0755); err != nil {
+		panic(err)
+	}
+	base := strings.TrimSuffix(filepath.Base(paths[0]), filepath.Ext(paths[0]))
+
+	nextValue := make(chan float64)
+	var wg sync.WaitGroup
+	for i := 0; i < *numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for value := range nextValue {
+				outPath := filepath.Join(paths[1], fmt.Sprintf("%s_%s_%g.png", base, param.Name, value))
+				renderSweepValue(src, effect, param, value, outPath)
+				fmt.Println(outPath)
+			}
+		}()
+	}
+	for _, value := range values {
+		nextValue <- value
+	}
+	close(nextValue)
+	wg.Wait()
+}
+
+// Applies effect with param set to value on a single thread, since renders already run in parallel, and saves it
+func renderSweepValue(src image.Image, effect engine.Effect, param engine.Param, value float64, outPath string) {
+	s := engine.DefaultSettings()
+	param.Set(&s, value)
+	out, err := engine.Process(src, []string{effect.Code}, 1, s)
+	if err != nil {
+		panic(err)
+	}
+	if err := imageio.Save(outPath, out, outputOptions([]string{effect.Code}, &s, false)); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the effect whose code or name is name
+func findEffect(name string) (engine.Effect, bool) {
+	for _, effect := range engine.Effects {
+		if effect.Code == name || effect.Name == name {
+			return effect, true
+		}
+	}
+	return engine.Effect{}, false
+}
+
+// Parses name=start:end:step into one of effect's number settings and the values from start to end
+func parseSweep(effect engine.Effect, s string) (engine.Param, []float64, error) {
+	var start, end, step float64
+	eq := strings.LastIndex(s, "=")
+	if eq < 0 {
+		return engine.Param{}, nil, fmt.Errorf("invalid sweep %q, expected name=start:end:step", s)
+	}
+	if _, err := fmt.Sscanf(s[eq+1:], "%g:%g:%g", &start, &end, &step); err != nil || step <= 0 || end < start {
+		return engine.Param{}, nil, fmt.Errorf("invalid sweep %q, expected name=start:end:step with step > 0", s)
+	}
+
+	name := s[:eq]
+	for _, param := range effect.Params {
+		if param.Name != name {
+			continue
+		}
+		if !param.Numeric() {
+			return engine.Param{}, nil, fmt.Errorf("%s is not a number setting, so it can't be swept", name)
+		}
+		//computing each value from start instead of adding step repeatedly keeps rounding errors from adding up,
+		//and rounding to 10 digits keeps 0.1+6*0.1 from being named 0.7000000000000001
+		var values []float64
+		for i := 0; ; i++ {
+			value := start + float64(i)*step
+			if value > end+step*1e-9 {
+				break
+			}
+			value, _ = strconv.ParseFloat(strconv.FormatFloat(math.Min(value, end), 'g', 10, 64), 64)
+			values = append(values, value)
+		}
+		return param, values, nil
+	}
+	return engine.Param{}, nil, fmt.Errorf("%s is not a setting of %s, see editor effects", name, effect.Name)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CPU time the whole machine and the editor itself have used since boot, in seconds
+type cpuSample struct {
+	busy  float64 // time every CPU spent running anything, the editor included
+	steal float64 // time the hypervisor gave the machine's virtual CPUs to other guests
+	own   float64 // time the editor's threads spent running
+}
+
+// Parses -adapt-threads, written as [min]:[max] with 1 <= min <= max
+func parseThreadBounds(s string) (int, int, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) == 2 {
+		min, minErr := strconv.Atoi(fields[0])
+		max, maxErr := strconv.Atoi(fields[1])
+		if minErr == nil && maxErr == nil && min >= 1 && min <= max {
+			return min, max, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid -adapt-threads %q, expected [min]:[max] with 1 <= min <= max", s)
+}
+
+// Every interval, measures how many CPUs other processes kept busy and how much time the hypervisor stole since the
+// last measurement, and sets the number of threads to the CPUs left over, kept between min and max. Runs until the
+// editor exits
+func adaptThreads(min int, max int, interval time.Duration) {
+	prev, err := readCPUSample()
+	if err != nil {
+		fmt.Println("WARNING: -adapt-threads has no effect:", err)
+		return
+	}
+	prevAt := clock.Now()
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		next, err := readCPUSample()
+		if err != nil {
+			continue
+		}
+		elapsed := since(prevAt).Seconds()
+		prevAt = clock.Now()
+		others := math.Max((next.busy-prev.busy)-(next.own-prev.own), 0) / elapsed
+		stolen := math.Max(next.steal-prev.steal, 0) / elapsed
+		prev = next
+
+		threads := int(float64(runtime.NumCPU()) - others - stolen)
+		if threads < min {
+			threads = min
+		} else if threads > max {
+			threads = max
+		}
+		if current := currentThreads(); threads != current {
+			if settings.verbose {
+				fmt.Printf("Threads changed from %d to %d: other processes kept %.1f CPUs busy, %.1f were stolen\n",
+					current, threads, others, stolen)
+			}
+			setThreads(threads)
+		}
+	}
+}
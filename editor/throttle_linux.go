@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Clock ticks per second of the times in /proc/stat. The kernel reports them in USER_HZ, which is 100 on every
+// architecture Go runs on
+const userHZ = 100
+
+// Reads the machine's CPU times from the first line of /proc/stat and the editor's from getrusage
+func readCPUSample() (cpuSample, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return cpuSample{}, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return cpuSample{}, fmt.Errorf("/proc/stat is empty")
+	}
+	//cpu user nice system idle iowait irq softirq steal ...
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 9 || fields[0] != "cpu" {
+		return cpuSample{}, fmt.Errorf("unexpected first line of /proc/stat: %q", scanner.Text())
+	}
+	var ticks [8]float64
+	for i := range ticks {
+		if ticks[i], err = strconv.ParseFloat(fields[i+1], 64); err != nil {
+			return cpuSample{}, fmt.Errorf("unexpected first line of /proc/stat: %q", scanner.Text())
+		}
+	}
+	user, nice, system, irq, softirq, steal := ticks[0], ticks[1], ticks[2], ticks[5], ticks[6], ticks[7]
+	sample := cpuSample{busy: (user + nice + system + irq + softirq) / userHZ, steal: steal / userHZ}
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return cpuSample{}, err
+	}
+	sample.own = float64(usage.Utime.Nano()+usage.Stime.Nano()) / 1e9
+	return sample, nil
+}
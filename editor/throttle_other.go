@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// The load of other processes is only read on Linux
+func readCPUSample() (cpuSample, error) {
+	return cpuSample{}, errors.New("measuring the load of other processes is only supported on Linux")
+}
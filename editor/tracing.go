@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"proj2/png"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans queued for the exporter before new ones are dropped, so a slow collector never holds up the tasks
+const spanQueueSize = 4096
+
+// Most spans sent to the collector in one request
+const spanBatchSize = 256
+
+// How often the exporter sends the spans queued so far, even if there aren't a batch of them
+const spanExportInterval = 5 * time.Second
+
+// One timed step of the run, exported to an OpenTelemetry collector with -otlp-endpoint. The run has a span, each
+// task a span under it, and decoding, each effect and encoding each a span under their task's. A nil span, which is
+// what every task gets without -otlp-endpoint, records nothing
+type span struct {
+	traceID    [16]byte
+	id         [8]byte
+	parentID   [8]byte // all zero for a span without a parent
+	name       string
+	start      time.Time
+	attributes map[string]string
+}
+
+// A span as encoded in the JSON flavor of OTLP, the OpenTelemetry protocol
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+const otlpSpanKindInternal = 1
+
+var tracer struct {
+	url     string // where batches of spans are posted
+	run     *span
+	queue   chan otlpSpan
+	done    chan bool // receives once the exporter has sent every span queued before the queue was closed
+	dropped int64     // spans dropped because the queue was full, read once the exporter is done
+	mu      sync.Mutex
+	failed  sync.Once
+}
+
+// Spans of the tasks working on each image, keyed by the image like the watchdog's progress, since that is what
+// the effect code has at hand
+var traced sync.Map
+
+// Starts the span of the run and the exporter sending spans to the OTLP/HTTP collector at endpoint, such as
+// http://localhost:4318. If the TRACEPARENT environment variable holds a W3C trace context, as set by a calling
+// service, the run's span joins that trace under the caller's span
+func startTracing(endpoint string) {
+	tracer.url = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	tracer.queue = make(chan otlpSpan, spanQueueSize)
+	tracer.done = make(chan bool)
+	tracer.run = &span{name: "editor run", start: clock.Now(),
+		attributes: map[string]string{"editor.args": strings.Join(os.Args[1:], " ")}}
+	if !parseTraceparent(os.Getenv("TRACEPARENT"), tracer.run) {
+		randomID(tracer.run.traceID[:])
+	}
+	randomID(tracer.run.id[:])
+	go exportSpans(tracer.queue, tracer.done)
+}
+
+// Finishes the run's span and waits for the exporter to send every span
+func stopTracing() {
+	tracer.run.finish()
+	close(tracer.queue)
+	<-tracer.done
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if tracer.dropped > 0 {
+		fmt.Println("WARNING:", tracer.dropped, "spans were dropped because the collector couldn't keep up")
+	}
+}
+
+// Reads the trace and parent span IDs of a W3C traceparent header, version-traceid-parentid-flags, into s.
+// Returns false if value isn't one
+func parseTraceparent(value string, s *span) bool {
+	fields := strings.Split(strings.TrimSpace(value), "-")
+	if len(fields) != 4 || len(fields[1]) != 32 || len(fields[2]) != 16 {
+		return false
+	}
+	if _, err := hex.Decode(s.traceID[:], []byte(fields[1])); err != nil {
+		return false
+	}
+	if _, err := hex.Decode(s.parentID[:], []byte(fields[2])); err != nil {
+		return false
+	}
+	return s.traceID != [16]byte{} && s.parentID != [8]byte{}
+}
+
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+}
+
+// Starts the span of t under the run's, or returns nil without -otlp-endpoint
+func startTaskSpan(t ImageTask) *span {
+	if tracer.run == nil {
+		return nil
+	}
+	return tracer.run.child("task").set("editor.in_path", t.InPath).set("editor.out_path", t.OutPath).
+		set("editor.effects", strings.Join(t.Effects, ","))
+}
+
+// Starts a span named name under s. Returns nil if s is nil
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+	c := &span{traceID: s.traceID, parentID: s.id, name: name, start: clock.Now(), attributes: make(map[string]string)}
+	randomID(c.id[:])
+	return c
+}
+
+// Records an attribute of s and returns s. Does nothing if s is nil
+func (s *span) set(key string, value string) *span {
+	if s != nil {
+		s.attributes[key] = value
+	}
+	return s
+}
+
+// Ends s now and queues it for export. Does nothing if s is nil
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	encoded := otlpSpan{TraceID: hex.EncodeToString(s.traceID[:]), SpanID: hex.EncodeToString(s.id[:]),
+		Name: s.name, Kind: otlpSpanKindInternal, StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano: strconv.FormatInt(clock.Now().UnixNano(), 10)}
+	if s.parentID != [8]byte{} {
+		encoded.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for key, value := range s.attributes {
+		attribute := otlpAttribute{Key: key}
+		attribute.Value.StringValue = value
+		encoded.Attributes = append(encoded.Attributes, attribute)
+	}
+	select {
+	case tracer.queue <- encoded:
+	default:
+		tracer.mu.Lock()
+		tracer.dropped++
+		tracer.mu.Unlock()
+	}
+}
+
+// Returns the span of the task working on pngImg, nil if it isn't traced
+func taskSpan(pngImg *png.Image) *span {
+	if s, ok := traced.Load(pngImg); ok {
+		return s.(*span)
+	}
+	return nil
+}
+
+// Sends the spans from queue to the collector in batches until queue is closed
+func exportSpans(queue <-chan otlpSpan, done chan<- bool) {
+	ticker := clock.NewTicker(spanExportInterval)
+	defer ticker.Stop()
+	var batch []otlpSpan
+	for {
+		select {
+		case s, ok := <-queue:
+			if !ok {
+				sendSpans(batch)
+				done <- true
+				return
+			}
+			if batch = append(batch, s); len(batch) == spanBatchSize {
+				sendSpans(batch)
+				batch = nil
+			}
+		case <-ticker.C():
+			sendSpans(batch)
+			batch = nil
+		}
+	}
+}
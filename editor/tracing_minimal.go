@@ -0,0 +1,10 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+// Builds with the minimal tag leave out exporting spans, and with it net/http, so -otlp-endpoint only prints a
+// WARNING
+const tracingSupported = false
+
+func sendSpans(spans []otlpSpan) {}
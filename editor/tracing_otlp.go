@@ -0,0 +1,50 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Builds with the minimal tag leave out exporting spans, and with it net/http
+const tracingSupported = true
+
+// Posts spans to the collector as one OTLP/HTTP JSON request. A failure is reported once and the spans are lost,
+// since tracing must never stop the run
+func sendSpans(spans []otlpSpan) {
+	if len(spans) == 0 {
+		return
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "editor"
+	}
+	var service otlpAttribute
+	service.Key = "service.name"
+	service.Value.StringValue = serviceName
+	request := map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource":   map[string]interface{}{"attributes": []otlpAttribute{service}},
+		"scopeSpans": []interface{}{map[string]interface{}{"scope": map[string]string{"name": "editor"}, "spans": spans}},
+	}}}
+	body, err := json.Marshal(request)
+	if err != nil {
+		panic(err)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(tracer.url, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("collector answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		tracer.failed.Do(func() { fmt.Println("WARNING: Can't export spans to", tracer.url+":", err) })
+	}
+}
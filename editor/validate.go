@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"proj2/engine"
+	"proj2/imageio"
+	"sync"
+)
+
+// A single line of the validation report, describing whether an input image decoded cleanly
+type ValidationResult struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Path          string `json:"path"`             // filepath of the image that was checked
+	Valid         bool   `json:"valid"`            // true if the image fully decoded without errors
+	Format        string `json:"format,omitempty"` // format name reported by the decoder, one of imageio.InputFormats
+	Width         int    `json:"width,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	BitDepth      int    `json:"bitDepth,omitempty"` // bits per channel read from the header
+	Error         string `json:"error,omitempty"`    // decode error (bad CRC, truncated data, unknown format...)
+}
+
+// Scans the inPath (or inPaths) of every task read from src and writes one JSON line per image to reportPath (Stdout if
+// empty) saying whether it decodes, without applying any effects. Images are checked by numThreads goroutines
+func processValidate(src engine.TaskSource, numThreads int, reportPath string) {
+	report := io.Writer(os.Stdout)
+	if reportPath != "" {
+		reportFile, err := os.Create(reportPath)
+		if err != nil {
+			panic(err)
+		}
+		defer reportFile.Close()
+		report = reportFile
+	}
+	if numThreads < 1 {
+		numThreads = 1
+	}
+
+	var paths []string
+	for _, t := range readTasks(src) {
+		paths = append(paths, taskInputs(t)...)
+	}
+	results := make([]ValidationResult, len(paths))
+	var wg sync.WaitGroup
+	nextPath := make(chan int)
+	for i := 0; i < numThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pathIndex := range nextPath {
+				results[pathIndex] = validateImage(paths[pathIndex])
+			}
+		}()
+	}
+	for i := range paths {
+		nextPath <- i
+	}
+	close(nextPath)
+	wg.Wait()
+
+	//results are written in input order so the report lines up with the task file
+	enc := json.NewEncoder(report)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Probes the header of the image at path, then fully decodes it with the decoder the editor loads inputs with, which
+// makes it verify chunk CRCs and catch truncated data, so an image is valid exactly when a task could read it.
+// Files with an unreadable header, or in a format the editor doesn't read, are reported without reading the rest
+func validateImage(path string) ValidationResult {
+	result := ValidationResult{SchemaVersion: validationSchemaVersion, Path: path}
+	info, err := imageio.Probe(path)
+	result.Format = info.Format
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.BitDepth = info.BitDepth
+
+	f, err := os.Open(path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer f.Close()
+
+	img, format, err := imageio.Decode(f)
+	result.Format = format
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Width = img.Bounds().Dx()
+	result.Height = img.Bounds().Dy()
+	if result.Width != info.Width || result.Height != info.Height {
+		result.Error = fmt.Sprintf("header says %dx%d but the image decoded to %dx%d", info.Width, info.Height,
+			result.Width, result.Height)
+		return result
+	}
+	result.Valid = true
+	return result
+}
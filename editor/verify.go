@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"proj2/engine"
+	"proj2/png"
+	"strings"
+)
+
+// Returns true if the current task should be double-checked against a sequential run, which happens for roughly
+// the -verify fraction of tasks
+func sampleForVerification() bool {
+	return settings.verifyFraction > 0 && rand.Float64() < settings.verifyFraction
+}
+
+// Reloads the task's input, applies the effects sequentially without image decomposition and counts the pixels
+// that differ from the parallel result. Mismatches are printed as a warning, and with -strict the task fails, in which
+// case it also returns true. A task whose input can't be loaded again fails with an ERROR
+func verifyAgainstSequential(t ImageTask, effects []string, parallelImg *png.Image) (int, bool) {
+	sequentialImg, err := loadTaskInput(t, 1)
+	if err != nil {
+		fmt.Println("ERROR: Task", strings.Join(taskInputs(t), "+"), "->", t.OutPath, "not verified:", err)
+		recordFailure(t, err.Error())
+		return 0, true
+	}
+	applyEffectsSequential(sequentialImg, effects)
+	engine.TakeFindings(sequentialImg) //the parallel result's findings are the ones recorded
+
+	mismatches := parallelImg.MismatchedPixels(sequentialImg)
+	if mismatches > 0 && taskWarning(t, "parallel result for", t.InPath, "differs from the sequential result in",
+		mismatches, "pixels") {
+		return mismatches, true
+	}
+	return mismatches, false
+}
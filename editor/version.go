@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"proj2/engine"
+	"proj2/imageio"
+	"runtime"
+	"strconv"
+)
+
+// What "editor version -json" writes, so programs submitting tasks can check what this build supports first
+type versionReport struct {
+	SchemaVersion      int                          `json:"schemaVersion"`
+	Engine             string                       `json:"engine"` // engine.Version, as recorded in outputs
+	Go                 string                       `json:"go"`
+	OS                 string                       `json:"os"`
+	Arch               string                       `json:"arch"`
+	InputFormats       []string                     `json:"inputFormats"`
+	OutputFormats      []string                     `json:"outputFormats"`
+	OutputCapabilities []imageio.FormatCapabilities `json:"outputCapabilities"` // what each output format holds
+	Effects            []effectReport               `json:"effects"`
+	EffectObjectTypes  []string                     `json:"effectObjectTypes"`
+	Features           map[string]bool              `json:"features"` // flags whose support depends on the build or platform
+	Concurrency        concurrency                  `json:"concurrency"`
+}
+
+type effectReport struct {
+	Code           string        `json:"code"`
+	Name           string        `json:"name"`
+	Kind           string        `json:"kind"`
+	Radius         int           `json:"radius,omitempty"`
+	PreservesAlpha bool          `json:"preservesAlpha"`
+	OrderDependent bool          `json:"orderDependent"`
+	MaxStrips      int           `json:"maxStrips"` // most strips of one image run at once, 0 for no limit
+	Params         []paramReport `json:"params"`
+}
+
+// A setting of an effect, described like a JSON schema property
+type paramReport struct {
+	Flag        string      `json:"flag"`
+	Type        string      `json:"type"` // "number", "integer" or "string"
+	Minimum     *float64    `json:"minimum,omitempty"`
+	Maximum     *float64    `json:"maximum,omitempty"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+}
+
+type concurrency struct {
+	CPUs        int    `json:"cpus"`
+	Threads     int    `json:"threads"`     // default of -p, 0 for the sequential version
+	WorkerDepth int    `json:"workerDepth"` // default of -k
+	Parallelism string `json:"parallelism"` // default of -parallelism
+	Prefetch    int    `json:"prefetch"`    // default of -prefetch
+}
+
+// Prints the engine version for "editor version", or with -json every format, effect and feature this build
+// supports. Like "editor effects", defaults and descriptions come from the flags
+func printVersion(asJSON bool) {
+	if !asJSON {
+		fmt.Printf("editor (engine %s, %s %s/%s)\n", engine.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	report := versionReport{SchemaVersion: versionSchemaVersion, Engine: engine.Version, Go: runtime.Version(),
+		OS: runtime.GOOS, Arch: runtime.GOARCH, InputFormats: imageio.InputFormats,
+		OutputFormats: imageio.OutputFormats, OutputCapabilities: imageio.OutputCapabilities, Effects: []effectReport{}, EffectObjectTypes: engine.EffectObjectTypes,
+		Features: map[string]bool{
+			"otlp-endpoint": tracingSupported,
+			"adapt-threads": runtime.GOOS == "linux",
+			"io-nice":       runtime.GOOS == "linux",
+		},
+		Concurrency: concurrency{CPUs: runtime.NumCPU(), Threads: defaultInt("p"), WorkerDepth: defaultInt("k"),
+			Parallelism: flag.Lookup("parallelism").DefValue, Prefetch: defaultInt("prefetch")}}
+	for _, effect := range engine.Effects {
+		e := effectReport{Code: effect.Code, Name: effect.Name, Kind: effect.Kind, Radius: effect.Radius,
+			PreservesAlpha: effect.PreservesAlpha, OrderDependent: effect.OrderDependent,
+			MaxStrips: engine.StripCeiling(effect.Code, &settings.effects), Params: []paramReport{}}
+		for _, param := range effect.Params {
+			f := flag.Lookup(param.Name)
+			p := paramReport{Flag: f.Name, Type: "string", Default: f.DefValue, Description: f.Usage}
+			if param.Numeric() {
+				min, max, whole := param.Limits()
+				p.Type = "number"
+				if whole {
+					p.Type = "integer"
+				}
+				p.Minimum = &min
+				if !math.IsInf(max, 1) {
+					p.Maximum = &max
+				}
+				if value, err := strconv.ParseFloat(f.DefValue, 64); err == nil {
+					p.Default = value
+				}
+			}
+			e.Params = append(e.Params, p)
+		}
+		report.Effects = append(report.Effects, e)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the default of the int flag name
+func defaultInt(name string) int {
+	value, err := strconv.Atoi(flag.Lookup(name).DefValue)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"proj2/png"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time of the last progress (in Unix nanoseconds) of every task attempt the watchdog is watching, keyed by the
+// attempt's working image, since that is what the effect code has at hand when a strip finishes
+var watched sync.Map
+
+// Records that a strip of an effect on pngImg was just finished. Does nothing if pngImg isn't being watched
+func markProgress(pngImg *png.Image) {
+	if last, ok := watched.Load(pngImg); ok {
+		atomic.StoreInt64(last.(*int64), clock.Now().UnixNano())
+	}
+}
+
+// Loads t's input image, or takes it from the prefetcher, and runs process on it. With -watchdog, an attempt that
+// finishes no strip for that long is reported along with a dump of every goroutine, then, with -watchdog-retries,
+// abandoned and started over on a freshly loaded image. Goroutines can't be killed, so an abandoned attempt keeps
+// running in the background, but its result is never used. Returns the processed image, or nil if every attempt
+// got stuck or its input couldn't be loaded, as when its inPaths have different sizes, which fails the task with an
+// ERROR
+func runWatched(t ImageTask, process func(pngImg *png.Image)) *png.Image {
+	for attempt := 0; ; attempt++ {
+		var pngImg *png.Image
+		var err error
+		if attempt == 0 && t.prefetch != nil {
+			pngImg, err = t.prefetch.take()
+		} else {
+			pngImg, err = loadTaskInput(t, currentThreads())
+		}
+		if err != nil {
+			fmt.Println("ERROR: Task", strings.Join(taskInputs(t), "+"), "->", t.OutPath, "skipped:", err)
+			recordFailure(t, err.Error())
+			return nil
+		}
+		if t.trace != nil {
+			traced.Store(pngImg, t.trace)
+			defer traced.Delete(pngImg)
+		}
+		if t.row != nil {
+			shown.Store(pngImg, t.row)
+			defer shown.Delete(pngImg)
+		}
+		if t.cancel != nil {
+			cancelling.Store(pngImg, t.cancel)
+			defer cancelling.Delete(pngImg)
+		}
+		if settings.watchdog == 0 {
+			process(pngImg)
+			return pngImg
+		}
+
+		last := new(int64)
+		*last = clock.Now().UnixNano()
+		watched.Store(pngImg, last)
+		done := make(chan bool, 1)
+		go func() {
+			process(pngImg)
+			done <- true
+		}()
+		stuck := waitForAttempt(done, last)
+		watched.Delete(pngImg)
+		if !stuck {
+			return pngImg
+		}
+
+		fmt.Printf("WARNING: Task %s made no progress for %v (attempt %d)\n", t.InPath, settings.watchdog, attempt+1)
+		dumpGoroutines()
+		if settings.watchdogRetries == 0 {
+			<-done
+			return pngImg
+		}
+		if attempt == settings.watchdogRetries {
+			fmt.Println("WARNING: Task", t.InPath, "skipped after", attempt+1, "stuck attempts")
+			recordFailure(t, fmt.Sprint("stuck after ", attempt+1, " attempts"))
+			return nil
+		}
+	}
+}
+
+// Waits until done receives or the time since last is longer than -watchdog. Returns true in the second case
+func waitForAttempt(done chan bool, last *int64) bool {
+	ticker := clock.NewTicker(settings.watchdog / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return false
+		case <-ticker.C():
+			if since(time.Unix(0, atomic.LoadInt64(last))) > settings.watchdog {
+				return true
+			}
+		}
+	}
+}
+
+// Writes the stack of every goroutine to Stderr. Go can't capture a single goroutine other than the caller's, so
+// the stuck task's strips have to be picked out of the full dump
+func dumpGoroutines() {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	os.Stderr.Write(buf)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Runs waitForAttempt on a fake clock, advancing it by step until waitForAttempt returns or limit has passed, and
+// returns what it returned and how far the clock was advanced. progress, if not nil, is called after each step
+func runWaitForAttempt(t *testing.T, done chan bool, step time.Duration, limit time.Duration,
+	progress func(last *int64)) (bool, time.Duration) {
+	defer func(c Clock, watchdog time.Duration) { clock, settings.watchdog = c, watchdog }(clock, settings.watchdog)
+	fake := newFakeClock(time.Unix(0, 0))
+	clock = fake
+	settings.watchdog = time.Second
+
+	last := new(int64)
+	*last = fake.Now().UnixNano()
+	result := make(chan bool, 1)
+	go func() { result <- waitForAttempt(done, last) }()
+	for advanced := time.Duration(0); advanced <= limit; {
+		select {
+		case stuck := <-result:
+			return stuck, advanced
+		case <-time.After(10 * time.Millisecond):
+		}
+		fake.Advance(step)
+		advanced += step
+		if progress != nil {
+			progress(last)
+		}
+	}
+	t.Fatalf("waitForAttempt hadn't returned after %v", limit)
+	return false, 0
+}
+
+func TestWaitForAttemptTimesOut(t *testing.T) {
+	stuck, advanced := runWaitForAttempt(t, make(chan bool), 250*time.Millisecond, time.Minute, nil)
+	if !stuck {
+		t.Fatal("an attempt that made no progress wasn't reported as stuck")
+	}
+	if advanced <= time.Second {
+		t.Fatalf("an attempt was reported as stuck after %v, before the 1s watchdog ran out", advanced)
+	}
+}
+
+func TestWaitForAttemptProgress(t *testing.T) {
+	done := make(chan bool, 1)
+	steps := 0
+	stuck, _ := runWaitForAttempt(t, done, 500*time.Millisecond, time.Minute, func(last *int64) {
+		//a strip finishes every step, for 20 steps, then the attempt finishes
+		atomic.StoreInt64(last, clock.Now().UnixNano())
+		if steps++; steps == 20 {
+			done <- true
+		}
+	})
+	if stuck {
+		t.Fatal("an attempt that kept finishing strips was reported as stuck")
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+// Version identifies the engine in recorded effect chains. It is bumped whenever an effect gives different output
+// for the same input and settings, so an output can be tied to the code that made it
+const Version = "1"
+
+// Chain records the effects applied to an image and their settings, so the output can be reproduced later
+type Chain struct {
+	Engine  string      `json:"engine"` // Version of the engine that applied the effects
+	Effects []ChainStep `json:"effects"`
+}
+
+// ChainStep is one effect of a Chain, with the settings it was applied with
+type ChainStep struct {
+	Code   string                 `json:"code"`
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params,omitempty"` // number settings as numbers, the rest as given
+}
+
+// DescribeChain returns the chain of effects applied with the settings in s. Settings that aren't numbers, which s
+// only holds in decoded form (a loaded image, a parsed color), are taken from given by name and left out if it
+// returns ""
+func DescribeChain(effects []string, s *Settings, given func(name string) string) Chain {
+	chain := Chain{Engine: Version, Effects: []ChainStep{}}
+	for _, code := range effects {
+		effect, ok := Lookup(code)
+		if !ok {
+			continue
+		}
+		step := ChainStep{Code: effect.Code, Name: effect.Name}
+		for _, param := range effect.Params {
+			var value interface{}
+			if number, ok := param.Value(s); ok {
+				value = number
+			} else if text := given(param.Name); text != "" {
+				value = text
+			} else {
+				continue
+			}
+			if step.Params == nil {
+				step.Params = make(map[string]interface{})
+			}
+			step.Params[param.Name] = value
+		}
+		chain.Effects = append(chain.Effects, step)
+	}
+	return chain
+}
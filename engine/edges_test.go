@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"proj2/png"
+	"testing"
+)
+
+// Sizes of the images the edge modes are tested on: a single column, a single row, and an image smaller than the
+// reach of the larger kernels that is no multiple of any strip count
+var edgeTestSizes = []image.Rectangle{image.Rect(0, 0, 1, 17), image.Rect(0, 0, 17, 1), image.Rect(0, 0, 13, 5)}
+
+var edgeTestModes = map[string]png.EdgeMode{"zero": png.EdgeZero, "wrap-x": png.EdgeWrapX, "extend": png.EdgeExtend}
+
+// Kernel effects the edge modes apply to, and whether their kernels sum to 1, so that with the extend edge mode they
+// must leave an image of a single color as it is
+var edgeTestEffects = []struct {
+	code    string
+	sumsTo1 bool
+}{
+	{"S", true},
+	{"E", false},
+	{"B", true},
+	{"T", false},
+	{`{"type":"convolve","kernel":[[1,1,1,1,1],[1,2,2,2,1],[1,2,4,2,1],[1,2,2,2,1],[1,1,1,1,1]],"normalize":true}`, true},
+	{`{"type":"blur","radius":7}`, true},
+}
+
+// Returns a png.Image of the given bounds whose pixels are color c, or a fixed pseudo-random pattern if c is nil
+func edgeTestImage(bounds image.Rectangle, c color.Color) *png.Image {
+	in := image.NewRGBA64(bounds)
+	seed := uint32(7)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c != nil {
+				in.Set(x, y, c)
+				continue
+			}
+			seed = seed*1664525 + 1013904223
+			v := uint16(seed >> 16)
+			in.SetRGBA64(x, y, color.RGBA64{v, v ^ 0x5a5a, v >> 1, 0xffff})
+		}
+	}
+	return png.NewImg(in)
+}
+
+// Returns the effect code of an effect code or effect object
+func edgeTestCode(t *testing.T, code string) string {
+	if code[0] != '{' {
+		return code
+	}
+	parsed, err := ParseEffectObject([]byte(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// Applies code to the whole of an image sequentially, then decomposed at several thread counts, with and without a
+// pool, and checks every run gives the same pixels in every edge mode
+func TestEdgeModesDecomposed(t *testing.T) {
+	defer func(edges png.EdgeMode) { png.Edges = edges }(png.Edges)
+	pool := NewPool(2)
+	defer pool.Resize(0)
+	for name, mode := range edgeTestModes {
+		png.Edges = mode
+		for _, bounds := range edgeTestSizes {
+			for _, effect := range edgeTestEffects {
+				code := edgeTestCode(t, effect.code)
+				want := edgeTestImage(bounds, nil)
+				if err := Apply(want, code, &Settings{}); err != nil {
+					t.Fatal(err)
+				}
+				for _, threads := range []int{1, 2, 4, 8} {
+					for _, p := range []*Pool{nil, pool} {
+						got := edgeTestImage(bounds, nil)
+						if err := Decompose(got, code, threads, &Settings{Pool: p}); err != nil {
+							t.Fatal(err)
+						}
+						if at, ok := samePixels(want.Output(), got.Output()); !ok {
+							t.Errorf("%s on %dx%d, edge mode %s, %d threads: pixel %v differs from the sequential run",
+								effect.code, bounds.Dx(), bounds.Dy(), name, threads, at)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Checks the kernels summing to 1 leave an image of a single color as it is with the extend edge mode, sequentially
+// and decomposed
+func TestEdgeExtendKeepsUniformImages(t *testing.T) {
+	defer func(edges png.EdgeMode) { png.Edges = edges }(png.Edges)
+	png.Edges = png.EdgeExtend
+	c := color.RGBA64{0x8000, 0x4000, 0xc000, 0xffff}
+	for _, bounds := range append(edgeTestSizes, image.Rect(0, 0, 1, 1)) {
+		for _, effect := range edgeTestEffects {
+			if !effect.sumsTo1 {
+				continue
+			}
+			code := edgeTestCode(t, effect.code)
+			for _, threads := range []int{0, 4} {
+				img := edgeTestImage(bounds, c)
+				var err error
+				if threads == 0 {
+					err = Apply(img, code, &Settings{})
+				} else {
+					err = Decompose(img, code, threads, &Settings{})
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if at, ok := samePixels(edgeTestImage(bounds, c).Input(), img.Output()); !ok {
+					t.Errorf("%s on a single color %dx%d, %d threads: pixel %v changed", effect.code, bounds.Dx(),
+						bounds.Dy(), threads, at)
+				}
+			}
+		}
+	}
+}
+
+// Returns whether a and b have the same bounds and pixels, and the first pixel where they don't
+func samePixels(a image.Image, b image.Image) (image.Point, bool) {
+	if a.Bounds() != b.Bounds() {
+		return a.Bounds().Min, false
+	}
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			if color.RGBA64Model.Convert(a.At(x, y)) != color.RGBA64Model.Convert(b.At(x, y)) {
+				return image.Pt(x, y), false
+			}
+		}
+	}
+	return image.Point{}, true
+}
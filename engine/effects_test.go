@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"proj2/png"
+	"testing"
+)
+
+// Bounds of the image the effects are benchmarked on, a few strips tall and no multiple of a block or strip size
+var benchmarkBounds = image.Rect(0, 0, 509, 307)
+
+// Benchmarks every effect of Effects on a whole image with the default settings, so changes to an effect's loops can
+// be compared with go test -bench Effects/<code>. The calibration effects get frames of their own to work with
+func BenchmarkEffects(b *testing.B) {
+	s := DefaultSettings()
+	s.CurveRGB = []png.CurvePoint{{In: 0, Out: 0}, {In: 128, Out: 160}, {In: 255, Out: 255}}
+	s.DarkFrame = edgeTestImage(benchmarkBounds, color.RGBA64{0x0800, 0x0800, 0x0800, 0xffff}).Input()
+	s.FlatField = png.NewFlatField(edgeTestImage(benchmarkBounds, color.RGBA64{0xc000, 0xc000, 0xc000, 0xffff}).Input())
+	for _, effect := range Effects {
+		effect := effect
+		b.Run(effect.Code, func(b *testing.B) {
+			img := edgeTestImage(benchmarkBounds, nil)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				effect.apply(img, &s)
+			}
+		})
+	}
+}
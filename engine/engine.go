@@ -0,0 +1,122 @@
+// Package engine applies chains of effects to images held in memory, splitting each effect across goroutines the
+// same way the editor does, without reading or writing any files. Programs embedding it can feed it tasks from any
+// TaskSource with RunTasks, or Compile a chain once to apply it to many images.
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg" // so ProcessBytes can decode jpeg input as well as png
+	"proj2/imageio"
+	"proj2/png"
+)
+
+// Process applies effects in order to src, decomposing each one across numThreads goroutines, and returns the
+// result. src itself is not modified. Analysis effects change nothing and what they find is discarded. Programs
+// applying the same chain to many images can Compile it once instead
+func Process(src image.Image, effects []string, numThreads int, s Settings) (image.Image, error) {
+	specs := make([]EffectSpec, len(effects))
+	for i, code := range effects {
+		specs[i] = EffectSpec{Code: code}
+	}
+	p, err := Compile(specs)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply(src, numThreads, s)
+}
+
+// ProcessBytes decodes an encoded image (png or jpeg) and processes it like Process. Images over
+// imageio.DecodeLimits are refused before their pixels are decoded
+func ProcessBytes(data []byte, effects []string, numThreads int, s Settings) (image.Image, error) {
+	src, _, err := imageio.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return Process(src, effects, numThreads, s)
+}
+
+// Apply applies a single effect to the whole of pngImg on the calling goroutine
+func Apply(pngImg *png.Image, code string, s *Settings) error {
+	effect, ok := Lookup(code)
+	if !ok {
+		return fmt.Errorf("effect %q not recognized", code)
+	}
+	effect.apply(pngImg, s)
+	return nil
+}
+
+// Decompose applies an effect to StripCount horizontally sliced subimages of pngImg in parallel, on s.Pool or,
+// without one, a goroutine per subimage. Images much wider than tall are sliced vertically instead, so thin strips
+// don't spend most of their work on the rows padding them. Strips are never thinner than the rows their kernel pads
+// them with, so a kernel reaching across most of the image is applied to it in one piece. Effects that depend on
+// statistics of the whole image, and order dependent effects when s.Deterministic is set, are applied whole too
+func Decompose(pngImg *png.Image, code string, numThreads int, s *Settings) error {
+	return DecomposeProgress(pngImg, code, numThreads, s, nil)
+}
+
+// DecomposeProgress is Decompose, calling stripDone (if not nil) from each goroutine as soon as its subimage is
+// finished, so callers can tell a slow effect from a stuck one. Built with the stripcheck tag, it checks the
+// subimages with a StripLedger once they are all finished
+func DecomposeProgress(pngImg *png.Image, code string, numThreads int, s *Settings, stripDone func()) error {
+	effect, ok := Lookup(code)
+	if !ok {
+		return fmt.Errorf("effect %q not recognized", code)
+	}
+	decompose(pngImg, effect, numThreads, s, stripDone)
+	return nil
+}
+
+// Applies effect to pngImg like DecomposeProgress, for an effect already looked up
+func decompose(pngImg *png.Image, effect Effect, numThreads int, s *Settings, stripDone func()) {
+	if effect.Kind == Global || (effect.OrderDependent && s.Deterministic) {
+		effect.apply(pngImg, s)
+		if stripDone != nil {
+			stripDone()
+		}
+		return
+	}
+
+	bounds := pngImg.Output().Bounds()
+	numStrips := StripCount(bounds.Dx(), pngImg.GetHeight(), numThreads, s)
+	if acrossColumns(bounds.Dx(), bounds.Dy(), numStrips, stripPadding(effect), s) {
+		decomposeColumns(pngImg, effect, haloStrips(numStrips, bounds.Dx(), stripPadding(effect)), s, stripDone)
+		return
+	}
+	if numStrips = haloStrips(numStrips, bounds.Dy(), stripPadding(effect)); numStrips == 1 {
+		effect.apply(pngImg, s)
+		if stripDone != nil {
+			stripDone()
+		}
+		return
+	}
+	ceils := stripCeils(pngImg, numStrips, s.ComplexityStrips)
+	ledger := NewStripLedger(effect.Code, bounds.Min.Y, bounds.Max.Y)
+	strips := make([]func(), numStrips)
+	for sectionIndex := range strips {
+		floor := float64(0)
+		if sectionIndex > 0 {
+			floor = ceils[sectionIndex-1] + 1
+		}
+		ceil := ceils[sectionIndex]
+		strips[sectionIndex] = func() { processPartialImg(pngImg, effect, s, floor, ceil, ledger, stripDone) }
+	}
+	s.Pool.RunAtMost(strips, stripCeiling(effect, s)) //returns once all subimages are complete
+	ledger.Verify(pngImg.OutputChecksum)
+}
+
+func processPartialImg(pngImg *png.Image, effect Effect, s *Settings, floor float64, ceil float64,
+	ledger *StripLedger, stripDone func()) {
+	//need buffers on floor and ceil so subimage can convolute on subimages' edges properly
+	padding := stripPadding(effect)
+	subImg := png.NewImg(pngImg.GetSubImg(int(floor)-padding, int(ceil)+padding))
+	effect.apply(subImg, s)
+	pngImg.UseSubsetImg(subImg, int(floor), int(ceil))
+	if ledger != nil {
+		ledger.Claim(int(floor), int(ceil)+1, subImg.OutputChecksum(int(floor), int(ceil)+1))
+	}
+	if stripDone != nil {
+		stripDone()
+	}
+}
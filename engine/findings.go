@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"proj2/png"
+	"sync"
+)
+
+// Findings holds what analysis effects found out about an image, which they report here instead of changing it
+type Findings struct {
+	Trim *TrimReport `json:"trim,omitempty"` // set by the trim report effect
+}
+
+// TrimReport is the rectangle an image's uniform borders would be trimmed to, from its top left corner. Width and
+// height are 0 if the whole image is uniform
+type TrimReport struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Findings of every image analysis effects have run on and that haven't been taken yet, by image
+var findings sync.Map
+
+// TakeFindings returns what analysis effects found out about pngImg and forgets it, so it must be called once
+// pngImg is done with, even if the findings aren't wanted
+func TakeFindings(pngImg *png.Image) Findings {
+	if f, ok := findings.LoadAndDelete(pngImg); ok {
+		return *f.(*Findings)
+	}
+	return Findings{}
+}
+
+// Records a finding about pngImg with record. Analysis effects are Global, so they never run on strips of one
+// image at the same time
+func recordFinding(pngImg *png.Image, record func(f *Findings)) {
+	f, _ := findings.LoadOrStore(pngImg, &Findings{})
+	record(f.(*Findings))
+}
+
+// Reports the rectangle pngImg's uniform borders would be trimmed to, leaving the image unchanged
+func reportTrim(pngImg *png.Image, s *Settings) {
+	rect := pngImg.TrimRect(s.TrimTolerance)
+	bounds := pngImg.Output().Bounds()
+	report := &TrimReport{}
+	if !rect.Empty() {
+		report = &TrimReport{X: rect.Min.X - bounds.Min.X, Y: rect.Min.Y - bounds.Min.Y, Width: rect.Dx(),
+			Height: rect.Dy()}
+	}
+	recordFinding(pngImg, func(f *Findings) { f.Trim = report })
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"image"
+	"math"
+	"proj2/png/kernel"
+)
+
+// Standard deviation, in pixels, of the Gaussian that spreads the sharpness of each pixel over its neighborhood.
+// Without it, flat parts of a sharp region could be taken from a blurry image with a little more noise
+const focusSmoothing = 2.0
+
+// StackFocus combines a series of images of the same scene focused at different distances into one image that is
+// in focus everywhere. The sharpness of each pixel is the magnitude of the Laplacian (the kernel of the edge detect
+// effect) of the grayscale image, smoothed with a Gaussian, and each pixel is taken from the image where it is
+// sharpest. The choices are blended through Laplacian pyramids the same way FuseExposures blends, so the borders
+// between regions taken from different images don't show. Steps are split into strips of rows run on s.Pool. The
+// images must have the same size and be aligned, and the result is opaque
+func StackFocus(images []image.Image, numThreads int, s *Settings) (image.Image, error) {
+	return mergeImages(images, numThreads, s, func(channels [][3]*plane, numThreads int) []*plane {
+		sharpness := make([]*plane, len(channels))
+		for k, rgb := range channels {
+			edges := convolvePlane(grayPlane(rgb, numThreads, s), kernel.Laplacian(), numThreads, s)
+			forRows(edges, numThreads, s, func(minY int, maxY int) {
+				for i := minY * edges.width; i < maxY*edges.width; i++ {
+					edges.pix[i] = float32(math.Abs(float64(edges.pix[i])))
+				}
+			})
+			sharpness[k] = convolvePlane(edges, kernel.Gaussian(focusSmoothing), numThreads, s)
+		}
+
+		//every pixel gets a weight of 1 in the sharpest image and 0 in the others
+		weights := make([]*plane, len(channels))
+		for k := range weights {
+			weights[k] = newPlane(sharpness[k].width, sharpness[k].height)
+		}
+		forRows(weights[0], numThreads, s, func(minY int, maxY int) {
+			for i := minY * weights[0].width; i < maxY*weights[0].width; i++ {
+				sharpest := 0
+				for k := range sharpness {
+					if sharpness[k].pix[i] > sharpness[sharpest].pix[i] {
+						sharpest = k
+					}
+				}
+				weights[sharpest].pix[i] = 1
+			}
+		})
+		return weights
+	})
+}
+
+// Returns p convolved with k, with pixels past the edges repeating the edge pixels
+func convolvePlane(p *plane, k kernel.Kernel, numThreads int, s *Settings) *plane {
+	out := newPlane(p.width, p.height)
+	radius := k.Radius()
+	forRows(out, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < p.width; x++ {
+				sum := float64(0)
+				for row := range k {
+					for col := range k[row] {
+						//flip the kernel both ways, same as png's Convolve
+						weight := k[k.Size()-1-row][k.Size()-1-col]
+						sum += weight * float64(p.at(clampInt(x+col-radius, 0, p.width-1),
+							clampInt(y+row-radius, 0, p.height-1)))
+					}
+				}
+				out.pix[y*p.width+x] = float32(sum)
+			}
+		}
+	})
+	return out
+}
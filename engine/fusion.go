@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Binomial filter used to build and collapse the pyramids of exposure fusion
+var pyramidKernel = [5]float32{1.0 / 16, 4.0 / 16, 6.0 / 16, 4.0 / 16, 1.0 / 16}
+
+// Smallest width or height of the coarsest pyramid level
+const minPyramidSize = 8
+
+// A single channel of an image, with values from 0 to 1
+type plane struct {
+	width, height int
+	pix           []float32
+}
+
+func newPlane(width int, height int) *plane {
+	return &plane{width: width, height: height, pix: make([]float32, width*height)}
+}
+
+func (p *plane) at(x int, y int) float32 {
+	return p.pix[y*p.width+x]
+}
+
+// FuseExposures merges bracketed exposures of the same scene into one well exposed image with Mertens exposure
+// fusion: each pixel of each exposure is weighted by its contrast, saturation and well-exposedness, and the
+// exposures are blended through Laplacian pyramids of the images and Gaussian pyramids of the weights, so the
+// seams between regions taken from different exposures don't show. Every step of every pyramid level is split
+// into strips of rows run on s.Pool, StripCount of them for numThreads. The exposures must have the same size,
+// and the result is opaque
+func FuseExposures(exposures []image.Image, numThreads int, s *Settings) (image.Image, error) {
+	return mergeImages(exposures, numThreads, s, func(channels [][3]*plane, numThreads int) []*plane {
+		weights := make([]*plane, len(channels))
+		for k, rgb := range channels {
+			weights[k] = fusionWeights(rgb, numThreads, s)
+		}
+		normalizeWeights(weights, numThreads, s)
+		return weights
+	})
+}
+
+// Blends images through Laplacian pyramids, weighting each pixel of each image by the Gaussian pyramid of its
+// weight from weigh, which must add up to 1 across the images at every pixel. weigh gets the red, green and blue
+// channels of every image and numThreads, at least 1
+func mergeImages(images []image.Image, numThreads int, s *Settings,
+	weigh func(channels [][3]*plane, numThreads int) []*plane) (image.Image, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to merge")
+	}
+	bounds := images[0].Bounds()
+	for i, img := range images {
+		if img.Bounds().Size() != bounds.Size() {
+			return nil, fmt.Errorf("image %d is %v, expected the %v of the first image", i+1, img.Bounds().Size(),
+				bounds.Size())
+		}
+	}
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	levels := 1
+	for size := minInt(bounds.Dx(), bounds.Dy()); size/2 >= minPyramidSize; size = (size + 1) / 2 {
+		levels++
+	}
+
+	channels := make([][3]*plane, len(images))
+	for k, img := range images {
+		channels[k] = splitChannels(img, numThreads, s)
+	}
+	weights := weigh(channels, numThreads)
+
+	//blend the Laplacian pyramid of every channel with the Gaussian pyramids of the weights, level by level
+	var blended [3][]*plane
+	weightPyramids := make([][]*plane, len(images))
+	for k := range images {
+		weightPyramids[k] = gaussianPyramid(weights[k], levels, numThreads, s)
+	}
+	for c := range blended {
+		blended[c] = make([]*plane, levels)
+		for k := range images {
+			laplacian := laplacianPyramid(channels[k][c], levels, numThreads, s)
+			for level := range laplacian {
+				if blended[c][level] == nil {
+					blended[c][level] = newPlane(laplacian[level].width, laplacian[level].height)
+				}
+				sum, band, weight := blended[c][level], laplacian[level], weightPyramids[k][level]
+				forRows(sum, numThreads, s, func(minY int, maxY int) {
+					for i := minY * sum.width; i < maxY*sum.width; i++ {
+						sum.pix[i] += weight.pix[i] * band.pix[i]
+					}
+				})
+			}
+		}
+	}
+
+	out := image.NewRGBA64(bounds)
+	var result [3]*plane
+	for c := range result {
+		result[c] = collapsePyramid(blended[c], numThreads, s)
+	}
+	forRows(result[0], numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				out.SetRGBA64(bounds.Min.X+x, bounds.Min.Y+y, color.RGBA64{
+					unitToUint16(result[0].at(x, y)), unitToUint16(result[1].at(x, y)),
+					unitToUint16(result[2].at(x, y)), 0xffff})
+			}
+		}
+	})
+	return out, nil
+}
+
+// Runs f on strips of p's rows [minY, maxY) in parallel
+func forRows(p *plane, numThreads int, s *Settings, f func(minY int, maxY int)) {
+	numStrips := StripCount(p.width, p.height, numThreads, s)
+	stripHeight := (p.height + numStrips - 1) / numStrips
+	var strips []func()
+	for minY := 0; minY < p.height; minY += stripHeight {
+		minY, maxY := minY, minInt(minY+stripHeight, p.height)
+		strips = append(strips, func() { f(minY, maxY) })
+	}
+	s.Pool.Run(strips)
+}
+
+// Returns the red, green and blue channels of img, unpremultiplied
+func splitChannels(img image.Image, numThreads int, s *Settings) [3]*plane {
+	bounds := img.Bounds()
+	var rgb [3]*plane
+	for c := range rgb {
+		rgb[c] = newPlane(bounds.Dx(), bounds.Dy())
+	}
+	forRows(rgb[0], numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+				i := y*bounds.Dx() + x
+				rgb[0].pix[i], rgb[1].pix[i], rgb[2].pix[i] = float32(c.R)/65535, float32(c.G)/65535, float32(c.B)/65535
+			}
+		}
+	})
+	return rgb
+}
+
+// Returns the average of the red, green and blue channels
+func grayPlane(rgb [3]*plane, numThreads int, s *Settings) *plane {
+	gray := newPlane(rgb[0].width, rgb[0].height)
+	forRows(gray, numThreads, s, func(minY int, maxY int) {
+		for i := minY * gray.width; i < maxY*gray.width; i++ {
+			gray.pix[i] = (rgb[0].pix[i] + rgb[1].pix[i] + rgb[2].pix[i]) / 3
+		}
+	})
+	return gray
+}
+
+// Returns the weight of every pixel of an exposure: the product of its contrast (the absolute Laplacian of the
+// grayscale image), its saturation (the standard deviation of its channels) and its well-exposedness (how close
+// each channel is to 0.5, on a Gaussian curve with sigma 0.2)
+func fusionWeights(rgb [3]*plane, numThreads int, s *Settings) *plane {
+	width, height := rgb[0].width, rgb[0].height
+	gray := grayPlane(rgb, numThreads, s)
+	weights := newPlane(width, height)
+	forRows(weights, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				i := y*width + x
+				left, right := gray.at(clampInt(x-1, 0, width-1), y), gray.at(clampInt(x+1, 0, width-1), y)
+				up, down := gray.at(x, clampInt(y-1, 0, height-1)), gray.at(x, clampInt(y+1, 0, height-1))
+				contrast := math.Abs(float64(left + right + up + down - 4*gray.pix[i]))
+
+				r, g, b := float64(rgb[0].pix[i]), float64(rgb[1].pix[i]), float64(rgb[2].pix[i])
+				mean := (r + g + b) / 3
+				saturation := math.Sqrt(((r-mean)*(r-mean) + (g-mean)*(g-mean) + (b-mean)*(b-mean)) / 3)
+
+				exposedness := float64(1)
+				for _, v := range [3]float64{r, g, b} {
+					exposedness *= math.Exp(-(v - 0.5) * (v - 0.5) / (2 * 0.2 * 0.2))
+				}
+				//the small constant keeps pixels that score 0 in every exposure from dividing by 0
+				weights.pix[i] = float32(contrast*saturation*exposedness + 1e-12)
+			}
+		}
+	})
+	return weights
+}
+
+// Scales the weights of every pixel so they add up to 1 across the exposures
+func normalizeWeights(weights []*plane, numThreads int, s *Settings) {
+	forRows(weights[0], numThreads, s, func(minY int, maxY int) {
+		for i := minY * weights[0].width; i < maxY*weights[0].width; i++ {
+			sum := float32(0)
+			for _, w := range weights {
+				sum += w.pix[i]
+			}
+			for _, w := range weights {
+				w.pix[i] /= sum
+			}
+		}
+	})
+}
+
+// Returns levels planes, p followed by repeatedly blurred and halved copies of it
+func gaussianPyramid(p *plane, levels int, numThreads int, s *Settings) []*plane {
+	pyramid := []*plane{p}
+	for len(pyramid) < levels {
+		pyramid = append(pyramid, reduce(pyramid[len(pyramid)-1], numThreads, s))
+	}
+	return pyramid
+}
+
+// Returns the Laplacian pyramid of p: each level of its Gaussian pyramid minus the next level expanded back to its
+// size, and the coarsest level as is
+func laplacianPyramid(p *plane, levels int, numThreads int, s *Settings) []*plane {
+	pyramid := gaussianPyramid(p, levels, numThreads, s)
+	for level := 0; level < levels-1; level++ {
+		band := pyramid[level]
+		expanded := expand(pyramid[level+1], band.width, band.height, numThreads, s)
+		laplacian := newPlane(band.width, band.height)
+		forRows(laplacian, numThreads, s, func(minY int, maxY int) {
+			for i := minY * band.width; i < maxY*band.width; i++ {
+				laplacian.pix[i] = band.pix[i] - expanded.pix[i]
+			}
+		})
+		pyramid[level] = laplacian
+	}
+	return pyramid
+}
+
+// Rebuilds a plane from its Laplacian pyramid, the inverse of laplacianPyramid
+func collapsePyramid(pyramid []*plane, numThreads int, s *Settings) *plane {
+	result := pyramid[len(pyramid)-1]
+	for level := len(pyramid) - 2; level >= 0; level-- {
+		band := pyramid[level]
+		expanded := expand(result, band.width, band.height, numThreads, s)
+		forRows(expanded, numThreads, s, func(minY int, maxY int) {
+			for i := minY * band.width; i < maxY*band.width; i++ {
+				expanded.pix[i] += band.pix[i]
+			}
+		})
+		result = expanded
+	}
+	return result
+}
+
+// Blurs p with pyramidKernel and keeps every other row and column. Pixels past the edges repeat the edge pixels
+func reduce(p *plane, numThreads int, s *Settings) *plane {
+	width, height := (p.width+1)/2, (p.height+1)/2
+	horizontal := newPlane(width, p.height)
+	forRows(horizontal, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				sum := float32(0)
+				for i, weight := range pyramidKernel {
+					sum += weight * p.at(clampInt(2*x+i-2, 0, p.width-1), y)
+				}
+				horizontal.pix[y*width+x] = sum
+			}
+		}
+	})
+	reduced := newPlane(width, height)
+	forRows(reduced, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				sum := float32(0)
+				for i, weight := range pyramidKernel {
+					sum += weight * horizontal.at(x, clampInt(2*y+i-2, 0, p.height-1))
+				}
+				reduced.pix[y*width+x] = sum
+			}
+		}
+	})
+	return reduced
+}
+
+// Upsamples p to width x height, the size of the level it was reduced from, interpolating with pyramidKernel.
+// Each output pixel is divided by the weights of the input pixels it actually got, so edges aren't darkened
+func expand(p *plane, width int, height int, numThreads int, s *Settings) *plane {
+	horizontal := newPlane(width, p.height)
+	forRows(horizontal, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				sum, total := float32(0), float32(0)
+				for i, weight := range pyramidKernel {
+					if u := clampInt(x+i-2, 0, width-1); u%2 == 0 {
+						sum += weight * p.at(u/2, y)
+						total += weight
+					}
+				}
+				horizontal.pix[y*width+x] = sum / total
+			}
+		}
+	})
+	expanded := newPlane(width, height)
+	forRows(expanded, numThreads, s, func(minY int, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				sum, total := float32(0), float32(0)
+				for i, weight := range pyramidKernel {
+					if v := clampInt(y+i-2, 0, height-1); v%2 == 0 {
+						sum += weight * horizontal.at(x, v/2)
+						total += weight
+					}
+				}
+				expanded.pix[y*width+x] = sum / total
+			}
+		}
+	})
+	return expanded
+}
+
+// Converts a value from 0 to 1 to 16 bits, clamping it first
+func unitToUint16(v float32) uint16 {
+	if v <= 0 {
+		return 0
+	} else if v >= 1 {
+		return 0xffff
+	}
+	return uint16(v*0xffff + 0.5)
+}
+
+func clampInt(v int, min int, max int) int {
+	if v < min {
+		return min
+	} else if v > max {
+		return max
+	}
+	return v
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
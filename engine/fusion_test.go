@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"image"
+	"testing"
+)
+
+// Images of different sizes can't be merged. Each merge must refuse them with an error, so only the task merging
+// them fails, rather than panic on the mismatched planes
+func TestMergeRefusesMismatchedSizes(t *testing.T) {
+	images := []image.Image{
+		image.NewRGBA64(image.Rect(0, 0, 16, 8)),
+		image.NewRGBA64(image.Rect(0, 0, 8, 16)),
+	}
+	merges := map[string]func([]image.Image, int, *Settings) (image.Image, error){
+		"exposure fusion": FuseExposures,
+		"focus stacking":  StackFocus,
+	}
+	for name, merge := range merges {
+		for _, threads := range []int{1, 4} {
+			if merged, err := merge(images, threads, &Settings{}); err == nil {
+				t.Errorf("%s of a 16x8 and an 8x16 image at %d threads gave a %v image", name, threads,
+					merged.Bounds().Size())
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"fmt"
+	"image/color"
+	"proj2/png"
+	"strconv"
+	"strings"
+)
+
+// ParseHexColor parses an opaque color written as #rrggbb
+func ParseHexColor(s string) (color.Color, error) {
+	var c color.RGBA
+	if len(s) != 7 || s[0] != '#' {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	if _, err := fmt.Sscanf(s[1:], "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	c.A = 255
+	return c, nil
+}
+
+// ParseGradient parses the stops of a gradient map written as "#rrggbb:position,#rrggbb:position,...", with
+// positions from 0 to 1 in increasing order. Positions can be left out of every stop to space them evenly, e.g.
+// "#1b2a49,#e8a33d" for a duotone from navy shadows to amber highlights. There must be at least two stops
+func ParseGradient(s string) ([]png.GradientStop, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid gradient %q, expected at least two #rrggbb:position stops", s)
+	}
+	stops := make([]png.GradientStop, len(parts))
+	withPositions := 0
+	for i, part := range parts {
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		c, err := ParseHexColor(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient stop %q: %v", part, err)
+		}
+		stops[i] = png.GradientStop{Color: c, Position: float64(i) / float64(len(parts)-1)}
+		if len(fields) == 1 {
+			continue
+		}
+		withPositions++
+		if stops[i].Position, err = strconv.ParseFloat(fields[1], 64); err != nil ||
+			stops[i].Position < 0 || stops[i].Position > 1 {
+			return nil, fmt.Errorf("invalid gradient stop %q, its position must be from 0 to 1", part)
+		}
+		if i > 0 && stops[i].Position < stops[i-1].Position {
+			return nil, fmt.Errorf("invalid gradient %q, stop positions must not decrease", s)
+		}
+	}
+	if withPositions != 0 && withPositions != len(parts) {
+		return nil, fmt.Errorf("invalid gradient %q, give either every stop a position or none", s)
+	}
+	return stops, nil
+}
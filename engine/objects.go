@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"proj2/png"
+	"proj2/png/kernel"
+	"strings"
+)
+
+// Largest radius of an effect object's kernel. A strip is processed with this many extra rows above and below it,
+// so huge kernels would make every strip read most of the image
+const maxObjectRadius = 50
+
+// EffectObject is an effect that takes parameters of its own, which tasks write as a JSON object instead of a
+// code, e.g. {"type":"convolve","kernel":[[0,-1,0],[-1,5,-1],[0,-1,0]]}, {"type":"blur","radius":3},
+// {"type":"gradient-map","gradient":"#1b2a49,#e8a33d"} or {"type":"flatten","background":"#000000"}
+type EffectObject struct {
+	Type       string      `json:"type"`                 // "convolve", "blur", "gradient-map" or "flatten"
+	Kernel     [][]float64 `json:"kernel,omitempty"`     // convolve: a square kernel with an odd number of rows
+	Normalize  bool        `json:"normalize,omitempty"`  // convolve: divide the kernel by the sum of its weights
+	Radius     int         `json:"radius,omitempty"`     // blur: how far the Gaussian blur reaches, in pixels
+	Gradient   string      `json:"gradient,omitempty"`   // gradient-map: the gradient's stops (see ParseGradient)
+	Background string      `json:"background,omitempty"` // flatten: the #rrggbb color images are flattened over
+}
+
+// EffectObjectTypes lists the types an EffectObject can have
+var EffectObjectTypes = []string{"convolve", "blur", "gradient-map", "flatten"}
+
+// ParseEffectObject checks an effect written as a JSON object and returns the code it goes by, which is the object
+// in compact JSON. Lookup turns the code back into an Effect
+func ParseEffectObject(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var obj EffectObject
+	if err := dec.Decode(&obj); err != nil {
+		return "", fmt.Errorf("invalid effect object %s: %v", data, err)
+	}
+	if _, err := obj.effect(""); err != nil {
+		return "", err
+	}
+	code, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(code), nil
+}
+
+// Reports whether code is an effect object rather than one of the codes of Effects
+func isObjectCode(code string) bool {
+	return strings.HasPrefix(code, "{")
+}
+
+// Returns the effect an object code stands for
+func lookupObject(code string) (Effect, bool) {
+	var obj EffectObject
+	if err := json.Unmarshal([]byte(code), &obj); err != nil {
+		return Effect{}, false
+	}
+	effect, err := obj.effect(code)
+	return effect, err == nil
+}
+
+// Returns the effect the object applies, going by code, or why it can't be applied. Gradient maps and flattens are
+// point effects, the other objects are convolutions, which read the input within the kernel's radius. All but
+// flattens keep alpha
+func (obj EffectObject) effect(code string) (Effect, error) {
+	if obj.Type == "flatten" {
+		background, err := ParseHexColor(obj.Background)
+		if err != nil {
+			return Effect{}, err
+		}
+		return Effect{Code: code, Name: "flatten over " + obj.Background, Kind: Point,
+			apply: func(pngImg *png.Image, s *Settings) { pngImg.Flatten(background) }}, nil
+	}
+	if obj.Type == "gradient-map" {
+		stops, err := ParseGradient(obj.Gradient)
+		if err != nil {
+			return Effect{}, err
+		}
+		return Effect{Code: code, Name: "gradient map " + obj.Gradient, Kind: Point, PreservesAlpha: true,
+			apply: func(pngImg *png.Image, s *Settings) { pngImg.GradientMap(stops) }}, nil
+	}
+	k, err := obj.kernel()
+	if err != nil {
+		return Effect{}, err
+	}
+	name := fmt.Sprintf("convolve %dx%d", k.Size(), k.Size())
+	if obj.Type == "blur" {
+		name = fmt.Sprintf("blur radius %d", obj.Radius)
+	}
+	return Effect{Code: code, Name: name, Kind: Neighborhood, Radius: k.Radius(), PreservesAlpha: true,
+		Params: []Param{edgeMode}, apply: func(pngImg *png.Image, s *Settings) { pngImg.Convolve(k) }}, nil
+}
+
+// KernelSum returns the sum of the weights of the kernel a convolve effect object applies, which is 1 for kernels
+// that keep the image's brightness and 0 for edge detectors, and false for other effects
+func KernelSum(code string) (float64, bool) {
+	var obj EffectObject
+	if !isObjectCode(code) || json.Unmarshal([]byte(code), &obj) != nil || obj.Type != "convolve" {
+		return 0, false
+	}
+	k, err := obj.kernel()
+	if err != nil {
+		return 0, false
+	}
+	return k.Sum(), true
+}
+
+// Returns the kernel the object applies, or why it can't be applied
+func (obj EffectObject) kernel() (kernel.Kernel, error) {
+	switch obj.Type {
+	case "convolve":
+		size := len(obj.Kernel)
+		if size%2 == 0 || size/2 > maxObjectRadius {
+			return nil, fmt.Errorf("convolve kernel must have an odd number of rows, up to %d, got %d",
+				2*maxObjectRadius+1, size)
+		}
+		k := kernel.New(size)
+		for row := range obj.Kernel {
+			if len(obj.Kernel[row]) != size {
+				return nil, fmt.Errorf("convolve kernel must be square, row %d has %d weights instead of %d", row,
+					len(obj.Kernel[row]), size)
+			}
+			copy(k[row], obj.Kernel[row])
+		}
+		if obj.Normalize {
+			if k.Sum() == 0 {
+				return nil, fmt.Errorf("convolve kernel can't be normalized, its weights add up to 0")
+			}
+			k = kernel.Scale(k, 1/k.Sum())
+		}
+		if magnitude := absoluteSum(k); math.IsInf(magnitude, 0) || math.IsNaN(magnitude) {
+			return nil, fmt.Errorf("convolve kernel weights must be finite, and small enough that they add up to a " +
+				"finite number")
+		}
+		return k, nil
+	case "blur":
+		if obj.Radius < 1 || obj.Radius > maxObjectRadius {
+			return nil, fmt.Errorf("blur radius must be from 1 to %d, got %d", maxObjectRadius, obj.Radius)
+		}
+		return kernel.Gaussian(float64(obj.Radius) / 3), nil //3 sigma is the radius Gaussian kernels are sized to
+	}
+	return nil, fmt.Errorf("unknown effect object type %q, expected convolve, blur, gradient-map or "+
+		"flatten", obj.Type)
+}
+
+// Returns the sum of the magnitudes of k's weights, which bounds how far a pixel can be scaled
+func absoluteSum(k kernel.Kernel) float64 {
+	sum := float64(0)
+	for row := range k {
+		for _, weight := range k[row] {
+			sum += math.Abs(weight)
+		}
+	}
+	return sum
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"proj2/png"
+	"strings"
+)
+
+// EffectSpec is one effect of the chain given to Compile: Code is one of the codes of Effects, or an effect
+// object's JSON as tasks write it. Object, if not nil, is used instead of Code
+type EffectSpec struct {
+	Code   string
+	Object *EffectObject
+}
+
+// Pipeline is a chain of effects checked and planned once by Compile, to be applied to any number of images.
+// Effect objects are parsed and their kernels built when compiling, rather than each time an image is split into
+// strips. A Pipeline never changes once compiled, so Apply can be called from many goroutines at once
+type Pipeline struct {
+	codes []string // the effects as compiled, before steps were fused
+	steps []Effect
+}
+
+// Compile checks every effect of the chain and plans how it is applied:
+//   - a grayscale directly following another grayscale is dropped, since grayscale of a gray pixel is itself
+//   - runs of point effects are fused into a single step, so each strip goes through all of them at once instead
+//     of the whole image waiting for every strip between them
+//
+// Neither changes a single bit of the output. Returns an error naming the first effect that isn't recognized
+func Compile(effects []EffectSpec) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, spec := range effects {
+		code := spec.Code
+		if spec.Object != nil {
+			data, err := json.Marshal(spec.Object)
+			if err != nil {
+				return nil, err
+			}
+			if code, err = ParseEffectObject(data); err != nil {
+				return nil, err
+			}
+		}
+		effect, ok := Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("effect %q not recognized", code)
+		}
+		p.codes = append(p.codes, code)
+		if code == "G" && len(p.steps) > 0 && p.steps[len(p.steps)-1].Code == "G" {
+			continue
+		}
+		p.steps = append(p.steps, effect)
+	}
+	p.steps = fusePointEffects(p.steps)
+	return p, nil
+}
+
+// Effects returns the codes of the compiled effects, in order, for DescribeChain
+func (p *Pipeline) Effects() []string {
+	return append([]string(nil), p.codes...)
+}
+
+// Apply applies the pipeline's effects in order to src, decomposing each step across numThreads goroutines like
+// Process, and returns the result. src itself is not modified. Analysis effects change nothing and what they find
+// is discarded
+func (p *Pipeline) Apply(src image.Image, numThreads int, s Settings) (image.Image, error) {
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	if len(p.steps) == 0 {
+		return src, nil
+	}
+	pngImg := png.FromImage(src)
+	for i, step := range p.steps {
+		decompose(pngImg, step, numThreads, &s, nil)
+
+		//if we're not on the final step, pass the in img to out img to stack effects
+		if i != len(p.steps)-1 {
+			pngImg.SetImgOutToIn()
+		}
+	}
+	TakeFindings(pngImg)
+	return pngImg.Output(), nil
+}
+
+// Replaces every run of consecutive point effects in steps by one effect applying them in turn
+func fusePointEffects(steps []Effect) []Effect {
+	var fused []Effect
+	for start := 0; start < len(steps); {
+		end := start + 1
+		for steps[start].Kind == Point && end < len(steps) && steps[end].Kind == Point {
+			end++
+		}
+		if end-start == 1 {
+			fused = append(fused, steps[start])
+		} else {
+			fused = append(fused, fuse(steps[start:end]))
+		}
+		start = end
+	}
+	return fused
+}
+
+// Returns a point effect applying every effect of run, which must all be point effects, in order
+func fuse(run []Effect) Effect {
+	run = append([]Effect(nil), run...)
+	codes := make([]string, len(run))
+	names := make([]string, len(run))
+	effect := Effect{Kind: Point, PreservesAlpha: true, fused: run}
+	for i, step := range run {
+		codes[i], names[i] = step.Code, step.Name
+		effect.PreservesAlpha = effect.PreservesAlpha && step.PreservesAlpha
+		effect.OrderDependent = effect.OrderDependent || step.OrderDependent
+		effect.Params = append(effect.Params, step.Params...)
+	}
+	effect.Code = strings.Join(codes, "+")
+	effect.Name = strings.Join(names, ", then ")
+	effect.apply = func(pngImg *png.Image, s *Settings) {
+		//pngImg can be a strip whose input is a view of the whole image's, so each step after the first gets an
+		//image of its own instead of swapping pngImg's buffers, and the last one's output is copied back
+		current := pngImg
+		for i, step := range run {
+			if i > 0 {
+				current = png.NewImg(current.Output())
+			}
+			step.apply(current, s)
+		}
+		bounds := pngImg.Output().Bounds()
+		pngImg.UseSubsetImg(current, bounds.Min.Y, bounds.Max.Y-1)
+	}
+	return effect
+}
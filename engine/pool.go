@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a set of long-lived goroutines that Decompose runs strips on. One pool can be shared by every image being
+// processed, so decomposing an effect doesn't start any goroutines and the strips of all images in flight are
+// spread over the same threads: a thread that finishes the strips of a small image moves on to those of a big one
+type Pool struct {
+	jobs   chan func() // a nil job stops the goroutine that takes it
+	mu     sync.Mutex
+	size   int
+	inline bool // run jobs in order on the goroutine calling Run
+
+	//jobs handed to Run, started and finished so far, for Stats
+	submitted, started, finished int64
+}
+
+// PoolStats is a snapshot of what a Pool is doing
+type PoolStats struct {
+	Size     int   // goroutines in the pool
+	Busy     int   // jobs running
+	Waiting  int   // jobs handed to Run that no goroutine has taken yet
+	Finished int64 // jobs finished since the pool was started
+}
+
+// NewPool starts a pool of size goroutines
+func NewPool(size int) *Pool {
+	p := &Pool{jobs: make(chan func())}
+	p.Resize(size)
+	return p
+}
+
+// InlinePool returns a pool that runs the jobs given to Run one after another, in order, on the calling goroutine.
+// Strips then always run in the same order whatever the number of threads, which makes scheduling deterministic
+// for tests and for debugging a strip in isolation
+func InlinePool() *Pool {
+	return &Pool{inline: true}
+}
+
+// Resize starts or stops goroutines so the pool has size of them. Goroutines being stopped finish their current
+// strip first. An inline pool stays inline
+func (p *Pool) Resize(size int) {
+	if p.inline {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ; p.size < size; p.size++ {
+		go func() {
+			for job := range p.jobs {
+				if job == nil {
+					return
+				}
+				job()
+			}
+		}()
+	}
+	if stops := p.size - size; stops > 0 {
+		p.size = size
+		go func() {
+			for i := 0; i < stops; i++ {
+				p.jobs <- nil
+			}
+		}()
+	}
+}
+
+// Run runs every job on the pool and waits for them to finish. Jobs must not call Run themselves. A nil pool runs
+// each job on a goroutine of its own
+func (p *Pool) Run(jobs []func()) {
+	p.RunAtMost(jobs, 0)
+}
+
+// RunAtMost is Run with at most limit of the jobs running at once, 0 for no limit. Jobs past the limit are handed to
+// the pool as earlier ones finish, so the pool's other goroutines are free to run other callers' jobs meanwhile
+func (p *Pool) RunAtMost(jobs []func(), limit int) {
+	if p != nil && p.inline {
+		for _, job := range jobs {
+			job()
+		}
+		return
+	}
+	var running chan bool
+	if limit > 0 && limit < len(jobs) {
+		running = make(chan bool, limit)
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(jobs))
+	for _, job := range jobs {
+		job := job
+		if running != nil {
+			running <- true
+			limited := job
+			job = func() {
+				defer func() { <-running }()
+				limited()
+			}
+		}
+		if p == nil {
+			go func() {
+				defer wg.Done()
+				job()
+			}()
+			continue
+		}
+		atomic.AddInt64(&p.submitted, 1)
+		p.jobs <- func() {
+			atomic.AddInt64(&p.started, 1)
+			defer wg.Done()
+			defer atomic.AddInt64(&p.finished, 1)
+			job()
+		}
+	}
+	wg.Wait()
+}
+
+// Stats returns what the pool is doing right now. The counts are read one after another while jobs run, so they
+// can be off by the few jobs that started or finished in between. A nil or inline pool reports nothing
+func (p *Pool) Stats() PoolStats {
+	if p == nil || p.inline {
+		return PoolStats{}
+	}
+	p.mu.Lock()
+	size := p.size
+	p.mu.Unlock()
+	finished := atomic.LoadInt64(&p.finished)
+	started := atomic.LoadInt64(&p.started)
+	submitted := atomic.LoadInt64(&p.submitted)
+	return PoolStats{Size: size, Busy: int(started - finished), Waiting: int(submitted - started), Finished: finished}
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInlinePoolRunsInOrder(t *testing.T) {
+	var order []int
+	jobs := make([]func(), 10)
+	for i := range jobs {
+		i := i
+		jobs[i] = func() { order = append(order, i) }
+	}
+	InlinePool().Run(jobs)
+	for i, job := range order {
+		if job != i {
+			t.Fatalf("jobs ran in order %v", order)
+		}
+	}
+	if len(order) != len(jobs) {
+		t.Fatalf("%d of %d jobs ran", len(order), len(jobs))
+	}
+}
+
+func TestPoolRunAtMost(t *testing.T) {
+	p := NewPool(8)
+	defer p.Resize(0)
+	var mu sync.Mutex
+	running, most, ran := 0, 0, 0
+	jobs := make([]func(), 50)
+	for i := range jobs {
+		jobs[i] = func() {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			for j := 0; j < 1000; j++ {
+				_ = j * j
+			}
+			mu.Lock()
+			running--
+			ran++
+			mu.Unlock()
+		}
+	}
+	p.RunAtMost(jobs, 3)
+	if ran != len(jobs) {
+		t.Fatalf("%d of %d jobs ran", ran, len(jobs))
+	}
+	if most > 3 {
+		t.Fatalf("%d jobs ran at once, with a limit of 3", most)
+	}
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"proj2/png"
+)
+
+// Kinds of effects, which decide how an effect can be split across threads
+const (
+	Point        = "point"        // each output pixel only depends on the input pixel at the same spot
+	Neighborhood = "neighborhood" // each output pixel depends on the input pixels within Radius of it
+	Global       = "global"       // output pixels depend on statistics of the whole image
+)
+
+// Effect describes an effect that tasks can refer to by its code
+type Effect struct {
+	Code           string
+	Name           string
+	Kind           string
+	Radius         int  // how far from an output pixel a neighborhood effect reads input pixels
+	PreservesAlpha bool // true if the effect never changes the alpha channel
+	OrderDependent bool // true if applying the effect in strips can give different output than applying it whole
+	MaxStrips      int  // most strips of one image the effect runs at once, however many threads there are, 0 for no limit
+	Params         []Param
+	apply          func(pngImg *png.Image, s *Settings)
+	fused          []Effect // the effects fused into this one, nil if it isn't fused
+}
+
+// Param is a setting of an effect. Name is the editor flag that sets it, which also holds its default and
+// description
+type Param struct {
+	Name     string
+	Range    string
+	min, max float64
+	whole    bool                             // true if the setting only takes whole numbers
+	set      func(s *Settings, value float64) // nil unless the setting is a single number
+	get      func(s *Settings) float64
+}
+
+// Returns a Param for a number setting that can be from min to max
+func number(name string, min float64, max float64, field func(s *Settings) *float64) Param {
+	return Param{Name: name, Range: formatRange(min, max), min: min, max: max, set: func(s *Settings, value float64) {
+		*field(s) = value
+	}, get: func(s *Settings) float64 { return *field(s) }}
+}
+
+// Returns a Param for a setting that can be a whole number from min to max
+func integer(name string, min int, max int, field func(s *Settings) *int) Param {
+	return Param{Name: name, Range: formatRange(float64(min), float64(max)), min: float64(min), max: float64(max),
+		whole: true, set: func(s *Settings, value float64) {
+			*field(s) = int(value)
+		}, get: func(s *Settings) float64 { return float64(*field(s)) }}
+}
+
+func formatRange(min float64, max float64) string {
+	if math.IsInf(max, 1) {
+		return fmt.Sprintf(">= %g", min)
+	}
+	return fmt.Sprintf("%g-%g", min, max)
+}
+
+// Numeric returns true if the setting is a single number, which Set can change
+func (p Param) Numeric() bool {
+	return p.set != nil
+}
+
+// Value returns the setting in s, if it is a single number
+func (p Param) Value(s *Settings) (float64, bool) {
+	if p.get == nil {
+		return 0, false
+	}
+	return p.get(s), true
+}
+
+// Limits returns the range of a number setting, whose max is +Inf if it has no upper bound, and whether it only
+// takes whole numbers
+func (p Param) Limits() (min float64, max float64, whole bool) {
+	return p.min, p.max, p.whole
+}
+
+// Set changes the setting in s to value, after checking that value is in its range
+func (p Param) Set(s *Settings, value float64) error {
+	if p.set == nil {
+		return fmt.Errorf("%s is not a number setting", p.Name)
+	}
+	if value < p.min || value > p.max {
+		return fmt.Errorf("%s must be in the range %s, got %g", p.Name, p.Range, value)
+	}
+	if p.whole && value != math.Trunc(value) {
+		return fmt.Errorf("%s must be a whole number, got %g", p.Name, value)
+	}
+	p.set(s, value)
+	return nil
+}
+
+// Effects lists every effect the engine knows, in the order they are listed to users
+var Effects = []Effect{
+	{Code: "G", Name: "grayscale", Kind: Point, PreservesAlpha: true,
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Grayscale() }},
+	{Code: "S", Name: "sharpen", Kind: Neighborhood, Radius: 1, PreservesAlpha: true, Params: []Param{edgeMode},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Sharpen() }},
+	{Code: "E", Name: "edge detect", Kind: Neighborhood, Radius: 1, PreservesAlpha: true, Params: []Param{edgeMode},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.EdgeDetect() }},
+	{Code: "B", Name: "blur", Kind: Neighborhood, Radius: 1, PreservesAlpha: true, Params: []Param{edgeMode},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Blur() }},
+	{Code: "T", Name: "thin edges", Kind: Neighborhood, Radius: 2, PreservesAlpha: true, Params: []Param{edgeMode},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.EdgeThin() }},
+	{Code: "L", Name: "auto levels", Kind: Global, PreservesAlpha: true,
+		Params: []Param{
+			number("levels-low", 0, 100, func(s *Settings) *float64 { return &s.LevelsLowClip }),
+			number("levels-high", 0, 100, func(s *Settings) *float64 { return &s.LevelsHighClip })},
+		apply: func(pngImg *png.Image, s *Settings) {
+			pngImg.AutoLevels(s.LevelsLowClip, s.LevelsHighClip)
+		}},
+	{Code: "H", Name: "shadows/highlights", Kind: Point, PreservesAlpha: true,
+		Params: []Param{
+			number("shadows", 0, 1, func(s *Settings) *float64 { return &s.Shadows }),
+			number("highlights", 0, 1, func(s *Settings) *float64 { return &s.Highlights })},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.ShadowsHighlights(s.Shadows, s.Highlights) }},
+	{Code: "A", Name: "adaptive sharpen", Kind: Neighborhood, Radius: 5, PreservesAlpha: true,
+		Params: []Param{
+			number("adaptive-strength", 0, math.Inf(1), func(s *Settings) *float64 { return &s.AdaptiveStrength }),
+			integer("adaptive-radius", 1, 5, func(s *Settings) *int { return &s.AdaptiveRadius }),
+			number("adaptive-noise", 0, 255, func(s *Settings) *float64 { return &s.AdaptiveNoise })},
+		apply: func(pngImg *png.Image, s *Settings) {
+			pngImg.AdaptiveSharpen(s.AdaptiveStrength, s.AdaptiveRadius, s.AdaptiveNoise)
+		}},
+	{Code: "K", Name: "chroma key", Kind: Point,
+		Params: []Param{{Name: "key-color", Range: "#rrggbb"},
+			number("key-tolerance", 0, 255, func(s *Settings) *float64 { return &s.KeyTolerance }),
+			number("key-feather", 0, 255, func(s *Settings) *float64 { return &s.KeyFeather })},
+		apply: func(pngImg *png.Image, s *Settings) {
+			pngImg.ChromaKey(s.KeyColor, s.KeyTolerance, s.KeyFeather)
+		}},
+	{Code: "FL", Name: "flatten", Kind: Point, Params: []Param{{Name: "background", Range: "#rrggbb"}},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Flatten(s.Background) }},
+	{Code: "LD", Name: "lens distortion correction", Kind: Global,
+		Params: []Param{number("lens-k1", -1, 1, func(s *Settings) *float64 { return &s.LensK1 }),
+			number("lens-k2", -1, 1, func(s *Settings) *float64 { return &s.LensK2 }), edgeMode},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Undistort(s.LensK1, s.LensK2) }},
+	{Code: "LV", Name: "vignetting compensation", Kind: Global, PreservesAlpha: true,
+		Params: []Param{number("vignette", 0, 0.95, func(s *Settings) *float64 { return &s.Vignette }),
+			number("vignette-falloff", 1, 8, func(s *Settings) *float64 { return &s.VignetteFalloff })},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Devignette(s.Vignette, s.VignetteFalloff) }},
+	{Code: "D", Name: "dark frame", Kind: Point, PreservesAlpha: true,
+		Params: []Param{{Name: "dark-frame", Range: "image path"},
+			number("dark-hot", 0, 255, func(s *Settings) *float64 { return &s.HotPixel })},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.SubtractDarkFrame(s.DarkFrame, s.HotPixel) }},
+	{Code: "F", Name: "flat field", Kind: Point, PreservesAlpha: true,
+		Params: []Param{{Name: "flat-field", Range: "image path"}},
+		apply:  func(pngImg *png.Image, s *Settings) { pngImg.DivideFlatField(s.FlatField) }},
+	{Code: "C", Name: "curves", Kind: Point, PreservesAlpha: true,
+		Params: []Param{
+			{Name: "curve", Range: "in:out pairs, 0-255"}, {Name: "curve-r", Range: "in:out pairs, 0-255"},
+			{Name: "curve-g", Range: "in:out pairs, 0-255"}, {Name: "curve-b", Range: "in:out pairs, 0-255"}},
+		apply: func(pngImg *png.Image, s *Settings) {
+			pngImg.Curves(s.CurveRGB, s.CurveRed, s.CurveGreen, s.CurveBlue)
+		}},
+	{Code: "M", Name: "gradient map", Kind: Point, PreservesAlpha: true,
+		Params: []Param{{Name: "gradient", Range: "#rrggbb:position stops, positions 0-1"}},
+		apply:  func(pngImg *png.Image, s *Settings) { pngImg.GradientMap(s.Gradient) }},
+	{Code: "VP", Name: "simulate protanopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.SimulateColorBlindness(png.Protan, s.CVDSeverity) }},
+	{Code: "VD", Name: "simulate deuteranopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.SimulateColorBlindness(png.Deutan, s.CVDSeverity) }},
+	{Code: "VT", Name: "simulate tritanopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.SimulateColorBlindness(png.Tritan, s.CVDSeverity) }},
+	{Code: "XP", Name: "daltonize for protanopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Daltonize(png.Protan, s.CVDSeverity) }},
+	{Code: "XD", Name: "daltonize for deuteranopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Daltonize(png.Deutan, s.CVDSeverity) }},
+	{Code: "XT", Name: "daltonize for tritanopia", Kind: Point, PreservesAlpha: true, Params: []Param{cvdSeverity},
+		apply: func(pngImg *png.Image, s *Settings) { pngImg.Daltonize(png.Tritan, s.CVDSeverity) }},
+	{Code: "TR", Name: "trim report", Kind: Global, PreservesAlpha: true,
+		Params: []Param{number("trim-tolerance", 0, 255, func(s *Settings) *float64 { return &s.TrimTolerance })},
+		apply:  reportTrim},
+}
+
+// How the kernel effects read pixels past the edges, set in png.Edges
+var edgeMode = Param{Name: "edge-mode", Range: "zero, wrap-x or extend"}
+
+// Severity shared by the color blindness simulation and daltonization effects
+var cvdSeverity = number("cvd-severity", 0, 1, func(s *Settings) *float64 { return &s.CVDSeverity })
+
+// StripCeiling returns the most strips of one image the effect with code runs at once, 0 for no limit: the ceiling
+// s.MaxStrips gives the code if it has one, or for an effect object the ceiling it gives the object's type, else
+// the effect's MaxStrips
+func StripCeiling(code string, s *Settings) int {
+	if ceiling, ok := s.MaxStrips[code]; ok {
+		return ceiling
+	}
+	var obj EffectObject
+	if isObjectCode(code) && json.Unmarshal([]byte(code), &obj) == nil {
+		if ceiling, ok := s.MaxStrips[obj.Type]; ok {
+			return ceiling
+		}
+	}
+	effect, _ := Lookup(code)
+	return effect.MaxStrips
+}
+
+// Returns the strip ceiling of effect like StripCeiling, which for a fused effect is the lowest ceiling of the
+// effects fused into it
+func stripCeiling(effect Effect, s *Settings) int {
+	if effect.fused == nil {
+		return StripCeiling(effect.Code, s)
+	}
+	lowest := 0
+	for _, step := range effect.fused {
+		if ceiling := stripCeiling(step, s); ceiling > 0 && (lowest == 0 || ceiling < lowest) {
+			lowest = ceiling
+		}
+	}
+	return lowest
+}
+
+// Lookup returns the effect with the given code, which can also be the code of an effect object (see
+// ParseEffectObject)
+func Lookup(code string) (Effect, bool) {
+	if isObjectCode(code) {
+		return lookupObject(code)
+	}
+	for _, effect := range Effects {
+		if effect.Code == code {
+			return effect, true
+		}
+	}
+	return Effect{}, false
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"proj2/png"
+)
+
+// Settings holds the parameters of the effects that take any, and how effects are split across threads. The editor
+// fills them in from its command line flags
+type Settings struct {
+	LevelsLowClip    float64          // percent of darkest pixels the auto-levels effect clips to black
+	LevelsHighClip   float64          // percent of brightest pixels the auto-levels effect clips to white
+	Shadows          float64          // strength of the shadow recovery effect
+	Highlights       float64          // strength of the highlight recovery effect
+	CurveRGB         []png.CurvePoint // control points of the curves effect applied to all channels
+	CurveRed         []png.CurvePoint // control points of the curves effect applied to a single channel
+	CurveGreen       []png.CurvePoint
+	CurveBlue        []png.CurvePoint
+	AdaptiveStrength float64            // strength of the adaptive sharpen effect
+	AdaptiveRadius   int                // radius of the neighborhood the adaptive sharpen effect measures local statistics in
+	AdaptiveNoise    float64            // standard deviation (0-255) below which the adaptive sharpen effect backs off
+	KeyColor         color.Color        // backdrop color made transparent by the chroma key effect
+	KeyTolerance     float64            // chroma distance (0-255) from KeyColor that is fully keyed out
+	KeyFeather       float64            // chroma distance over which the chroma key fades from transparent to opaque
+	Background       color.Color        // color the flatten effect composites transparent images over
+	LensK1, LensK2   float64            // radial coefficients of the distortion the lens distortion correction undoes
+	Vignette         float64            // fraction (0-0.95) of brightness the corners lose to the vignetting compensated
+	VignetteFalloff  float64            // exponent of the distance from the center the vignetting grows with
+	DarkFrame        image.Image        // calibration frame subtracted by the dark frame effect
+	HotPixel         float64            // level (0-255) dark frame values are lowered to before they are subtracted
+	FlatField        *png.FlatField     // calibration frame divided out by the flat field effect
+	CVDSeverity      float64            // how strong (0-1) a color vision deficiency the V and X effects simulate and correct
+	Gradient         []png.GradientStop // stops of the gradient map effect, sorted by position
+	TrimTolerance    float64            // difference (0-255) from the corner color the trim report still counts as border
+	ComplexityStrips bool               // split images into strips of equal detail rather than equal height
+	Deterministic    bool               // apply OrderDependent effects whole, so output doesn't depend on the thread count
+	ChunkRows        int                // rows per strip, 0 to pick the number of strips from the thread count and image size
+	Pool             *Pool              // goroutines strips are run on, nil to start a goroutine per strip
+	MaxStrips        map[string]int     // strip ceilings by effect code, in place of the effects' own MaxStrips
+}
+
+// DefaultSettings returns the settings the editor uses when no flags are given
+func DefaultSettings() Settings {
+	return Settings{
+		LevelsLowClip:    0.5,
+		LevelsHighClip:   0.5,
+		Shadows:          0.5,
+		Highlights:       0.5,
+		AdaptiveStrength: 1,
+		AdaptiveRadius:   2,
+		AdaptiveNoise:    5,
+		KeyColor:         color.RGBA{0, 255, 0, 255},
+		KeyTolerance:     40,
+		KeyFeather:       20,
+		Background:       color.RGBA{255, 255, 255, 255},
+		VignetteFalloff:  2,
+		HotPixel:         255,
+		CVDSeverity:      1,
+		TrimTolerance:    8,
+		Gradient: []png.GradientStop{
+			{Color: color.RGBA{0, 0, 0, 255}, Position: 0}, {Color: color.RGBA{255, 255, 255, 255}, Position: 1}},
+	}
+}
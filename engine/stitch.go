@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Stitch places tiles, given row by row, in a grid of rows by cols into one image. Tiles of a row must have the same
+// height and tiles of a column the same width. Neighboring tiles share overlap pixels, where they are blended with
+// weights ramping linearly from one tile to the other, so seams between tiles taken with slightly different
+// exposures don't show, and tiles that agree on what they share are put back together exactly. Rows of the result
+// are split into StripCount strips run on s.Pool
+func Stitch(tiles []image.Image, rows int, cols int, overlap int, numThreads int, s *Settings) (image.Image, error) {
+	if rows < 1 || cols < 1 || len(tiles) != rows*cols {
+		return nil, fmt.Errorf("%d images can't be stitched into a grid of %dx%d", len(tiles), rows, cols)
+	}
+	if overlap < 0 {
+		return nil, fmt.Errorf("overlap %d is negative", overlap)
+	}
+	heights, widths := make([]int, rows), make([]int, cols)
+	for row := range heights {
+		heights[row] = tiles[row*cols].Bounds().Dy()
+	}
+	for col := range widths {
+		widths[col] = tiles[col].Bounds().Dx()
+	}
+	for i, tile := range tiles {
+		row, col := i/cols, i%cols
+		size := tile.Bounds().Size()
+		if size.X != widths[col] || size.Y != heights[row] {
+			return nil, fmt.Errorf("image %d (row %d, column %d) is %v, expected %dx%d like the rest of its row "+
+				"and column", i+1, row+1, col+1, size, widths[col], heights[row])
+		}
+		if (cols > 1 && size.X < 2*overlap) || (rows > 1 && size.Y < 2*overlap) {
+			return nil, fmt.Errorf("image %d (row %d, column %d) is %v, too small to overlap its neighbors by %d",
+				i+1, row+1, col+1, size, overlap)
+		}
+	}
+	xs, ys := tileOffsets(widths, overlap), tileOffsets(heights, overlap)
+	width, height := xs[cols-1]+widths[cols-1], ys[rows-1]+heights[rows-1]
+	if numThreads < 1 {
+		numThreads = 1
+	}
+
+	out := image.NewRGBA64(image.Rect(0, 0, width, height))
+	numStrips := StripCount(width, height, numThreads, s)
+	stripHeight := (height + numStrips - 1) / numStrips
+	var strips []func()
+	for minY := 0; minY < height; minY += stripHeight {
+		minY, maxY := minY, minInt(minY+stripHeight, height)
+		strips = append(strips, func() {
+			//weighted sums of the premultiplied channels of every tile covering each pixel of the strip
+			sums := make([]float64, (maxY-minY)*width*4)
+			for i, tile := range tiles {
+				row, col := i/cols, i%cols
+				bounds := tile.Bounds()
+				for y := maxInt(minY, ys[row]); y < minInt(maxY, ys[row]+heights[row]); y++ {
+					wy := rampWeight(y-ys[row], heights[row], overlap, row > 0, row < rows-1)
+					for x := 0; x < widths[col]; x++ {
+						w := wy * rampWeight(x, widths[col], overlap, col > 0, col < cols-1)
+						r, g, b, a := tile.At(bounds.Min.X+x, bounds.Min.Y+y-ys[row]).RGBA()
+						j := ((y-minY)*width + xs[col] + x) * 4
+						sums[j] += w * float64(r)
+						sums[j+1] += w * float64(g)
+						sums[j+2] += w * float64(b)
+						sums[j+3] += w * float64(a)
+					}
+				}
+			}
+			for y := minY; y < maxY; y++ {
+				for x := 0; x < width; x++ {
+					j := ((y-minY)*width + x) * 4
+					out.SetRGBA64(x, y, color.RGBA64{R: toUint16(sums[j]), G: toUint16(sums[j+1]),
+						B: toUint16(sums[j+2]), A: toUint16(sums[j+3])})
+				}
+			}
+		})
+	}
+	s.Pool.Run(strips)
+	return out, nil
+}
+
+// Returns where each of the tiles of the given sizes starts along one axis of the stitched image, each overlapping
+// the one before it by overlap pixels
+func tileOffsets(sizes []int, overlap int) []int {
+	offsets := make([]int, len(sizes))
+	for i := 1; i < len(sizes); i++ {
+		offsets[i] = offsets[i-1] + sizes[i-1] - overlap
+	}
+	return offsets
+}
+
+// Returns the weight of pixel i of a tile size pixels long along one axis: ramping up across its first overlap
+// pixels if it has a neighbor before it, down across its last overlap pixels if it has one after it, and 1
+// elsewhere. The weights of two neighbors add up to 1 at every pixel they share
+func rampWeight(i int, size int, overlap int, before bool, after bool) float64 {
+	if before && i < overlap {
+		return (float64(i) + 0.5) / float64(overlap)
+	}
+	if after && i >= size-overlap {
+		return (float64(size-i) - 0.5) / float64(overlap)
+	}
+	return 1
+}
+
+// Rounds a sum of weighted 16 bit values to 16 bits
+func toUint16(v float64) uint16 {
+	return uint16(math.Max(0, math.Min(65535, math.Round(v))))
+}
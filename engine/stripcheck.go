@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StripLedger checks the strips an effect was decomposed into, in builds with the stripcheck tag. Each strip
+// claims the rows it wrote along with a checksum of what it wrote, and Verify then checks that the claims cover
+// every row of the image exactly once and that no row changed after its strip wrote it, which catches off-by-one
+// errors in the decomposition such as a missing row or a row written by two strips. A ledger from NewColumnLedger
+// does the same for columns. In other builds both return nil, and a nil StripLedger does nothing
+type StripLedger struct {
+	effect     string
+	minY, maxY int
+	lines      string // what strips claim, "rows" or "columns"
+	mu         sync.Mutex
+	claims     []stripClaim
+}
+
+// Rows (or columns) [minY, maxY) written by a strip, and the checksum of what it wrote there
+type stripClaim struct {
+	minY, maxY int
+	checksum   uint64
+}
+
+// NewStripLedger returns a ledger for the strips of effect over rows [minY, maxY), or nil unless built with the
+// stripcheck tag
+func NewStripLedger(effect string, minY int, maxY int) *StripLedger {
+	if !stripChecks {
+		return nil
+	}
+	return &StripLedger{effect: effect, minY: minY, maxY: maxY, lines: "rows"}
+}
+
+// NewColumnLedger returns a ledger for the strips of effect over columns [minX, maxX), for images split into
+// columns, or nil unless built with the stripcheck tag
+func NewColumnLedger(effect string, minX int, maxX int) *StripLedger {
+	if !stripChecks {
+		return nil
+	}
+	return &StripLedger{effect: effect, minY: minX, maxY: maxX, lines: "columns"}
+}
+
+// Claim records that a strip wrote rows [minY, maxY) (clipped to the ledger's rows) with the given checksum. Safe
+// for concurrent use
+func (l *StripLedger) Claim(minY int, maxY int, checksum uint64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.claims = append(l.claims, stripClaim{maxInt(minY, l.minY), minInt(maxY, l.maxY), checksum})
+}
+
+// Verify panics, describing the problem, unless the claims cover every row exactly once and checksum (computed
+// over the finished image) matches every claim. Call it once every strip is done
+func (l *StripLedger) Verify(checksum func(minY int, maxY int) uint64) {
+	if l == nil {
+		return
+	}
+	claims := append([]stripClaim{}, l.claims...)
+	sort.Slice(claims, func(i, j int) bool { return claims[i].minY < claims[j].minY })
+	next := l.minY
+	for _, claim := range claims {
+		if claim.minY >= claim.maxY {
+			continue //strips past the last row are empty
+		}
+		if claim.minY > next {
+			panic(fmt.Sprintf("strip check: effect %s left %s %d-%d unwritten", l.effect, l.lines, next,
+				claim.minY-1))
+		}
+		if claim.minY < next {
+			panic(fmt.Sprintf("strip check: effect %s wrote %s %d-%d in more than one strip", l.effect, l.lines,
+				claim.minY, minInt(next, claim.maxY)-1))
+		}
+		if sum := checksum(claim.minY, claim.maxY); sum != claim.checksum {
+			panic(fmt.Sprintf("strip check: effect %s %s %d-%d changed after their strip wrote them", l.effect,
+				l.lines, claim.minY, claim.maxY-1))
+		}
+		next = claim.maxY
+	}
+	if next < l.maxY {
+		panic(fmt.Sprintf("strip check: effect %s left %s %d-%d unwritten", l.effect, l.lines, next, l.maxY-1))
+	}
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
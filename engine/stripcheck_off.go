@@ -0,0 +1,6 @@
+//go:build !stripcheck
+// +build !stripcheck
+
+package engine
+
+const stripChecks = false
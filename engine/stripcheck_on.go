@@ -0,0 +1,8 @@
+//go:build stripcheck
+// +build stripcheck
+
+package engine
+
+// Builds with the stripcheck tag (go build -tags stripcheck) check the strips of every decomposed effect, see
+// StripLedger
+const stripChecks = true
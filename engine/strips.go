@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"image"
+	"math"
+	"proj2/png"
+)
+
+// Images with at least this many pixels are split into more strips than threads, so the strips of the images in
+// flight interleave on a shared Pool and no thread sits idle while another finishes the last strip of a big image
+const manyStripsPixels = 1 << 20
+
+// StripCount returns how many strips Decompose splits an image of the given size into for numThreads threads: one
+// per s.ChunkRows rows if set, else numThreads, or four times as many for images of manyStripsPixels or more
+func StripCount(width int, height int, numThreads int, s *Settings) int {
+	if s.ChunkRows > 0 && height > 0 {
+		return (height + s.ChunkRows - 1) / s.ChunkRows
+	}
+	if numThreads > 1 && width*height >= manyStripsPixels {
+		return 4 * numThreads
+	}
+	return numThreads
+}
+
+// Returns numStrips, lowered so that each strip of an image size rows (or columns) long is at least as tall as the
+// padding its kernel reads on each side. Thinner strips would read more of their neighbors than they write, which
+// with a large kernel and a small -chunk multiplies the work many times over. A kernel that needs more padding than
+// half the image is applied to the whole image in one piece
+func haloStrips(numStrips int, size int, padding int) int {
+	if most := size / padding; most < numStrips {
+		return maxInt(most, 1)
+	}
+	return numStrips
+}
+
+// Images wider than tall are split into columns instead of rows when the rows padding every strip would add more
+// than this fraction to the rows the strips write. Below it, rows are as fast or faster despite their padding,
+// since each row they copy is contiguous in memory
+const columnPadding = 0.35
+
+// Returns the rows (or columns) a strip of effect is padded with on each side, so kernels reading past the strip's
+// edges read the neighboring pixels. Every built in effect reads at most 5 rows away, objects can read further
+func stripPadding(effect Effect) int {
+	if effect.Radius > 5 {
+		return effect.Radius
+	}
+	return 5
+}
+
+// Returns whether an image of the given size is split into numStrips columns rather than rows. Row strips of a wide,
+// short image are only a few rows tall, so the padding rows above and below each one can outnumber the rows it
+// writes, while columns of the same image are wide enough that their padding is a small fraction. Images stay in
+// rows with s.ChunkRows or s.ComplexityStrips, which pick rows themselves, and in the wrap-x edge mode, where
+// kernels at the left edge read the right edge
+func acrossColumns(width int, height int, numStrips int, padding int, s *Settings) bool {
+	if numStrips < 2 || width <= height || s.ChunkRows > 0 || s.ComplexityStrips || png.Edges == png.EdgeWrapX {
+		return false
+	}
+	return float64(2*padding*numStrips) > columnPadding*float64(height)
+}
+
+// Applies effect to pngImg split into numStrips columns of equal widths, each padded like row strips, on s.Pool
+func decomposeColumns(pngImg *png.Image, effect Effect, numStrips int, s *Settings, stripDone func()) {
+	bounds := pngImg.Output().Bounds()
+	padding := stripPadding(effect)
+	sectionWidth := (bounds.Dx() + numStrips - 1) / numStrips
+	ledger := NewColumnLedger(effect.Code, bounds.Min.X, bounds.Max.X)
+	var strips []func()
+	for minX := bounds.Min.X; minX < bounds.Max.X; minX += sectionWidth {
+		column := image.Rect(minX, bounds.Min.Y, minX+sectionWidth, bounds.Max.Y).Intersect(bounds)
+		strips = append(strips, func() {
+			subImg := png.NewImg(pngImg.GetSubImgRect(column.Inset(-padding)))
+			effect.apply(subImg, s)
+			pngImg.UseSubsetRect(subImg, column)
+			ledger.Claim(column.Min.X, column.Max.X, subImg.OutputColumnsChecksum(column.Min.X, column.Max.X))
+			if stripDone != nil {
+				stripDone()
+			}
+		})
+	}
+	s.Pool.RunAtMost(strips, stripCeiling(effect, s)) //returns once all columns are complete
+	ledger.Verify(pngImg.OutputColumnsChecksum)
+}
+
+// Returns the last row (inclusive) of each of the numThreads strips pngImg is split into. Strip i starts on the row
+// after the last row of strip i-1. Strips have equal heights, give or take a row, unless complexity is true, in which
+// case each strip gets an equal share of the image's detail (see rowCosts), so detailed regions are split into
+// thinner strips. Every strip has at least one row, so numThreads must not exceed the image's height
+func stripCeils(pngImg *png.Image, numThreads int, complexity bool) []float64 {
+	height := pngImg.GetHeight()
+	ceils := make([]float64, numThreads)
+	if !complexity || height < 2*numThreads {
+		for i := range ceils {
+			ceils[i] = float64((i+1)*height/numThreads - 1)
+		}
+		return ceils
+	}
+
+	costs := rowCosts(pngImg)
+	total := float64(0)
+	for _, cost := range costs {
+		total += cost
+	}
+	//each strip ends on the first row where the running cost reaches its share of the total
+	row, cumulative := 0, costs[0]
+	for i := range ceils {
+		target := total * float64(i+1) / float64(numThreads)
+		for row < height-1 && cumulative < target {
+			row++
+			cumulative += costs[row]
+		}
+		//a row costing more than a strip's share would otherwise end several strips, leaving the later ones
+		//empty, and the strips after this one need a row each
+		ceils[i] = float64(minInt(row, height-numThreads+i))
+		if i > 0 && ceils[i] <= ceils[i-1] {
+			ceils[i] = ceils[i-1] + 1
+		}
+	}
+	ceils[numThreads-1] = float64(height - 1)
+	return ceils
+}
+
+// Returns an estimate of the relative cost of every row of pngImg: 1 for a flat row, plus the row's edge density
+// (the mean luminance difference to the pixels right of and below it) relative to the image's mean. Every fourth
+// pixel of a row is sampled, which keeps this much cheaper than any effect
+func rowCosts(pngImg *png.Image) []float64 {
+	height := pngImg.GetHeight()
+	img := pngImg.GetSubImg(0, height-1)
+	bounds := img.Bounds()
+	luma := func(x int, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return float64(r+g+b) / 3
+	}
+
+	density := make([]float64, bounds.Dy())
+	mean := float64(0)
+	for y := bounds.Min.Y; y < bounds.Max.Y-1; y++ {
+		sum, samples := float64(0), 0
+		for x := bounds.Min.X; x < bounds.Max.X-1; x += 4 {
+			v := luma(x, y)
+			sum += math.Abs(v-luma(x+1, y)) + math.Abs(v-luma(x, y+1))
+			samples++
+		}
+		if samples > 0 {
+			density[y-bounds.Min.Y] = sum / float64(samples)
+		}
+		mean += density[y-bounds.Min.Y] / float64(len(density))
+	}
+
+	costs := make([]float64, len(density))
+	for i, d := range density {
+		costs[i] = 1
+		if mean > 0 {
+			costs[i] += d / mean
+		}
+	}
+	return costs
+}
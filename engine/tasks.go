@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// Task is one image to process: the effects to apply to the image at InPath, or merged from InPaths, and where to
+// save the result. It has the fields of the editor's JSON tasks
+type Task struct {
+	ID          string   `json:"id,omitempty"` // names the task in control messages, such as one cancelling it
+	InPath      string   `json:"inPath"`
+	InPaths     []string `json:"inPaths,omitempty"` // images of one scene merged into the input, instead of InPath
+	Merge       string   `json:"merge,omitempty"`   // how InPaths are merged: "exposure" fusion (the default), "focus" stacking or "stitch"
+	Grid        string   `json:"grid,omitempty"`    // rows and columns of the InPaths stitched together, e.g. "2x3"
+	Overlap     int      `json:"overlap,omitempty"` // pixels neighboring InPaths share when stitched
+	OutPath     string   `json:"outPath"`
+	Effects     []string `json:"effects"`               // effect codes, with effect objects as their compact JSON
+	Overwrite   string   `json:"overwrite,omitempty"`   // what to do if OutPath exists, if not the default
+	JPEGQuality int      `json:"jpegQuality,omitempty"` // quality (1-100) of a .jpg OutPath, if not the default
+	Progressive *bool    `json:"progressive,omitempty"` // interlaced PNG or progressive JPEG OutPath, if not the default
+	MaxBytes    int64    `json:"maxBytes,omitempty"`    // largest size of the saved output, if not the default
+	Background  string   `json:"background,omitempty"`  // #rrggbb color flatten effects use, if not the default
+}
+
+// TaskSource supplies tasks one at a time, from a file, a database, a queue or program logic. Next returns io.EOF
+// once there are no tasks left. The editor's reader of JSON tasks on Stdin is one TaskSource
+type TaskSource interface {
+	Next() (Task, error)
+}
+
+// TaskSourceFunc lets an ordinary function be used as a TaskSource
+type TaskSourceFunc func() (Task, error)
+
+func (f TaskSourceFunc) Next() (Task, error) {
+	return f()
+}
+
+// SliceSource returns a TaskSource supplying tasks in order
+func SliceSource(tasks []Task) TaskSource {
+	return TaskSourceFunc(func() (Task, error) {
+		if len(tasks) == 0 {
+			return Task{}, io.EOF
+		}
+		t := tasks[0]
+		tasks = tasks[1:]
+		return t, nil
+	})
+}
+
+// MergeSources returns a TaskSource supplying the tasks of every source in the order they arrive. Each source is read
+// on a goroutine of its own, at most one task ahead, so a source waiting for its next task, such as a pipe another
+// program is still writing, doesn't hold up the others. Errors other than io.EOF are passed on without ending their
+// source. Returns io.EOF once every source has. A single source is returned as it is
+func MergeSources(sources ...TaskSource) TaskSource {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	type result struct {
+		task Task
+		err  error
+	}
+	results := make(chan result)
+	for _, src := range sources {
+		go func(src TaskSource) {
+			for {
+				t, err := src.Next()
+				results <- result{t, err}
+				if err == io.EOF {
+					return
+				}
+			}
+		}(src)
+	}
+	open := len(sources)
+	return TaskSourceFunc(func() (Task, error) {
+		for open > 0 {
+			r := <-results
+			if r.err != io.EOF {
+				return r.task, r.err
+			}
+			open--
+		}
+		return Task{}, io.EOF
+	})
+}
+
+// RunTasks takes every task from src until it returns io.EOF, applies the task's effects to the image load returns
+// for it like Process, decomposing each effect across numThreads goroutines, and hands the result to save. Tasks
+// are processed one after another. The engine reads and writes no files itself, so load and save decide where
+// images come from and go to. Any other error stops the run and is returned
+func RunTasks(src TaskSource, numThreads int, s Settings, load func(t Task) (image.Image, error),
+	save func(t Task, img image.Image) error) error {
+	for {
+		t, err := src.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		img, err := load(t)
+		if err != nil {
+			return fmt.Errorf("can't load the input of task %s: %v", t.OutPath, err)
+		}
+		if img, err = Process(img, t.Effects, numThreads, s); err != nil {
+			return fmt.Errorf("task %s: %v", t.OutPath, err)
+		}
+		if err = save(t, img); err != nil {
+			return fmt.Errorf("can't save task %s: %v", t.OutPath, err)
+		}
+	}
+}
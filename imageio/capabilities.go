@@ -0,0 +1,127 @@
+package imageio
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+)
+
+// FormatCapabilities describes what an output format can hold
+type FormatCapabilities struct {
+	Format      string `json:"format"`
+	BitDepth    int    `json:"bitDepth"`            // most bits per channel it stores, 32 for floats
+	Alpha       bool   `json:"alpha"`               // true if it keeps the alpha channel
+	MaxColors   int    `json:"maxColors,omitempty"` // most colors it stores, more are dithered away, 0 for no limit
+	Text        bool   `json:"text"`                // true if it records the Text of EncodeOptions, in the file or a sidecar
+	Progressive bool   `json:"progressive"`         // true if it can be saved interlaced or progressive for EncodeOptions
+}
+
+// OutputCapabilities is the capability matrix of every format in OutputFormats, in the same order
+var OutputCapabilities = []FormatCapabilities{
+	{Format: "png", BitDepth: 16, Alpha: true, Text: true, Progressive: true},
+	{Format: "jpeg", BitDepth: 8, Progressive: true},
+	{Format: "gif", BitDepth: 8, MaxColors: 256}, //the encoder's palette has no transparent color
+	{Format: "npy", BitDepth: 16, Alpha: true},
+	{Format: "pfm", BitDepth: 32},
+	{Format: "raw", BitDepth: 16, Alpha: true, Text: true},
+}
+
+// CapabilityError is returned by Save, unless told to coerce, when the output format can't hold part of the image:
+// its alpha channel, or the precision of a 16 bit source. Nothing is written
+type CapabilityError struct {
+	Format       string   // the output format
+	Feature      string   // what it can't hold, "alpha" or "16-bit"
+	Alternatives []string // the output formats that can
+}
+
+func (e *CapabilityError) Error() string {
+	what := "the image's transparency"
+	if e.Feature == "16-bit" {
+		what = "the 16 bits per channel of the image's source"
+	}
+	return fmt.Sprintf("%s outputs can't hold %s, save as %s instead", e.Format, what,
+		strings.Join(e.Alternatives, ", "))
+}
+
+// OutputFormat returns the name of the format Save writes filePath in
+func OutputFormat(filePath string) string {
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".gif", ".npy", ".pfm", ".raw":
+		return ext[1:]
+	}
+	return "png"
+}
+
+// KeepsText reports whether Save records the Text of EncodeOptions for filePath, which it drops for formats without
+// text chunks or a sidecar
+func KeepsText(filePath string) bool {
+	return capabilitiesOf(OutputFormat(filePath)).Text
+}
+
+// KeepsAlpha reports whether the format of filePath keeps the alpha channel, rather than needing images flattened
+// first
+func KeepsAlpha(filePath string) bool {
+	return capabilitiesOf(OutputFormat(filePath)).Alpha
+}
+
+// Returns the capabilities of format, one of OutputFormats
+func capabilitiesOf(format string) FormatCapabilities {
+	for _, c := range OutputCapabilities {
+		if c.Format == format {
+			return c
+		}
+	}
+	return FormatCapabilities{}
+}
+
+// CheckCapabilities returns a CapabilityError if the format of filePath can't hold img, whose pixels came from a
+// source with sourceBitDepth bits per channel (0 if unknown, which is taken as 8). Alpha is only a conflict if some
+// pixel isn't opaque
+func CheckCapabilities(filePath string, img image.Image, sourceBitDepth int) error {
+	format := OutputFormat(filePath)
+	caps := capabilitiesOf(format)
+	if sourceBitDepth > caps.BitDepth {
+		return &CapabilityError{Format: format, Feature: "16-bit", Alternatives: formatsWith(func(c FormatCapabilities) bool {
+			return c.BitDepth >= sourceBitDepth
+		})}
+	}
+	if !caps.Alpha && !opaque(img) {
+		return &CapabilityError{Format: format, Feature: "alpha", Alternatives: FormatsWithAlpha()}
+	}
+	return nil
+}
+
+// Returns the output formats whose capabilities satisfy ok
+func formatsWith(ok func(c FormatCapabilities) bool) []string {
+	var formats []string
+	for _, c := range OutputCapabilities {
+		if ok(c) {
+			formats = append(formats, c.Format)
+		}
+	}
+	return formats
+}
+
+// FormatsWithAlpha returns the output formats that keep the alpha channel
+func FormatsWithAlpha() []string {
+	return formatsWith(func(c FormatCapabilities) bool { return c.Alpha })
+}
+
+// Returns true if every pixel of img is fully opaque
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
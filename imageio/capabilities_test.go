@@ -0,0 +1,114 @@
+package imageio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns a 16x8 gradient whose top left pixel is fully transparent if transparent is set
+func capabilityTestImage(transparent bool) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetRGBA64(x, y, color.RGBA64{uint16(x * 4099), uint16(y * 8191), 0x8001, 0xffff})
+		}
+	}
+	if transparent {
+		img.SetRGBA64(0, 0, color.RGBA64{})
+	}
+	return img
+}
+
+func TestOutputCapabilities(t *testing.T) {
+	if len(OutputCapabilities) != len(OutputFormats) {
+		t.Fatalf("%d formats have capabilities, %d are written", len(OutputCapabilities), len(OutputFormats))
+	}
+	for i, c := range OutputCapabilities {
+		if c.Format != OutputFormats[i] {
+			t.Errorf("capabilities %d are of %s, the format written is %s", i, c.Format, OutputFormats[i])
+		}
+	}
+}
+
+func TestSaveCapabilities(t *testing.T) {
+	tests := []struct {
+		ext         string
+		bitDepth    int    // bits per channel of the source
+		transparent bool   // whether the image has a transparent pixel
+		refused     string // the feature Save refuses the image for, "" if it saves it
+	}{
+		{".png", 8, false, ""},
+		{".png", 8, true, ""},
+		{".png", 16, false, ""},
+		{".jpg", 8, false, ""},
+		{".jpg", 8, true, "alpha"},
+		{".jpg", 16, false, "16-bit"},
+		{".gif", 8, false, ""},
+		{".gif", 8, true, "alpha"},
+		{".gif", 16, false, "16-bit"},
+		{".npy", 8, false, ""},
+		{".npy", 8, true, ""},
+		{".npy", 16, false, ""},
+		{".pfm", 8, false, ""},
+		{".pfm", 8, true, "alpha"},
+		{".pfm", 16, false, ""},
+		{".raw", 8, false, ""},
+		{".raw", 8, true, ""},
+		{".raw", 16, false, ""},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		img := capabilityTestImage(test.transparent)
+		path := filepath.Join(dir, fmt.Sprintf("%d_%t%s", test.bitDepth, test.transparent, test.ext))
+		opts := EncodeOptions{SourceBitDepth: test.bitDepth}
+		err := Save(path, img, opts)
+
+		if test.refused != "" {
+			capErr, ok := err.(*CapabilityError)
+			if !ok || capErr.Feature != test.refused {
+				t.Errorf("%s: got %v, want a capability error for %s", path, err, test.refused)
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				t.Errorf("%s: refused, but a file was written", path)
+			}
+			opts.Coerce = true
+			if err := Save(path, img, opts); err != nil {
+				t.Errorf("%s: coerced: %v", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+
+		format := OutputFormat(path)
+		for _, input := range InputFormats {
+			if input != format {
+				continue
+			}
+			decoded, decodedFormat, err := Load(path)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+				continue
+			}
+			if decodedFormat != format || decoded.Bounds().Size() != img.Bounds().Size() {
+				t.Errorf("%s: decoded as a %v %s image", path, decoded.Bounds().Size(), decodedFormat)
+			}
+			if _, _, _, a := decoded.At(0, 0).RGBA(); test.transparent && a != 0 {
+				t.Errorf("%s: the transparent pixel came back with alpha %d", path, a)
+			}
+			info, err := Probe(path)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+			} else if format == "png" && info.BitDepth < test.bitDepth {
+				t.Errorf("%s: saved at %d bits per channel from a %d bit source", path, info.BitDepth, test.bitDepth)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package imageio loads images of any supported format and saves processed
+// images to files, with encoder settings that can be tuned per run. Inputs
+// are recognized by their header. The output format is chosen from the file
+// extension: .jpg/.jpeg and .gif are encoded as such, .npy, .pfm and .raw
+// write the pixels for direct consumption by other tools, anything else is
+// encoded as PNG.
+package imageio
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutputFormats lists the formats Save writes, by the extension that selects each; any other extension is png
+var OutputFormats = []string{"png", "jpeg", "gif", "npy", "pfm", "raw"}
+
+// EncodeOptions holds the encoder and file settings used by Save
+type EncodeOptions struct {
+	Compression    png.CompressionLevel // zlib compression level of PNG outputs
+	CreateDirs     bool                 // create the output's missing parent directories
+	FileMode       os.FileMode          // permissions of the files written, 0 for the default of 0666 less the umask
+	Text           map[string]string    // keyword/text pairs recorded in PNG outputs and the sidecar of .raw outputs
+	Exclusive      bool                 // fail with an error satisfying os.IsExist instead of replacing a file
+	JPEGQuality    int                  // quality (1-100) of JPEG outputs, 0 for jpeg.DefaultQuality
+	Atomic         bool                 // write a temporary file and rename it over filePath, ignoring Exclusive
+	Paletted       bool                 // write PNG outputs of at most 256 colors (at 8 bits per channel) with a palette
+	SourceBitDepth int                  // bits per channel of the pixels' source, 8 or 16, 0 if unknown
+	Coerce         bool                 // save what the format can't hold anyway, instead of returning a CapabilityError
+	Progressive    bool                 // write PNG outputs interlaced (Adam7) and JPEG outputs progressive
+	BitDepth       int                  // bits per channel of the output, 8 or 16, 0 for the format's own
+	Dither         bool                 // diffuse the rounding error of outputs quantized to 8 bits per channel
+}
+
+// KeptBitDepth returns the bits per channel of the image Save has to keep: BitDepth if set, else SourceBitDepth
+func (opts EncodeOptions) KeptBitDepth() int {
+	if opts.BitDepth != 0 {
+		return opts.BitDepth
+	}
+	return opts.SourceBitDepth
+}
+
+// Save encodes img to filePath in the format matching its extension, using the settings in opts. Unless
+// opts.Coerce is set, an image the format can't hold (see CheckCapabilities) is refused with a CapabilityError
+// before anything is written. An image saved at 8 bits per channel, by opts.BitDepth or by its format, is rounded
+// to the nearest level rather than truncated when opts.BitDepth is 8, and dithered when opts.Dither is set too, or
+// set for an 8 bit format
+func Save(filePath string, img image.Image, opts EncodeOptions) error {
+	if !opts.Coerce {
+		if err := CheckCapabilities(filePath, img, opts.KeptBitDepth()); err != nil {
+			return err
+		}
+	}
+	if opts.BitDepth == 8 || (opts.Dither && capabilitiesOf(OutputFormat(filePath)).BitDepth == 8) {
+		img = quantize8(img, opts.Dither)
+	}
+	var outWriter *os.File
+	var err error
+	if opts.Atomic {
+		outWriter, err = createTemp(filePath, opts)
+	} else {
+		outWriter, err = create(filePath, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".npy":
+		err = encodeNPY(outWriter, img)
+	case ".pfm":
+		err = encodePFM(outWriter, img)
+	case ".raw":
+		err = encodeRaw(outWriter, img, filePath+".json", opts)
+	case ".jpg", ".jpeg":
+		quality := opts.JPEGQuality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		if opts.Progressive {
+			err = encodeProgressive(outWriter, func(w io.Writer) error {
+				return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+			}, progressiveJPEG)
+		} else {
+			err = jpeg.Encode(outWriter, img, &jpeg.Options{Quality: quality}) //JPEG has no alpha, transparent pixels come out black
+		}
+	case ".gif":
+		err = gif.Encode(outWriter, img, nil) //reduced to 256 colors with dithering
+	default:
+		if opts.Paletted {
+			if paletted, ok := toPaletted(img); ok {
+				img = paletted
+			}
+		}
+		enc := png.Encoder{CompressionLevel: opts.Compression}
+		var w io.Writer = outWriter
+		if len(opts.Text) > 0 {
+			w = &textChunkWriter{w: outWriter, text: opts.Text}
+		}
+		if opts.Progressive {
+			err = encodeProgressive(w, func(w io.Writer) error { return enc.Encode(w, img) },
+				func(data []byte) ([]byte, error) { return interlacePNG(data, opts.Compression) })
+		} else {
+			err = enc.Encode(w, img)
+		}
+	}
+	if err == nil {
+		countSaved(outWriter)
+	}
+	if closeErr := outWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if opts.Atomic {
+		//filePath is only replaced once the new file is complete, so a failed save leaves it as it was
+		if err == nil {
+			err = os.Rename(outWriter.Name(), filePath)
+		}
+		if err != nil {
+			os.Remove(outWriter.Name())
+		}
+	}
+	return err
+}
+
+// Encodes an image with encode into memory, rewrites the stream with progressive and writes the result to w
+func encodeProgressive(w io.Writer, encode func(w io.Writer) error, progressive func(data []byte) ([]byte, error)) error {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		return err
+	}
+	data, err := progressive(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Creates a hidden temporary file next to filePath for an atomic save, with the permissions filePath is to have:
+// opts.FileMode if set, else those of the file it replaces
+func createTemp(filePath string, opts EncodeOptions) (*os.File, error) {
+	if opts.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0777); err != nil {
+			return nil, err
+		}
+	}
+	mode := opts.FileMode
+	if mode == 0 {
+		mode = 0644
+		if info, err := os.Stat(filePath); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// Creates or truncates the file at filePath, with its parent directories and permissions as set in opts. With
+// opts.Exclusive, fails if the file exists instead. An explicit FileMode is applied with chmod, so it isn't reduced
+// by the umask
+func create(filePath string, opts EncodeOptions) (*os.File, error) {
+	if opts.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0777); err != nil {
+			return nil, err
+		}
+	}
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if opts.Exclusive {
+		flags = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(filePath, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if opts.FileMode != 0 {
+		if err := f.Chmod(opts.FileMode); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
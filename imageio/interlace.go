@@ -0,0 +1,264 @@
+package imageio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image/png"
+	"io"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// Where each of the 7 Adam7 passes starts and how far apart its pixels are, across and down
+var adam7Passes = [7]struct{ x, y, dx, dy int }{
+	{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2},
+}
+
+// Returns the PNG stream data, as image/png writes it, rewritten with Adam7 interlacing: the same pixels, in 7
+// passes that let a browser show a coarse version of the image once the first few percent have arrived. Every
+// other chunk is kept as it is. The passes are compressed at level like image/png would
+func interlacePNG(data []byte, level png.CompressionLevel) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("interlace: not a PNG stream")
+	}
+	var ihdr, idat []byte
+	var before, after [][]byte //chunks other than IHDR, IDAT and IEND, before and after the image data
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("interlace: truncated PNG chunk")
+		}
+		length := int(binary.BigEndian.Uint32(rest))
+		if length > len(rest)-12 {
+			return nil, errors.New("interlace: truncated PNG chunk")
+		}
+		chunk, chunkType, chunkData := rest[:12+length], string(rest[4:8]), rest[8:8+length]
+		rest = rest[12+length:]
+		switch {
+		case chunkType == "IHDR":
+			ihdr = append([]byte(nil), chunkData...)
+		case chunkType == "IDAT":
+			idat = append(idat, chunkData...)
+		case chunkType == "IEND":
+			rest = nil
+		case idat == nil:
+			before = append(before, chunk)
+		default:
+			after = append(after, chunk)
+		}
+	}
+	if len(ihdr) != 13 || ihdr[12] != 0 {
+		return nil, errors.New("interlace: PNG stream without a header or already interlaced")
+	}
+
+	width, height := int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:]))
+	bitDepth, colorType := int(ihdr[8]), ihdr[9]
+	channels := map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[colorType]
+	if channels == 0 {
+		return nil, fmt.Errorf("interlace: unknown PNG color type %d", colorType)
+	}
+	bitsPerPixel := channels * bitDepth
+	rows, err := unfilterRows(idat, width, height, bitsPerPixel)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&compressed, zlibLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	//like image/png, rows of palettes and of less than a byte per pixel aren't filtered
+	adaptive := colorType != 3 && bitDepth >= 8
+	for _, pass := range adam7Passes {
+		passWidth, passHeight := (width-pass.x+pass.dx-1)/pass.dx, (height-pass.y+pass.dy-1)/pass.dy
+		if passWidth <= 0 || passHeight <= 0 {
+			continue
+		}
+		rowLen := (passWidth*bitsPerPixel + 7) / 8
+		prev := make([]byte, rowLen)
+		for y := pass.y; y < height; y += pass.dy {
+			row := make([]byte, rowLen)
+			for i, x := 0, pass.x; x < width; i, x = i+1, x+pass.dx {
+				copyPixel(row, i, rows[y], x, bitsPerPixel)
+			}
+			if _, err := zw.Write(filterRow(row, prev, maxInt(1, bitsPerPixel/8), adaptive)); err != nil {
+				return nil, err
+			}
+			prev = row
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	ihdr[12] = 1
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	writeChunk(&out, "IHDR", ihdr)
+	for _, chunk := range before {
+		out.Write(chunk)
+	}
+	writeChunk(&out, "IDAT", compressed.Bytes())
+	for _, chunk := range after {
+		out.Write(chunk)
+	}
+	writeChunk(&out, "IEND", nil)
+	return out.Bytes(), nil
+}
+
+// Decompresses the image data of a PNG that isn't interlaced and undoes the filter of each of its rows
+func unfilterRows(idat []byte, width int, height int, bitsPerPixel int) ([][]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(idat))
+	if err != nil {
+		return nil, err
+	}
+	rowLen := (width*bitsPerPixel + 7) / 8
+	bpp := maxInt(1, bitsPerPixel/8)
+	rows := make([][]byte, height)
+	prev := make([]byte, rowLen)
+	for y := range rows {
+		line := make([]byte, 1+rowLen)
+		if _, err := io.ReadFull(zr, line); err != nil {
+			return nil, err
+		}
+		row := line[1:]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			switch line[0] {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += prev[i]
+			case 3:
+				row[i] += byte((int(left) + int(prev[i])) / 2)
+			case 4:
+				row[i] += paeth(left, prev[i], upLeft)
+			default:
+				return nil, fmt.Errorf("interlace: unknown PNG filter %d", line[0])
+			}
+		}
+		rows[y], prev = row, row
+	}
+	return rows, nil
+}
+
+// Returns row preceded by its filter type and filtered against prev, the row above it in the same pass, with each
+// of the 5 PNG filters if adaptive is set, keeping the one whose bytes add up to the least as signed values, or
+// with no filter otherwise
+func filterRow(row []byte, prev []byte, bpp int, adaptive bool) []byte {
+	best := append([]byte{0}, row...)
+	if !adaptive {
+		return best
+	}
+	bestSum := filterCost(best[1:])
+	candidate := make([]byte, 1+len(row))
+	for filter := byte(1); filter <= 4; filter++ {
+		candidate[0] = filter
+		for i, v := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			switch filter {
+			case 1:
+				candidate[1+i] = v - left
+			case 2:
+				candidate[1+i] = v - prev[i]
+			case 3:
+				candidate[1+i] = v - byte((int(left)+int(prev[i]))/2)
+			case 4:
+				candidate[1+i] = v - paeth(left, prev[i], upLeft)
+			}
+		}
+		if sum := filterCost(candidate[1:]); sum < bestSum {
+			best, bestSum = append(best[:0], candidate...), sum
+		}
+	}
+	return best
+}
+
+// Returns the sum of the absolute values of filtered bytes taken as signed, the usual estimate of how well they
+// compress
+func filterCost(filtered []byte) int {
+	sum := 0
+	for _, v := range filtered {
+		if v < 128 {
+			sum += int(v)
+		} else {
+			sum += 256 - int(v)
+		}
+	}
+	return sum
+}
+
+// The Paeth predictor of PNG's filter type 4
+func paeth(a byte, b byte, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// Copies pixel x of src into pixel i of dst, rows of pixels bitsPerPixel bits long
+func copyPixel(dst []byte, i int, src []byte, x int, bitsPerPixel int) {
+	if bitsPerPixel >= 8 {
+		n := bitsPerPixel / 8
+		copy(dst[i*n:i*n+n], src[x*n:x*n+n])
+		return
+	}
+	perByte := 8 / bitsPerPixel
+	mask := byte(1<<bitsPerPixel - 1)
+	v := src[x/perByte] >> (8 - bitsPerPixel*(x%perByte+1)) & mask
+	dst[i/perByte] |= v << (8 - bitsPerPixel*(i%perByte+1))
+}
+
+// Returns the zlib level image/png compresses at for level
+func zlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	}
+	return zlib.DefaultCompression
+}
+
+// Writes a PNG chunk of chunkType holding data, with its length and CRC
+func writeChunk(w io.Writer, chunkType string, data []byte) error {
+	chunk := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	copy(chunk[8:], data)
+	binary.BigEndian.PutUint32(chunk[8+len(data):], crc32.ChecksumIEEE(chunk[4:8+len(data)]))
+	_, err := w.Write(chunk)
+	return err
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package imageio
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Limits bounds the images Load and Decode accept. They are checked against the header before any pixels are
+// decoded, so a small file claiming huge dimensions (a decompression bomb, or just a broken header) fails with an
+// error instead of exhausting memory. Zero fields aren't checked
+type Limits struct {
+	MaxDimension    int   // largest width or height, in pixels
+	MaxDecodedBytes int64 // largest size of the decoded pixels in memory, not counting copies made of them later
+}
+
+// DecodeLimits are the limits every Load and Decode checks. The defaults let through any photo a camera takes
+var DecodeLimits = Limits{MaxDimension: 50000, MaxDecodedBytes: 4 << 30}
+
+// Returns an error if an image with header cfg is over the limits
+func (l Limits) check(cfg image.Config) error {
+	if l.MaxDimension > 0 && (cfg.Width > l.MaxDimension || cfg.Height > l.MaxDimension) {
+		return fmt.Errorf("image is %dx%d, over the limit of %d pixels on a side", cfg.Width, cfg.Height,
+			l.MaxDimension)
+	}
+	if bytes := decodedBytes(cfg); l.MaxDecodedBytes > 0 && bytes > l.MaxDecodedBytes {
+		return fmt.Errorf("image is %dx%d, which would take %d MB decoded, over the limit of %d MB", cfg.Width,
+			cfg.Height, bytes>>20, l.MaxDecodedBytes>>20)
+	}
+	return nil
+}
+
+// Returns the bytes the decoder allocates for the pixels of an image with header cfg. Buffers the caller goes on to
+// make, such as the 16-bit input and output an editor task applies its effects between, aren't part of it
+func decodedBytes(cfg image.Config) int64 {
+	perPixel := int64(4)
+	switch cfg.ColorModel.(type) {
+	case color.Palette:
+		perPixel = 1
+	}
+	switch cfg.ColorModel {
+	case color.GrayModel, color.AlphaModel:
+		perPixel = 1
+	case color.Gray16Model, color.Alpha16Model:
+		perPixel = 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		perPixel = 8
+	}
+	return int64(cfg.Width) * int64(cfg.Height) * perPixel
+}
+
+// Decode decodes an image from r like image.Decode, after checking its header against DecodeLimits
+func Decode(r io.Reader) (image.Image, string, error) {
+	//keep what reading the header consumes, to hand it to the decoder ahead of the rest
+	var header bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, format, err
+	}
+	if err := DecodeLimits.check(cfg); err != nil {
+		return nil, format, err
+	}
+	return image.Decode(io.MultiReader(&header, r))
+}
@@ -0,0 +1,30 @@
+package imageio
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // so Load and Probe recognize gif inputs
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// InputFormats lists the formats Load and Decode recognize, by the names they return
+var InputFormats = []string{"png", "jpeg", "gif"}
+
+// Load decodes the image at path, detecting its format (png, jpeg or gif) from the file header rather than its
+// extension, and returns the image and the format's name. Images over DecodeLimits are refused before their pixels
+// are decoded. Only the first frame of an animated gif is read
+func Load(path string) (image.Image, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	countLoaded(f)
+	img, format, err := Decode(f)
+	if err != nil {
+		return nil, format, fmt.Errorf("%s: %v", path, err)
+	}
+	return img, format, nil
+}
@@ -0,0 +1,39 @@
+package imageio
+
+import (
+	"image"
+	"image/color"
+)
+
+// Returns img as a paletted image holding exactly its colors, at 8 bits per channel, or false if it has more than
+// 256 of them
+func toPaletted(img image.Image) (*image.Paletted, bool) {
+	bounds := img.Bounds()
+	indexes := make(map[color.NRGBA]uint8)
+	var palette color.Palette
+	paletted := image.NewPaletted(bounds, nil)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			index, ok := indexes[c]
+			if !ok {
+				if len(palette) == 256 {
+					return nil, false
+				}
+				index = uint8(len(palette))
+				indexes[c] = index
+				palette = append(palette, c)
+			}
+			paletted.SetColorIndex(x, y, index)
+		}
+	}
+	paletted.Palette = palette
+	return paletted, true
+}
+
+// FitsPalette reports whether img has at most 256 colors at 8 bits per channel, so EncodeOptions.Paletted would save
+// it with a palette
+func FitsPalette(img image.Image) bool {
+	_, ok := toPaletted(img)
+	return ok
+}
@@ -0,0 +1,37 @@
+package imageio
+
+import (
+	"image"
+	"image/color"
+	"os"
+)
+
+// Info holds the properties of an image that can be read from its header
+type Info struct {
+	Format   string `json:"format"` // format name of the decoder, png, jpeg or gif
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	BitDepth int    `json:"bitDepth"`          // bits per channel, 8 or 16
+	Indexed  bool   `json:"indexed,omitempty"` // pixels are indexes into a palette, as in paletted PNGs and GIFs
+}
+
+// Probe reads the format, dimensions and bit depth of the image at path from its header, without decoding its
+// pixels. A successful probe doesn't mean the rest of the file decodes
+func Probe(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return Info{Format: format}, err
+	}
+	info := Info{Format: format, Width: cfg.Width, Height: cfg.Height, BitDepth: 8}
+	_, info.Indexed = cfg.ColorModel.(color.Palette)
+	switch cfg.ColorModel {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model, color.Alpha16Model:
+		info.BitDepth = 16
+	}
+	return info, nil
+}
@@ -0,0 +1,491 @@
+package imageio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// JPEG markers progressiveJPEG reads or writes
+const (
+	markerSOF0 = 0xc0 // start of a baseline frame
+	markerSOF2 = 0xc2 // start of a progressive frame
+	markerDHT  = 0xc4 // Huffman tables
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda // start of a scan
+	markerDRI  = 0xdd // restart interval
+)
+
+// The bands of AC coefficients (in zigzag order) each component is sent in after the DC scan: the low frequencies
+// of luma first, since they make the most of the first passes, then each chroma component, then the rest of luma
+var progressiveBands = []struct{ component, start, end int }{{0, 1, 5}, {1, 1, 63}, {2, 1, 63}, {0, 6, 63}}
+
+// A component of a JPEG frame, with its quantized DCT coefficients
+type jpegComponent struct {
+	id, h, v   int
+	dcTable    int // Huffman table of its DC coefficients
+	acTable    int // Huffman table of its AC coefficients
+	blocksWide int // 8x8 blocks across the component itself
+	blocksHigh int
+	paddedWide int         // blocks across the MCUs that cover it, at least blocksWide
+	blocks     [][64]int32 // coefficients of every block of the padded grid, row by row, in zigzag order
+	predictor  int32       // DC coefficient of the last block decoded or encoded in the current scan
+}
+
+// Returns the baseline JPEG stream data, as image/jpeg writes it, rewritten as a progressive JPEG: the same DCT
+// coefficients, so the same pixels, sent in a scan of every block's DC coefficient followed by scans of bands of
+// AC coefficients, which let a browser show a blurry version of the whole image once the first scan has arrived.
+// The stream's own Huffman tables are reused, so every symbol the scans need must be in them, as it is in the
+// standard tables image/jpeg writes
+func progressiveJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, errors.New("progressive: not a JPEG stream")
+	}
+	var out bytes.Buffer
+	out.Write(data[:2])
+	var components []*jpegComponent
+	var tables [2][4]*huffmanTable //by class, DC then AC, and id
+	var mcusWide, mcusHigh int
+	for pos := 2; ; {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, errors.New("progressive: malformed JPEG segment")
+		}
+		marker := data[pos+1]
+		if marker == markerEOI {
+			break
+		}
+		if pos+4 > len(data) {
+			return nil, errors.New("progressive: truncated JPEG segment")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if pos+2+length > len(data) {
+			return nil, errors.New("progressive: truncated JPEG segment")
+		}
+		segment, payload := data[pos:pos+2+length], data[pos+4:pos+2+length]
+		pos += 2 + length
+		switch marker {
+		case markerSOF0:
+			var err error
+			if components, mcusWide, mcusHigh, err = parseFrame(payload); err != nil {
+				return nil, err
+			}
+			out.Write([]byte{0xff, markerSOF2})
+			out.Write(segment[2:])
+		case markerDHT:
+			if err := parseHuffmanTables(payload, &tables); err != nil {
+				return nil, err
+			}
+			out.Write(segment)
+		case markerDRI:
+			return nil, errors.New("progressive: JPEG streams with restart intervals aren't supported")
+		case markerSOS:
+			if components == nil {
+				return nil, errors.New("progressive: JPEG scan before its frame")
+			}
+			n, err := decodeBaselineScan(data[pos:], payload, components, &tables, mcusWide, mcusHigh)
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			if err := writeProgressiveScans(&out, components, &tables, mcusWide, mcusHigh); err != nil {
+				return nil, err
+			}
+		default:
+			if marker >= 0xc1 && marker <= 0xcf && marker != markerDHT && marker != 0xc8 && marker != 0xcc {
+				return nil, fmt.Errorf("progressive: only baseline JPEG streams can be rewritten, found SOF%d",
+					marker-markerSOF0)
+			}
+			out.Write(segment)
+		}
+	}
+	out.Write([]byte{0xff, markerEOI})
+	return out.Bytes(), nil
+}
+
+// Reads the components of a baseline frame and the number of MCUs across and down the image
+func parseFrame(payload []byte) ([]*jpegComponent, int, int, error) {
+	if len(payload) < 6 || payload[0] != 8 {
+		return nil, 0, 0, errors.New("progressive: only 8 bit JPEG frames are supported")
+	}
+	height, width := int(binary.BigEndian.Uint16(payload[1:])), int(binary.BigEndian.Uint16(payload[3:]))
+	count := int(payload[5])
+	if count < 1 || count > 4 || len(payload) < 6+3*count || width == 0 || height == 0 {
+		return nil, 0, 0, errors.New("progressive: malformed JPEG frame")
+	}
+	components := make([]*jpegComponent, count)
+	hMax, vMax := 1, 1
+	for i := range components {
+		c := payload[6+3*i:]
+		components[i] = &jpegComponent{id: int(c[0]), h: int(c[1] >> 4), v: int(c[1] & 15)}
+		if components[i].h < 1 || components[i].v < 1 || components[i].h > 4 || components[i].v > 4 {
+			return nil, 0, 0, errors.New("progressive: malformed JPEG sampling factors")
+		}
+		hMax, vMax = maxInt(hMax, components[i].h), maxInt(vMax, components[i].v)
+	}
+	mcusWide, mcusHigh := (width+8*hMax-1)/(8*hMax), (height+8*vMax-1)/(8*vMax)
+	for _, c := range components {
+		c.blocksWide = ((width*c.h+hMax-1)/hMax + 7) / 8
+		c.blocksHigh = ((height*c.v+vMax-1)/vMax + 7) / 8
+		c.paddedWide = mcusWide * c.h
+		c.blocks = make([][64]int32, c.paddedWide*mcusHigh*c.v)
+	}
+	return components, mcusWide, mcusHigh, nil
+}
+
+// Decodes the entropy-coded data of the baseline scan with header payload, which starts at data, into the
+// components' blocks. Returns how many bytes of data the scan took, up to the marker following it
+func decodeBaselineScan(data []byte, payload []byte, components []*jpegComponent, tables *[2][4]*huffmanTable,
+	mcusWide int, mcusHigh int) (int, error) {
+	scan, err := scanComponents(payload, components)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) < 1+2*len(scan)+3 || payload[1+2*len(scan)] != 0 || payload[2+2*len(scan)] != 63 {
+		return 0, errors.New("progressive: JPEG scan isn't a baseline scan")
+	}
+	for _, c := range scan {
+		if tables[0][c.dcTable] == nil || tables[1][c.acTable] == nil {
+			return 0, errors.New("progressive: JPEG scan uses an undefined Huffman table")
+		}
+		c.predictor = 0
+	}
+	r := &bitReader{data: data}
+	decodeBlock := func(c *jpegComponent, block *[64]int32) error {
+		size, err := tables[0][c.dcTable].decode(r)
+		if err != nil {
+			return err
+		}
+		diff, err := r.receiveExtend(int(size))
+		if err != nil {
+			return err
+		}
+		c.predictor += diff
+		block[0] = c.predictor
+		for k := 1; k < 64; k++ {
+			symbol, err := tables[1][c.acTable].decode(r)
+			if err != nil {
+				return err
+			}
+			run, size := int(symbol>>4), int(symbol&15)
+			if size == 0 {
+				if run != 15 {
+					break //end of block
+				}
+				k += 15 //a run of 16 zeros
+				continue
+			}
+			k += run
+			if k > 63 {
+				return errors.New("progressive: JPEG block has more than 64 coefficients")
+			}
+			if block[k], err = r.receiveExtend(size); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(scan) == 1 {
+		//a scan of one component goes through its own blocks row by row, leaving out the MCUs' padding
+		c := scan[0]
+		for y := 0; y < c.blocksHigh; y++ {
+			for x := 0; x < c.blocksWide; x++ {
+				if err := decodeBlock(c, &c.blocks[y*c.paddedWide+x]); err != nil {
+					return 0, err
+				}
+			}
+		}
+	} else {
+		for mcuY := 0; mcuY < mcusHigh; mcuY++ {
+			for mcuX := 0; mcuX < mcusWide; mcuX++ {
+				for _, c := range scan {
+					for by := 0; by < c.v; by++ {
+						for bx := 0; bx < c.h; bx++ {
+							i := (mcuY*c.v+by)*c.paddedWide + mcuX*c.h + bx
+							if err := decodeBlock(c, &c.blocks[i]); err != nil {
+								return 0, err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return r.end(), nil
+}
+
+// Returns the components a scan header lists, in order, after setting the Huffman tables they are coded with
+func scanComponents(payload []byte, components []*jpegComponent) ([]*jpegComponent, error) {
+	if len(payload) < 1 || len(payload) < 1+2*int(payload[0]) {
+		return nil, errors.New("progressive: malformed JPEG scan header")
+	}
+	var scan []*jpegComponent
+	for i := 0; i < int(payload[0]); i++ {
+		id, selectors := int(payload[1+2*i]), payload[2+2*i]
+		var found *jpegComponent
+		for _, c := range components {
+			if c.id == id {
+				found = c
+			}
+		}
+		if found == nil || selectors>>4 > 3 || selectors&15 > 3 {
+			return nil, errors.New("progressive: JPEG scan of an unknown component or Huffman table")
+		}
+		found.dcTable, found.acTable = int(selectors>>4), int(selectors&15)
+		scan = append(scan, found)
+	}
+	return scan, nil
+}
+
+// Writes the scans of a progressive JPEG: the DC coefficients of every component interleaved, then the AC
+// coefficients of each component in progressiveBands, with the Huffman tables of the baseline scan
+func writeProgressiveScans(out *bytes.Buffer, components []*jpegComponent, tables *[2][4]*huffmanTable,
+	mcusWide int, mcusHigh int) error {
+	//DC scan
+	header := []byte{byte(len(components))}
+	for _, c := range components {
+		header = append(header, byte(c.id), byte(c.dcTable<<4))
+		c.predictor = 0
+	}
+	writeScanHeader(out, append(header, 0, 0, 0))
+	w := &bitWriter{out: out}
+	encodeDC := func(c *jpegComponent, block *[64]int32) error {
+		diff := block[0] - c.predictor
+		c.predictor = block[0]
+		return w.writeValue(tables[0][c.dcTable], 0, diff)
+	}
+	if len(components) == 1 {
+		c := components[0]
+		for y := 0; y < c.blocksHigh; y++ {
+			for x := 0; x < c.blocksWide; x++ {
+				if err := encodeDC(c, &c.blocks[y*c.paddedWide+x]); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		for mcuY := 0; mcuY < mcusHigh; mcuY++ {
+			for mcuX := 0; mcuX < mcusWide; mcuX++ {
+				for _, c := range components {
+					for by := 0; by < c.v; by++ {
+						for bx := 0; bx < c.h; bx++ {
+							if err := encodeDC(c, &c.blocks[(mcuY*c.v+by)*c.paddedWide+mcuX*c.h+bx]); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	w.flush()
+
+	//AC scans, of a single component each
+	for _, band := range progressiveBands {
+		if band.component >= len(components) {
+			continue
+		}
+		c := components[band.component]
+		writeScanHeader(out, []byte{1, byte(c.id), byte(c.acTable), byte(band.start), byte(band.end), 0})
+		w := &bitWriter{out: out}
+		table := tables[1][c.acTable]
+		for y := 0; y < c.blocksHigh; y++ {
+			for x := 0; x < c.blocksWide; x++ {
+				block := &c.blocks[y*c.paddedWide+x]
+				run := 0
+				for k := band.start; k <= band.end; k++ {
+					if block[k] == 0 {
+						run++
+						continue
+					}
+					for ; run > 15; run -= 16 {
+						if err := w.writeSymbol(table, 0xf0); err != nil {
+							return err
+						}
+					}
+					if err := w.writeValue(table, run, block[k]); err != nil {
+						return err
+					}
+					run = 0
+				}
+				if run > 0 {
+					if err := w.writeSymbol(table, 0x00); err != nil { //an end of band run of one block
+						return err
+					}
+				}
+			}
+		}
+		w.flush()
+	}
+	return nil
+}
+
+// Writes a start of scan segment with payload
+func writeScanHeader(out *bytes.Buffer, payload []byte) {
+	out.Write([]byte{0xff, markerSOS, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+	out.Write(payload)
+}
+
+// A Huffman table of a JPEG stream, for decoding and encoding its symbols
+type huffmanTable struct {
+	symbols []byte      // every symbol, in the order of their codes
+	minCode [17]int32   // first code of each length
+	maxCode [17]int32   // last code of each length, -1 if none are that long
+	first   [17]int     // index in symbols of the first code of each length
+	lengths [256]uint8  // length of the code of each symbol, 0 if the table doesn't have it
+	codes   [256]uint16 // code of each symbol
+}
+
+// Reads the Huffman tables of a DHT segment into tables
+func parseHuffmanTables(payload []byte, tables *[2][4]*huffmanTable) error {
+	for len(payload) > 0 {
+		if len(payload) < 17 || payload[0]>>4 > 1 || payload[0]&15 > 3 {
+			return errors.New("progressive: malformed JPEG Huffman table")
+		}
+		class, id := payload[0]>>4, payload[0]&15
+		total := 0
+		for _, n := range payload[1:17] {
+			total += int(n)
+		}
+		if len(payload) < 17+total {
+			return errors.New("progressive: truncated JPEG Huffman table")
+		}
+		t := &huffmanTable{symbols: payload[17 : 17+total]}
+		code, i := int32(0), 0
+		for length := 1; length <= 16; length++ {
+			count := int(payload[length])
+			t.minCode[length], t.maxCode[length], t.first[length] = code, code+int32(count)-1, i
+			if count == 0 {
+				t.maxCode[length] = -1
+			}
+			for ; count > 0; count-- {
+				t.lengths[t.symbols[i]], t.codes[t.symbols[i]] = uint8(length), uint16(code)
+				code++
+				i++
+			}
+			code <<= 1
+		}
+		tables[class][id] = t
+		payload = payload[17+total:]
+	}
+	return nil
+}
+
+// Reads the next symbol coded with t
+func (t *huffmanTable) decode(r *bitReader) (byte, error) {
+	code := int32(0)
+	for length := 1; length <= 16; length++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | int32(bit)
+		if code <= t.maxCode[length] {
+			return t.symbols[t.first[length]+int(code-t.minCode[length])], nil
+		}
+	}
+	return 0, errors.New("progressive: invalid JPEG Huffman code")
+}
+
+// Reads the bits of JPEG entropy-coded data, skipping the zero bytes stuffed after each 0xff
+type bitReader struct {
+	data []byte
+	pos  int    // index of the next byte to read
+	bits uint32 // bits read from data but not used yet, in the low n bits
+	n    int
+}
+
+func (r *bitReader) readBit() (uint32, error) {
+	if r.n == 0 {
+		if r.pos >= len(r.data) {
+			return 0, errors.New("progressive: truncated JPEG scan")
+		}
+		b := r.data[r.pos]
+		if b == 0xff {
+			if r.pos+1 >= len(r.data) || r.data[r.pos+1] != 0 {
+				return 0, errors.New("progressive: JPEG scan ends before its last block")
+			}
+			r.pos++
+		}
+		r.pos++
+		r.bits, r.n = uint32(b), 8
+	}
+	r.n--
+	return r.bits >> r.n & 1, nil
+}
+
+// Reads a coefficient written as size bits, with negative values offset as JPEG does
+func (r *bitReader) receiveExtend(size int) (int32, error) {
+	v := int32(0)
+	for i := 0; i < size; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | int32(bit)
+	}
+	if size > 0 && v < 1<<(size-1) {
+		v += -1<<size + 1
+	}
+	return v, nil
+}
+
+// Returns the index of the byte following the last byte read, whose unread bits are padding
+func (r *bitReader) end() int {
+	return r.pos
+}
+
+// Writes JPEG entropy-coded data, stuffing a zero byte after each 0xff
+type bitWriter struct {
+	out  *bytes.Buffer
+	bits uint32 // bits not written yet, in the low n bits
+	n    int
+}
+
+func (w *bitWriter) writeBits(bits uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = w.bits<<1 | bits>>i&1
+		w.n++
+		if w.n == 8 {
+			w.out.WriteByte(byte(w.bits))
+			if byte(w.bits) == 0xff {
+				w.out.WriteByte(0)
+			}
+			w.bits, w.n = 0, 0
+		}
+	}
+}
+
+// Writes the code of symbol in t
+func (w *bitWriter) writeSymbol(t *huffmanTable, symbol byte) error {
+	if t.lengths[symbol] == 0 {
+		return fmt.Errorf("progressive: JPEG Huffman table has no code for symbol %#x", symbol)
+	}
+	w.writeBits(uint32(t.codes[symbol]), int(t.lengths[symbol]))
+	return nil
+}
+
+// Writes a coefficient v following run zeros: the symbol of run and v's size in t, then v in size bits
+func (w *bitWriter) writeValue(t *huffmanTable, run int, v int32) error {
+	magnitude, size := v, 0
+	if v < 0 {
+		magnitude = -v
+		v--
+	}
+	for ; magnitude > 0; magnitude >>= 1 {
+		size++
+	}
+	if err := w.writeSymbol(t, byte(run<<4|size)); err != nil {
+		return err
+	}
+	w.writeBits(uint32(v)&(1<<size-1), size)
+	return nil
+}
+
+// Pads the last byte with 1 bits, as scans end
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.writeBits(1<<(8-w.n)-1, 8-w.n)
+	}
+}
@@ -0,0 +1,53 @@
+package imageio
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Returns img with 8 bits per channel, each channel rounded to the nearest 8 bit level where the encoders would
+// truncate its 16 bits. With dither, the rounding error of the red, green and blue of every pixel is diffused to the
+// pixels right of and below it (Floyd-Steinberg), so smooth gradients come out as fine grain rather than bands. The
+// diffused error can push a channel below black or above white, so levels are clamped on both sides
+func quantize8(img image.Image, dither bool) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	//error carried to each channel of the current and the next row, with a pixel of room on each side
+	cur := make([]float64, (bounds.Dx()+2)*3)
+	next := make([]float64, (bounds.Dx()+2)*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			i := (x - bounds.Min.X + 1) * 3
+			var levels [3]uint8
+			for ch, v := range [3]uint16{c.R, c.G, c.B} {
+				wanted := float64(v)/257 + cur[i+ch]
+				level := clampLevel(wanted)
+				levels[ch] = uint8(level)
+				if dither {
+					spread := wanted - level
+					cur[i+ch+3] += spread * 7 / 16
+					next[i+ch-3] += spread * 3 / 16
+					next[i+ch] += spread * 5 / 16
+					next[i+ch+3] += spread * 1 / 16
+				}
+			}
+			out.SetNRGBA(x, y, color.NRGBA{R: levels[0], G: levels[1], B: levels[2],
+				A: uint8(clampLevel(float64(c.A) / 257))})
+		}
+		cur, next = next, cur
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return out
+}
+
+// Returns the 8 bit level nearest to v, which may be negative, above 255 or NaN (taken as 0)
+func clampLevel(v float64) float64 {
+	if !(v > 0) {
+		return 0
+	}
+	return math.Min(255, math.Round(v))
+}
@@ -0,0 +1,124 @@
+package imageio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// RawSidecar describes the layout of a headerless .raw output. It is written next to the blob as <outPath>.json
+type RawSidecar struct {
+	SchemaVersion int               `json:"schemaVersion"` // bumped when a field is renamed, removed or changes meaning
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Channels      int               `json:"channels"`
+	Layout        string            `json:"layout"`
+	DType         string            `json:"dtype"`
+	ByteOrder     string            `json:"byteOrder"`
+	Text          map[string]string `json:"text,omitempty"` // the text a PNG output would have recorded
+}
+
+// Writes img as a NumPy .npy array of shape (height, width, 4) holding little-endian uint16 RGBA values
+func encodeNPY(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	header := fmt.Sprintf("{'descr': '<u2', 'fortran_order': False, 'shape': (%d, %d, 4), }",
+		bounds.Dy(), bounds.Dx())
+
+	//the magic string, version, header length and header must add up to a multiple of 64 bytes, ending in \n
+	preludeLen := 10
+	padding := 64 - (preludeLen+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	for i := 0; i < padding; i++ {
+		header += " "
+	}
+	header += "\n"
+
+	if _, err := w.Write([]byte("\x93NUMPY\x01\x00")); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(header))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	return writeRGBA16(w, img)
+}
+
+// Writes img as a little-endian color Portable Float Map, with rgb values scaled to 0-1. Alpha is dropped since
+// PFM has no alpha channel
+func encodePFM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	if _, err := fmt.Fprintf(w, "PF\n%d %d\n-1.0\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+
+	//PFM stores rows from the bottom of the image to the top
+	row := make([]byte, 12*bounds.Dx())
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			i := 12 * (x - bounds.Min.X)
+			binary.LittleEndian.PutUint32(row[i:], math.Float32bits(float32(c.R)/65535))
+			binary.LittleEndian.PutUint32(row[i+4:], math.Float32bits(float32(c.G)/65535))
+			binary.LittleEndian.PutUint32(row[i+8:], math.Float32bits(float32(c.B)/65535))
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes img as a headerless blob of little-endian uint16 RGBA values, and its layout to sidecarPath
+func encodeRaw(w io.Writer, img image.Image, sidecarPath string, opts EncodeOptions) error {
+	bounds := img.Bounds()
+	sidecar, err := json.MarshalIndent(RawSidecar{
+		SchemaVersion: 1,
+		Width:         bounds.Dx(), Height: bounds.Dy(), Channels: 4,
+		Layout: "RGBA", DType: "uint16", ByteOrder: "little", Text: opts.Text,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := create(sidecarPath, opts)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(sidecar, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return writeRGBA16(w, img)
+}
+
+// Writes the non-premultiplied RGBA values of img row by row as little-endian uint16s
+func writeRGBA16(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	buf := bufio.NewWriter(w)
+	row := make([]byte, 8*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			i := 8 * (x - bounds.Min.X)
+			binary.LittleEndian.PutUint16(row[i:], c.R)
+			binary.LittleEndian.PutUint16(row[i+2:], c.G)
+			binary.LittleEndian.PutUint16(row[i+4:], c.B)
+			binary.LittleEndian.PutUint16(row[i+6:], c.A)
+		}
+		if _, err := buf.Write(row); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
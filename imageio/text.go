@@ -0,0 +1,69 @@
+package imageio
+
+import (
+	"io"
+	"sort"
+)
+
+// Length of the PNG signature plus the IHDR chunk, which must come first. Text chunks are inserted right after it
+const pngHeaderLen = 8 + 12 + 13
+
+// Passes a PNG stream through to w, inserting a text chunk for every entry of text after the IHDR chunk
+type textChunkWriter struct {
+	w       io.Writer
+	text    map[string]string
+	written int
+}
+
+func (t *textChunkWriter) Write(p []byte) (int, error) {
+	if t.written >= pngHeaderLen || t.written+len(p) < pngHeaderLen {
+		t.written += len(p)
+		return t.w.Write(p)
+	}
+
+	//this write completes the header, so the chunks go between its two halves
+	split := pngHeaderLen - t.written
+	n, err := t.w.Write(p[:split])
+	t.written += n
+	if err != nil {
+		return n, err
+	}
+	if err := writeTextChunks(t.w, t.text); err != nil {
+		return n, err
+	}
+	rest, err := t.w.Write(p[split:])
+	t.written += rest
+	return n + rest, err
+}
+
+// Writes a tEXt chunk for every entry of text in keyword order, or an iTXt chunk for text that isn't plain ASCII,
+// since tEXt only holds Latin-1
+func writeTextChunks(w io.Writer, text map[string]string) error {
+	keywords := make([]string, 0, len(text))
+	for keyword := range text {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		chunkType, data := "tEXt", append([]byte(keyword), 0)
+		if !isASCII(text[keyword]) {
+			//no compression, empty language tag and translated keyword
+			chunkType, data = "iTXt", append(data, 0, 0, 0, 0)
+		}
+		data = append(data, text[keyword]...)
+		if err := writeChunk(w, chunkType, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package imageio
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Bytes of the image files read by Load and written by Save so far
+var traffic struct {
+	loaded int64
+	saved  int64
+}
+
+// Traffic returns how many bytes of image files Load has read and Save has written since the process started,
+// counting every file as a whole, including saves that were later replaced such as those over a size budget
+func Traffic() (loaded int64, saved int64) {
+	return atomic.LoadInt64(&traffic.loaded), atomic.LoadInt64(&traffic.saved)
+}
+
+// Adds the size of f, an image file being loaded, to the bytes loaded
+func countLoaded(f *os.File) {
+	if info, err := f.Stat(); err == nil {
+		atomic.AddInt64(&traffic.loaded, info.Size())
+	}
+}
+
+// Adds the bytes written to f so far, an image file being saved, to the bytes saved
+func countSaved(f *os.File) {
+	if n, err := f.Seek(0, io.SeekCurrent); err == nil {
+		atomic.AddInt64(&traffic.saved, n)
+	}
+}
@@ -0,0 +1,115 @@
+package png
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// Largest side of the grid BlurHash averages an image down to before taking its components, which are far too
+// smooth to need more pixels than that
+const blurHashGrid = 64
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash returns the BlurHash (see blurha.sh) of img with xComponents by yComponents (each 1-9) cosine components:
+// a short string web pages decode into a blurred placeholder while the image loads. Images are first averaged down
+// to at most blurHashGrid cells a side, in linear light, so the hash costs about the same for any image size.
+// Alpha is ignored
+func BlurHash(img image.Image, xComponents int, yComponents int) string {
+	bounds := img.Bounds()
+	width, height := minInt(bounds.Dx(), blurHashGrid), minInt(bounds.Dy(), blurHashGrid)
+	if width == 0 || height == 0 {
+		return ""
+	}
+	toLinear := srgbToLinearTable()
+	grid := make([][3]float64, width*height)
+	counts := make([]int, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			cell := &grid[cellY*width+cellX]
+			cell[0] += toLinear[r]
+			cell[1] += toLinear[g]
+			cell[2] += toLinear[b]
+			counts[cellY*width+cellX]++
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i*x)/float64(width)) *
+						math.Cos(math.Pi*float64(j*y)/float64(height))
+					cell := grid[y*width+x]
+					n := float64(counts[y*width+x])
+					for c := range factor {
+						factor[c] += basis * cell[c] / n
+					}
+				}
+			}
+			for c := range factor {
+				factor[c] /= float64(width * height)
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	encodeBase83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, factor := range factors[1:] {
+			for _, v := range factor {
+				actual = math.Max(actual, math.Abs(v))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		encodeBase83(&hash, quantised, 1)
+	} else {
+		encodeBase83(&hash, 0, 1)
+	}
+	dc := factors[0]
+	encodeBase83(&hash, linearToSRGB8(dc[0])<<16|linearToSRGB8(dc[1])<<8|linearToSRGB8(dc[2]), 4)
+	for _, factor := range factors[1:] {
+		var quantised [3]int
+		for c, v := range factor {
+			quantised[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encodeBase83(&hash, quantised[0]*19*19+quantised[1]*19+quantised[2], 2)
+	}
+	return hash.String()
+}
+
+// Writes value as length base 83 digits, most significant first
+func encodeBase83(hash *strings.Builder, value int, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		hash.WriteByte(base83[digit])
+	}
+}
+
+// Returns the 8 bit sRGB level of a linear value, clamped to 0-1, rounded like the reference BlurHash encoder
+func linearToSRGB8(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// Returns |value|^exp with the sign of value
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
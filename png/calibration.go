@@ -0,0 +1,89 @@
+package png
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// FlatField is a flat-field calibration frame (an exposure of an evenly lit target) along with the mean of each of
+// its color channels, which is computed once rather than for every image it corrects
+type FlatField struct {
+	Frame image.Image
+	mean  [3]float64
+}
+
+// NewFlatField computes the channel means of frame
+func NewFlatField(frame image.Image) *FlatField {
+	bounds := frame.Bounds()
+	var sum [3]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := frame.At(x, y).RGBA()
+			sum[0] += float64(r)
+			sum[1] += float64(g)
+			sum[2] += float64(b)
+		}
+	}
+	flat := &FlatField{Frame: frame}
+	numPixels := float64(bounds.Dx() * bounds.Dy())
+	for c := range sum {
+		flat.mean[c] = sum[c] / numPixels
+	}
+	return flat
+}
+
+// SubtractDarkFrame subtracts a dark frame (an exposure taken with the shutter closed, recording the sensor's
+// thermal noise and bias) from each channel, clamping at black. Dark frame values above hotPixel (0-255) are
+// lowered to it first, so a hot pixel that is saturated in the dark frame doesn't leave a black hole in the image.
+// The dark frame is lined up with the image's top left corner, and pixels it doesn't cover are left unchanged
+func (img *Image) SubtractDarkFrame(dark image.Image, hotPixel float64) {
+	bounds := img.out.Bounds()
+	hot := hotPixel * 257
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA()
+			var dr, dg, db uint32
+			if dark != nil {
+				if p := dark.Bounds().Min.Add(image.Pt(x, y)); p.In(dark.Bounds()) {
+					dr, dg, db, _ = dark.At(p.X, p.Y).RGBA()
+				}
+			}
+			img.out.Set(x, y, color.RGBA64{
+				clamp(float64(r) - math.Min(float64(dr), hot)),
+				clamp(float64(g) - math.Min(float64(dg), hot)),
+				clamp(float64(b) - math.Min(float64(db), hot)),
+				uint16(a)})
+		}
+	}
+}
+
+// DivideFlatField corrects vignetting and dust shadows by dividing each channel by the flat-field frame, scaled by
+// the frame's mean so the overall brightness is kept. The frame is lined up with the image's top left corner, and
+// pixels it doesn't cover or where the frame is black are left unchanged
+func (img *Image) DivideFlatField(flat *FlatField) {
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA()
+			v := [3]uint32{r, g, b}
+			var out [3]uint16
+			var f [3]uint32
+			covered := false
+			if flat != nil {
+				if p := flat.Frame.Bounds().Min.Add(image.Pt(x, y)); p.In(flat.Frame.Bounds()) {
+					f[0], f[1], f[2], _ = flat.Frame.At(p.X, p.Y).RGBA()
+					covered = true
+				}
+			}
+			for c := range v {
+				if !covered || f[c] == 0 {
+					out[c] = uint16(v[c])
+				} else {
+					out[c] = clamp(float64(v[c]) * flat.mean[c] / float64(f[c]))
+				}
+			}
+			img.out.Set(x, y, color.RGBA64{out[0], out[1], out[2], uint16(a)})
+		}
+	}
+}
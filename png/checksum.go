@@ -0,0 +1,32 @@
+package png
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// OutputChecksum returns a hash of the output pixels in rows [minY, maxY), clipped to the output's bounds
+func (img *Image) OutputChecksum(minY int, maxY int) uint64 {
+	h := fnv.New64a()
+	bounds := img.out.Bounds()
+	for y := maxInt(minY, bounds.Min.Y); y < minInt(maxY, bounds.Max.Y); y++ {
+		start := img.out.PixOffset(bounds.Min.X, y)
+		h.Write(img.out.Pix[start : start+8*bounds.Dx()])
+	}
+	return h.Sum64()
+}
+
+// Checksum returns a hash of the pixels in rows [minY, maxY) of f, clipped to its bounds
+func (f *FloatImage) Checksum(minY int, maxY int) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 4)
+	for y := maxInt(minY, f.Rect.Min.Y); y < minInt(maxY, f.Rect.Max.Y); y++ {
+		start := f.offset(f.Rect.Min.X, y)
+		for _, v := range f.Pix[start : start+4*f.Rect.Dx()] {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(v))
+			h.Write(buf)
+		}
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,41 @@
+package png
+
+import (
+	"image/color"
+	"math"
+)
+
+// ChromaKey makes pixels close in hue to key transparent, such as the green or blue backdrop of a product photo.
+// Closeness is the distance between the pixels' chroma (the Cb and Cr components of YCbCr, on a 0-255 scale),
+// which ignores brightness so shadows on the backdrop are keyed out too. Pixels within tolerance of the key become
+// fully transparent, pixels further than tolerance+feather keep their alpha, and those in between fade linearly
+// to soften the edges of the subject
+func (img *Image) ChromaKey(key color.Color, tolerance float64, feather float64) {
+	keyCb, keyCr := chroma(key)
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.in.At(x, y)).(color.NRGBA64)
+			cb, cr := chroma(c)
+			distance := math.Hypot(cb-keyCb, cr-keyCr)
+
+			opacity := float64(1)
+			if distance <= tolerance {
+				opacity = 0
+			} else if distance < tolerance+feather {
+				opacity = (distance - tolerance) / feather
+			}
+			c.A = clamp(float64(c.A) * opacity)
+			img.out.Set(x, y, c)
+		}
+	}
+}
+
+// Returns the Cb and Cr components of c on a 0-255 scale, ignoring its alpha
+func chroma(c color.Color) (float64, float64) {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	r, g, b := float64(n.R)/257, float64(n.G)/257, float64(n.B)/257
+	cb := 128 - 0.168736*r - 0.331264*g + 0.5*b
+	cr := 128 + 0.5*r - 0.418688*g - 0.081312*b
+	return cb, cr
+}
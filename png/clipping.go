@@ -0,0 +1,74 @@
+package png
+
+import (
+	"image"
+	"image/color"
+)
+
+// Ways a pixel can be clipped, as flags
+const (
+	ClippedBlack uint8 = 1 << iota // a color channel is at 0
+	ClippedWhite                   // a color channel is at 65535
+)
+
+// Colors the clipping overlay paints clipped pixels in: blue for shadows, red for highlights and magenta for
+// pixels clipped both ways
+var clippingColors = [4]color.RGBA64{
+	ClippedBlack:                {0, 0, 65535, 65535},
+	ClippedWhite:                {65535, 0, 0, 65535},
+	ClippedBlack | ClippedWhite: {65535, 0, 65535, 65535},
+}
+
+// InputClipping returns how every pixel of the image's input is clipped, row by row, for ClippingWarning to tell
+// the pixels the effects clipped from those that already were
+func (img *Image) InputClipping() []uint8 {
+	return clipping(img.in)
+}
+
+// ClippingWarning counts the pixels of the image's output that are clipped to black or to white in a way they
+// weren't in before, the result of InputClipping taken before any effect ran. Fully transparent pixels are never
+// counted. With overlay, the newly clipped pixels are painted in clippingColors, like the clipping warning of a
+// raw converter
+func (img *Image) ClippingWarning(before []uint8, overlay bool) (black int, white int) {
+	bounds := img.out.Bounds()
+	after := clipping(img.out)
+	for i, flags := range after {
+		flags &^= before[i]
+		if flags == 0 {
+			continue
+		}
+		if flags&ClippedBlack != 0 {
+			black++
+		}
+		if flags&ClippedWhite != 0 {
+			white++
+		}
+		if overlay {
+			img.out.SetRGBA64(bounds.Min.X+i%bounds.Dx(), bounds.Min.Y+i/bounds.Dx(), clippingColors[flags])
+		}
+	}
+	return black, white
+}
+
+// Returns how every pixel of m is clipped, row by row
+func clipping(m image.Image) []uint8 {
+	bounds := m.Bounds()
+	flags := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+			var f uint8
+			if c.A != 0 {
+				for _, v := range [3]uint16{c.R, c.G, c.B} {
+					if v == 0 {
+						f |= ClippedBlack
+					} else if v == 65535 {
+						f |= ClippedWhite
+					}
+				}
+			}
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
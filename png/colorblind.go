@@ -0,0 +1,142 @@
+package png
+
+import (
+	"image/color"
+	"math"
+	"sync"
+)
+
+// Deficiency is a kind of dichromatic color vision, named after the type of cone that is missing
+type Deficiency int
+
+const (
+	Protan Deficiency = iota // no long wavelength (red) cones
+	Deutan                   // no medium wavelength (green) cones
+	Tritan                   // no short wavelength (blue) cones
+)
+
+// Matrices from Machado, Oliveira and Fernandes (2009) turning linear rgb into the linear rgb seen with each
+// deficiency at full severity
+var deficiencyMatrices = map[Deficiency][3][3]float64{
+	Protan: {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	Deutan: {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	Tritan: {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// Matrices from Fidaner, Lin and Ozguven (2005) moving the color difference a deficiency loses into channels
+// that are still seen: red differences into green and blue for protan and deutan, blue differences into red and
+// green for tritan
+var daltonizeMatrices = map[Deficiency][3][3]float64{
+	Protan: {{0, 0, 0}, {0.7, 1, 0}, {0.7, 0, 1}},
+	Deutan: {{0, 0, 0}, {0.7, 1, 0}, {0.7, 0, 1}},
+	Tritan: {{1, 0, 0.7}, {0, 1, 0.7}, {0, 0, 0}},
+}
+
+// SimulateColorBlindness shows the image as seen with deficiency d. Severity goes from 0 (normal vision) to 1
+// (dichromacy), blending the full severity matrix with the identity in between, which approximates anomalous
+// trichromacy. Colors are converted to linear rgb for the simulation and alpha is kept
+func (img *Image) SimulateColorBlindness(d Deficiency, severity float64) {
+	m := severityMatrix(d, severity)
+	img.mapLinearColors(func(c [3]float64) [3]float64 {
+		return applyMatrix(m, c)
+	})
+}
+
+// Daltonize recolors the image so details lost to deficiency d (at the given severity, see SimulateColorBlindness)
+// become visible again, by adding the difference between each color and its simulation back into channels people
+// with the deficiency still see. Alpha is kept
+func (img *Image) Daltonize(d Deficiency, severity float64) {
+	m := severityMatrix(d, severity)
+	shift := daltonizeMatrices[d]
+	img.mapLinearColors(func(c [3]float64) [3]float64 {
+		simulated := applyMatrix(m, c)
+		lost := [3]float64{c[0] - simulated[0], c[1] - simulated[1], c[2] - simulated[2]}
+		correction := applyMatrix(shift, lost)
+		return [3]float64{c[0] + correction[0], c[1] + correction[1], c[2] + correction[2]}
+	})
+}
+
+// Returns the simulation matrix of d blended with the identity by severity
+func severityMatrix(d Deficiency, severity float64) [3][3]float64 {
+	full := deficiencyMatrices[d]
+	var m [3][3]float64
+	for row := range m {
+		for col := range m[row] {
+			identity := float64(0)
+			if row == col {
+				identity = 1
+			}
+			m[row][col] = identity + severity*(full[row][col]-identity)
+		}
+	}
+	return m
+}
+
+func applyMatrix(m [3][3]float64, c [3]float64) [3]float64 {
+	var out [3]float64
+	for row := range out {
+		out[row] = m[row][0]*c[0] + m[row][1]*c[1] + m[row][2]*c[2]
+	}
+	return out
+}
+
+// Replaces the color of every pixel by f of its linear rgb values (0-1), keeping its alpha. Results outside of
+// 0-1 are clamped
+func (img *Image) mapLinearColors(f func(c [3]float64) [3]float64) {
+	toLinear := srgbToLinearTable()
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.in.At(x, y)).(color.NRGBA64)
+			mapped := f([3]float64{toLinear[c.R], toLinear[c.G], toLinear[c.B]})
+			img.out.Set(x, y, color.NRGBA64{
+				linearToSRGB(mapped[0]), linearToSRGB(mapped[1]), linearToSRGB(mapped[2]), c.A})
+		}
+	}
+}
+
+var srgbTable struct {
+	once   sync.Once
+	values []float64
+}
+
+// Returns the linear value (0-1) of every 16-bit sRGB level, computed the first time it is needed
+func srgbToLinearTable() []float64 {
+	srgbTable.once.Do(func() {
+		srgbTable.values = make([]float64, 65536)
+		for v := range srgbTable.values {
+			s := float64(v) / 65535
+			if s <= 0.04045 {
+				srgbTable.values[v] = s / 12.92
+			} else {
+				srgbTable.values[v] = math.Pow((s+0.055)/1.055, 2.4)
+			}
+		}
+	})
+	return srgbTable.values
+}
+
+// Returns the 16-bit sRGB level of a linear value, clamped to 0-1
+func linearToSRGB(l float64) uint16 {
+	if l <= 0 {
+		return 0
+	} else if l >= 1 {
+		return 65535
+	}
+	if l <= 0.0031308 {
+		return clamp(l * 12.92 * 65535)
+	}
+	return clamp((1.055*math.Pow(l, 1/2.4) - 0.055) * 65535)
+}
@@ -0,0 +1,44 @@
+package png
+
+import (
+	"hash/fnv"
+	"image"
+	"image/draw"
+)
+
+// GetSubImgRect returns the input pixels inside r, clipped to the input's bounds, like GetSubImg does for a band of
+// rows. It is a view of the input where the input's type allows it, and a copy otherwise
+func (img *Image) GetSubImgRect(r image.Rectangle) image.Image {
+	r = r.Intersect(img.in.Bounds())
+	if sub, ok := img.in.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	copied := image.NewRGBA64(r)
+	draw.Draw(copied, r, img.in, r.Min, draw.Src)
+	return copied
+}
+
+// UseSubsetRect copies the output pixels of sub inside r into the image's output, like UseSubsetImg does for a
+// band of rows
+func (img *Image) UseSubsetRect(sub *Image, r image.Rectangle) {
+	r = r.Intersect(img.out.Bounds()).Intersect(sub.out.Bounds())
+	draw.Draw(img.out, r, sub.out, r.Min, draw.Src)
+}
+
+// OutputColumnsChecksum returns a hash of the output pixels in columns [minX, maxX), clipped to the output's
+// bounds, like OutputChecksum does for rows
+func (img *Image) OutputColumnsChecksum(minX int, maxX int) uint64 {
+	h := fnv.New64a()
+	bounds := img.out.Bounds()
+	minX, maxX = maxInt(minX, bounds.Min.X), minInt(maxX, bounds.Max.X)
+	if minX >= maxX {
+		return h.Sum64()
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		start := img.out.PixOffset(minX, y)
+		h.Write(img.out.Pix[start : start+8*(maxX-minX)])
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,125 @@
+package png
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// PSNR returns the peak signal-to-noise ratio in decibels between the rgb values of a and b, which must have
+// the same size. Identical images return +Inf
+func PSNR(a image.Image, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	squaredError := float64(0)
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			for _, d := range [3]float64{float64(r1) - float64(r2), float64(g1) - float64(g2), float64(b1) - float64(b2)} {
+				squaredError += d * d
+			}
+		}
+	}
+	if squaredError == 0 {
+		return math.Inf(1)
+	}
+	meanSquaredError := squaredError / float64(3*ab.Dx()*ab.Dy())
+	return 10 * math.Log10(65535*65535/meanSquaredError)
+}
+
+// SSIM returns the mean structural similarity index between the luminance of a and b, which must have the same
+// size. It is computed over 8x8 windows every 4 pixels and is 1 for identical images
+func SSIM(a image.Image, b image.Image) float64 {
+	const window = 8
+	const step = 4
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	const c2 = (0.03 * 255) * (0.03 * 255)
+
+	width, height := a.Bounds().Dx(), a.Bounds().Dy()
+	lumaA, lumaB := luminance(a), luminance(b)
+
+	//images smaller than a window are compared as a single window
+	windowW, windowH := window, window
+	if width < windowW {
+		windowW = width
+	}
+	if height < windowH {
+		windowH = height
+	}
+
+	total, count := float64(0), 0
+	for y0 := 0; y0+windowH <= height; y0 += step {
+		for x0 := 0; x0+windowW <= width; x0 += step {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+windowH; y++ {
+				for x := x0; x < x0+windowW; x++ {
+					va, vb := lumaA[y*width+x], lumaB[y*width+x]
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+				}
+			}
+			n := float64(windowW * windowH)
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			covariance := sumAB/n - meanA*meanB
+			total += ((2*meanA*meanB + c1) * (2*covariance + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			count++
+		}
+	}
+	if count == 0 {
+		return 1
+	}
+	return total / float64(count)
+}
+
+// Returns the luminance of every pixel of img on a 0-255 scale, in row-major order
+func luminance(img image.Image) []float64 {
+	bounds := img.Bounds()
+	luma := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			luma = append(luma, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257)
+		}
+	}
+	return luma
+}
+
+// Colors of DiffImage, from identical pixels to large differences
+var (
+	diffIdentical = color.RGBA{0, 160, 0, 255}
+	diffSmall     = color.RGBA{255, 210, 0, 255}
+	diffLarge     = color.RGBA{220, 0, 0, 255}
+)
+
+// DiffImage returns an image of the same size as a and b where each pixel shows how much they differ there:
+// green where they are identical, yellow where no channel (alpha included) differs by more than smallDiff on a
+// 0-255 scale, and red elsewhere, so that scattered mismatches stand out at a glance
+func DiffImage(a image.Image, b image.Image, smallDiff float64) *image.RGBA {
+	ab, bb := a.Bounds(), b.Bounds()
+	diff := image.NewRGBA(image.Rect(0, 0, ab.Dx(), ab.Dy()))
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			largest := float64(0)
+			for _, d := range [4]float64{
+				float64(r1) - float64(r2), float64(g1) - float64(g2), float64(b1) - float64(b2), float64(a1) - float64(a2)} {
+				largest = math.Max(largest, math.Abs(d)/257)
+			}
+			if largest == 0 {
+				diff.SetRGBA(x, y, diffIdentical)
+			} else if largest <= smallDiff {
+				diff.SetRGBA(x, y, diffSmall)
+			} else {
+				diff.SetRGBA(x, y, diffLarge)
+			}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,136 @@
+package png
+
+import (
+	"image"
+)
+
+// Width and height of the square blocks 3x3 convolutions are computed in. A block's input window and output
+// rows are small enough to stay in cache while the block is processed
+const blockSize = 64
+
+// Applies a 3x3 kernel to the image, reading out of bounds pixels as Edges says and
+// keeping the alpha value of each center pixel. The image is processed in blockSize x blockSize blocks. The input of each block plus a 1 pixel
+// border is first copied into a window buffer reused by every block, so each input pixel is fetched about once
+// instead of once per kernel weight, and the kernel only reads from memory that was just touched
+func (img *Image) convolve3x3(kernel [3][3]float64) {
+	const windowSize = blockSize + 2
+	const windowStride = 4 * windowSize
+	window := make([]uint16, windowStride*windowSize)
+	bounds := img.out.Bounds()
+	debugColor, low, high, debug := kernelDebugRange()
+
+	//flip the kernel horizontal and vertical ways, as defined by
+	//http://www.songho.ca/dsp/convolution/convolution2d_example.html, naming each weight after the window row
+	//(above, center, below) and column (left, middle, right) it multiplies
+	aboveLeft, centerLeft, belowLeft := kernel[2][2], kernel[2][1], kernel[2][0]
+	aboveMiddle, centerMiddle, belowMiddle := kernel[1][2], kernel[1][1], kernel[1][0]
+	aboveRight, centerRight, belowRight := kernel[0][2], kernel[0][1], kernel[0][0]
+
+	for blockY := bounds.Min.Y; blockY < bounds.Max.Y; blockY += blockSize {
+		maxY := minInt(blockY+blockSize, bounds.Max.Y)
+		for blockX := bounds.Min.X; blockX < bounds.Max.X; blockX += blockSize {
+			maxX := minInt(blockX+blockSize, bounds.Max.X)
+			img.fillWindow(window, windowStride, image.Rect(blockX-1, blockY-1, maxX+1, maxY+1))
+
+			for y := blockY; y < maxY; y++ {
+				//precompute the three window rows and the output row, so the inner loop only indexes short
+				//slices with constant offsets and the compiler can drop its bounds checks
+				rowStart := (y - blockY + 1) * windowStride
+				above := window[rowStart-windowStride : rowStart]
+				center := window[rowStart : rowStart+windowStride]
+				below := window[rowStart+windowStride : rowStart+2*windowStride]
+				outStart := img.out.PixOffset(blockX, y)
+				outRow := img.out.Pix[outStart : outStart+8*(maxX-blockX)]
+
+				for x := 0; x < maxX-blockX; x++ {
+					i := 4 * x
+					a := above[i : i+12 : i+12]
+					c := center[i : i+12 : i+12]
+					b := below[i : i+12 : i+12]
+					o := outRow[8*x : 8*x+8 : 8*x+8]
+
+					red := aboveLeft*float64(a[0]) + centerLeft*float64(c[0]) + belowLeft*float64(b[0]) +
+						aboveMiddle*float64(a[4]) + centerMiddle*float64(c[4]) + belowMiddle*float64(b[4]) +
+						aboveRight*float64(a[8]) + centerRight*float64(c[8]) + belowRight*float64(b[8])
+					green := aboveLeft*float64(a[1]) + centerLeft*float64(c[1]) + belowLeft*float64(b[1]) +
+						aboveMiddle*float64(a[5]) + centerMiddle*float64(c[5]) + belowMiddle*float64(b[5]) +
+						aboveRight*float64(a[9]) + centerRight*float64(c[9]) + belowRight*float64(b[9])
+					blue := aboveLeft*float64(a[2]) + centerLeft*float64(c[2]) + belowLeft*float64(b[2]) +
+						aboveMiddle*float64(a[6]) + centerMiddle*float64(c[6]) + belowMiddle*float64(b[6]) +
+						aboveRight*float64(a[10]) + centerRight*float64(c[10]) + belowRight*float64(b[10])
+
+					if debug && (outOfRange(red, low, high) || outOfRange(green, low, high) || outOfRange(blue, low, high)) {
+						putRGBA64(o, debugColor.R, debugColor.G, debugColor.B, debugColor.A)
+						continue
+					}
+					putRGBA64(o, clamp(red), clamp(green), clamp(blue), c[7])
+				}
+			}
+		}
+	}
+}
+
+// Copies the input pixels in rect into window (stride values per row, 4 values per pixel), reading pixels
+// outside of the input's bounds as Edges says: as 0, from the opposite edge or from the nearest edge pixel. Reads
+// the pixel buffer directly when the input is an *image.RGBA64, and then copies the part of each row inside the
+// input's bounds without any edge checks, leaving them to the few columns past the left and right edges
+func (img *Image) fillWindow(window []uint16, stride int, rect image.Rectangle) {
+	inBounds := img.in.Bounds()
+	rgba64, isRGBA64 := img.in.(*image.RGBA64)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := window[(y-rect.Min.Y)*stride : (y-rect.Min.Y+1)*stride]
+		inY, inRow := edgeRow(y, inBounds.Min.Y, inBounds.Max.Y)
+		interiorMin, interiorMax := rect.Max.X, rect.Max.X //columns copied directly, none unless the row is in bounds
+		if isRGBA64 && inRow {
+			interiorMin = minInt(maxInt(rect.Min.X, inBounds.Min.X), rect.Max.X)
+			interiorMax = maxInt(interiorMin, minInt(rect.Max.X, inBounds.Max.X))
+			start := rgba64.PixOffset(interiorMin, inY)
+			src := rgba64.Pix[start : start+8*(interiorMax-interiorMin)]
+			dst := row[4*(interiorMin-rect.Min.X) : 4*(interiorMax-rect.Min.X)]
+			for x := 0; x < interiorMax-interiorMin; x++ {
+				s := src[8*x : 8*x+8 : 8*x+8]
+				p := dst[4*x : 4*x+4 : 4*x+4]
+				p[0] = uint16(s[0])<<8 | uint16(s[1])
+				p[1] = uint16(s[2])<<8 | uint16(s[3])
+				p[2] = uint16(s[4])<<8 | uint16(s[5])
+				p[3] = uint16(s[6])<<8 | uint16(s[7])
+			}
+		}
+		for windowX := rect.Min.X; windowX < rect.Max.X; windowX++ {
+			if windowX >= interiorMin && windowX < interiorMax {
+				continue
+			}
+			p := row[4*(windowX-rect.Min.X) : 4*(windowX-rect.Min.X)+4 : 4*(windowX-rect.Min.X)+4]
+			x, inX := edgeColumn(windowX, inBounds.Min.X, inBounds.Max.X)
+			if !inX || !inRow {
+				p[0], p[1], p[2], p[3] = 0, 0, 0, 0
+			} else if isRGBA64 {
+				s := rgba64.Pix[rgba64.PixOffset(x, inY):]
+				s = s[:8:8]
+				p[0] = uint16(s[0])<<8 | uint16(s[1])
+				p[1] = uint16(s[2])<<8 | uint16(s[3])
+				p[2] = uint16(s[4])<<8 | uint16(s[5])
+				p[3] = uint16(s[6])<<8 | uint16(s[7])
+			} else {
+				r, g, b, a := img.in.At(x, inY).RGBA()
+				p[0], p[1], p[2], p[3] = uint16(r), uint16(g), uint16(b), uint16(a)
+			}
+		}
+	}
+}
+
+// Writes a pixel into 8 bytes of an *image.RGBA64 pixel buffer
+func putRGBA64(pix []uint8, r uint16, g uint16, b uint16, a uint16) {
+	pix = pix[:8:8]
+	pix[0], pix[1] = uint8(r>>8), uint8(r)
+	pix[2], pix[3] = uint8(g>>8), uint8(g)
+	pix[4], pix[5] = uint8(b>>8), uint8(b)
+	pix[6], pix[7] = uint8(a>>8), uint8(a)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,77 @@
+package png
+
+import (
+	"image"
+	"testing"
+
+	"proj2/png/kernel"
+)
+
+// Side of the square test image, a few blocks wide and not a multiple of blockSize, so partial blocks are covered
+const testImageSize = 300
+
+// Returns a testImageSize x testImageSize image filled with a fixed pseudo-random pattern, the same on every run
+func testImage() *Image {
+	in := image.NewRGBA64(image.Rect(0, 0, testImageSize, testImageSize))
+	seed := uint32(1)
+	for i := range in.Pix {
+		seed = seed*1664525 + 1013904223
+		in.Pix[i] = uint8(seed >> 24)
+	}
+	return NewImg(in)
+}
+
+// Returns the 3x3 kernel k as a 5x5 kernel with a ring of zeros around it, which computes the same sums but takes
+// Convolve's generic path instead of convolve3x3
+func padded(k [3][3]float64) kernel.Kernel {
+	p := kernel.New(5)
+	for row := range k {
+		for col := range k[row] {
+			p[row+1][col+1] = k[row][col]
+		}
+	}
+	return p
+}
+
+func toKernel(k [3][3]float64) kernel.Kernel {
+	return kernel.Kernel{k[0][:], k[1][:], k[2][:]}
+}
+
+func TestConvolve3x3MatchesGeneric(t *testing.T) {
+	defer func(edges EdgeMode) { Edges = edges }(Edges)
+	for _, edges := range []EdgeMode{EdgeZero, EdgeWrapX, EdgeExtend} {
+		Edges = edges
+		for name, k := range map[string][3][3]float64{"sharpen": sharpenKernel, "edge": edgeDetectKernel, "blur": blurKernel} {
+			fast, generic := testImage(), testImage()
+			fast.Convolve(toKernel(k))
+			generic.Convolve(padded(k))
+			//the two paths add the weighted pixels in different orders, so a sum can round the other way
+			for i := 0; i < len(fast.out.Pix); i += 2 {
+				v := int(fast.out.Pix[i])<<8 | int(fast.out.Pix[i+1])
+				w := int(generic.out.Pix[i])<<8 | int(generic.out.Pix[i+1])
+				if v-w > 1 || w-v > 1 {
+					t.Fatalf("edges %v, %s: channel %d is %d with convolve3x3 and %d with the generic path", edges,
+						name, i/2, v, w)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkConvolve3x3(b *testing.B) {
+	img := testImage()
+	k := toKernel(sharpenKernel)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		img.Convolve(k)
+	}
+}
+
+func BenchmarkConvolveGeneric(b *testing.B) {
+	img := testImage()
+	k := padded(sharpenKernel)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		img.Convolve(k)
+	}
+}
@@ -0,0 +1,122 @@
+package png
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+// CurvePoint is a control point of a tone curve, mapping input level In to output level Out. Both are on the
+// 0-255 scale used by photo editors regardless of the image's bit depth
+type CurvePoint struct {
+	In  float64
+	Out float64
+}
+
+// Curves remaps the image's tones through curves defined by control points. Each channel first goes through its
+// own curve (red, green or blue) and then through the rgb curve shared by all channels. Curves with fewer than
+// two points leave the channel unchanged. Points are joined by a monotone cubic spline, so a curve whose points
+// never decrease never inverts tones
+func (img *Image) Curves(rgb []CurvePoint, red []CurvePoint, green []CurvePoint, blue []CurvePoint) {
+	combined := curveLUT(rgb)
+	var luts [3][]uint16
+	for c, points := range [3][]CurvePoint{red, green, blue} {
+		channel := curveLUT(points)
+		luts[c] = make([]uint16, 65536)
+		for v := range luts[c] {
+			luts[c][v] = combined[channel[v]]
+		}
+	}
+
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA()
+			img.out.Set(x, y, color.RGBA64{luts[0][r], luts[1][g], luts[2][b], uint16(a)})
+		}
+	}
+}
+
+// Builds a lookup table from every 16-bit level to its value on the curve through points
+func curveLUT(points []CurvePoint) []uint16 {
+	lut := make([]uint16, 65536)
+	if len(points) < 2 {
+		for v := range lut {
+			lut[v] = uint16(v)
+		}
+		return lut
+	}
+
+	sorted := append([]CurvePoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].In < sorted[j].In })
+	tangents := monotoneTangents(sorted)
+
+	first, last := sorted[0], sorted[len(sorted)-1]
+	segment := 0
+	for v := range lut {
+		level := float64(v) / 257 // 16-bit level on the 0-255 scale of the control points
+		var out float64
+		if level <= first.In {
+			out = first.Out
+		} else if level >= last.In {
+			out = last.Out
+		} else {
+			for sorted[segment+1].In < level {
+				segment++
+			}
+			p0, p1 := sorted[segment], sorted[segment+1]
+			h := p1.In - p0.In
+			t := (level - p0.In) / h
+
+			//cubic Hermite basis functions
+			h00 := 2*t*t*t - 3*t*t + 1
+			h10 := t*t*t - 2*t*t + t
+			h01 := -2*t*t*t + 3*t*t
+			h11 := t*t*t - t*t
+			out = h00*p0.Out + h10*h*tangents[segment] + h01*p1.Out + h11*h*tangents[segment+1]
+		}
+		lut[v] = clamp(out * 257)
+	}
+	return lut
+}
+
+// Computes the tangent at each control point with the Fritsch-Carlson method, which keeps the spline monotone
+// between points whose outputs are monotone
+func monotoneTangents(points []CurvePoint) []float64 {
+	n := len(points)
+	slopes := make([]float64, n-1)
+	for i := 0; i < n-1; i++ {
+		dx := points[i+1].In - points[i].In
+		if dx == 0 {
+			continue
+		}
+		slopes[i] = (points[i+1].Out - points[i].Out) / dx
+	}
+
+	tangents := make([]float64, n)
+	tangents[0] = slopes[0]
+	tangents[n-1] = slopes[n-2]
+	for i := 1; i < n-1; i++ {
+		if slopes[i-1]*slopes[i] <= 0 {
+			tangents[i] = 0
+		} else {
+			tangents[i] = (slopes[i-1] + slopes[i]) / 2
+		}
+	}
+
+	//scale back tangents that would overshoot and break monotonicity
+	for i := 0; i < n-1; i++ {
+		if slopes[i] == 0 {
+			tangents[i], tangents[i+1] = 0, 0
+			continue
+		}
+		alpha := tangents[i] / slopes[i]
+		beta := tangents[i+1] / slopes[i]
+		if sum := alpha*alpha + beta*beta; sum > 9 {
+			tau := 3 / math.Sqrt(sum)
+			tangents[i] = tau * alpha * slopes[i]
+			tangents[i+1] = tau * beta * slopes[i]
+		}
+	}
+	return tangents
+}
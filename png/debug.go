@@ -0,0 +1,28 @@
+package png
+
+import "image/color"
+
+// KernelDebug makes the kernel effects (Sharpen, EdgeDetect, Blur and Convolve) paint a pixel in Color, fully
+// opaque, when any of its channels comes out NaN or infinite, or is clamped by more than ClampThreshold (on a
+// 0-255 scale), which makes numerically unstable kernels easy to spot. It is off while Color is nil, and must not
+// be changed while effects run
+var KernelDebug struct {
+	Color          color.Color
+	ClampThreshold float64
+}
+
+// Returns the debug color as a pixel, and the lowest and highest channel values that aren't flagged. ok is false
+// if debugging is off
+func kernelDebugRange() (debug color.RGBA64, low float64, high float64, ok bool) {
+	if KernelDebug.Color == nil {
+		return color.RGBA64{}, 0, 0, false
+	}
+	r, g, b, _ := KernelDebug.Color.RGBA()
+	threshold := KernelDebug.ClampThreshold * 257
+	return color.RGBA64{uint16(r), uint16(g), uint16(b), 65535}, -threshold, 65535 + threshold, true
+}
+
+// Returns true if v is NaN, infinite or outside of [low, high]
+func outOfRange(v float64, low float64, high float64) bool {
+	return !(v >= low && v <= high)
+}
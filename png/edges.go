@@ -0,0 +1,79 @@
+package png
+
+import "image"
+
+// EdgeMode is how the kernel effects (Sharpen, EdgeDetect, Blur, EdgeThin and Convolve, including their float32
+// versions) and Undistort read pixels past the edges of the image
+type EdgeMode int
+
+const (
+	// Pixels past every edge are 0, which darkens borders
+	EdgeZero EdgeMode = iota
+	// Pixels past the left and right edges are read from the opposite edge, so the seam of a 360 degree
+	// equirectangular panorama doesn't show. Pixels past the top and bottom edges are still 0
+	EdgeWrapX
+	// Pixels past every edge repeat the nearest edge pixel, so borders keep their brightness. Images only a pixel
+	// wide or tall just repeat that pixel
+	EdgeExtend
+)
+
+// Edges is the EdgeMode of every kernel effect. Strips are padded with the rows or columns their kernels reach, and
+// images are only split into columns when it isn't EdgeWrapX, so it holds when effects are decomposed too. It must
+// not be changed while effects run
+var Edges EdgeMode
+
+// Returns the column kernel effects read for column x of an image spanning columns [minX, maxX), and false if
+// they read 0 there
+func edgeColumn(x int, minX int, maxX int) (int, bool) {
+	if x >= minX && x < maxX {
+		return x, true
+	}
+	switch Edges {
+	case EdgeWrapX:
+		width := maxX - minX
+		return minX + ((x-minX)%width+width)%width, true
+	case EdgeExtend:
+		return clampIndex(x, minX, maxX), true
+	}
+	return x, false
+}
+
+// Returns the row kernel effects read for row y of an image spanning rows [minY, maxY), and false if they read 0
+// there
+func edgeRow(y int, minY int, maxY int) (int, bool) {
+	if y >= minY && y < maxY {
+		return y, true
+	}
+	if Edges == EdgeExtend {
+		return clampIndex(y, minY, maxY), true
+	}
+	return y, false
+}
+
+// Splits rows [minY, maxY) of an image with bounds into spans of pixels, calling span for each in order: those
+// whose kernels, reaching radius pixels around them, stay inside bounds (inside true) and the thin borders where
+// they reach past an edge. Kernel effects then only check edges in the borders, and read the interior directly
+func rowSpans(bounds image.Rectangle, minY int, maxY int, radius int,
+	span func(y int, minX int, maxX int, inside bool)) {
+	innerMinX, innerMaxX := bounds.Min.X+radius, bounds.Max.X-radius
+	for y := minY; y < maxY; y++ {
+		if y < bounds.Min.Y+radius || y >= bounds.Max.Y-radius || innerMinX >= innerMaxX {
+			span(y, bounds.Min.X, bounds.Max.X, false)
+			continue
+		}
+		span(y, bounds.Min.X, innerMinX, false)
+		span(y, innerMinX, innerMaxX, true)
+		span(y, innerMaxX, bounds.Max.X, false)
+	}
+}
+
+// Returns the index in [min, max) nearest to i
+func clampIndex(i int, min int, max int) int {
+	if i < min {
+		return min
+	}
+	if i >= max {
+		return max - 1
+	}
+	return i
+}
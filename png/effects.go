@@ -5,8 +5,29 @@ package png
 import (
 	"image"
 	"image/color"
+	"math"
+	"proj2/png/kernel"
 )
 
+// Kernels shared by the Image and FloatImage versions of each effect
+var sharpenKernel = [3][3]float64{
+	{0, -1, 0},
+	{-1, 5, -1},
+	{0, -1, 0},
+}
+
+var edgeDetectKernel = [3][3]float64{
+	{-1, -1, -1},
+	{-1, 8, -1},
+	{-1, -1, -1},
+}
+
+var blurKernel = [3][3]float64{
+	{1.0 / 9.0, 1.0 / 9.0, 1.0 / 9.0},
+	{1.0 / 9.0, 1.0 / 9.0, 1.0 / 9.0},
+	{1.0 / 9.0, 1.0 / 9.0, 1.0 / 9.0},
+}
+
 // Grayscale applies a grayscale filtering effect to the image
 func (img *Image) Grayscale() {
 	bounds := img.out.Bounds()
@@ -21,82 +42,326 @@ func (img *Image) Grayscale() {
 
 // Performs a sharpen effect
 func (img *Image) Sharpen() {
-	kernel := [3][3]float64{
-		{0, -1, 0},
-		{-1, 5, -1},
-		{0, -1, 0},
+	img.convolve3x3(sharpenKernel)
+}
+
+//Performs a edge-detection effect
+func (img *Image) EdgeDetect(){
+	img.convolve3x3(edgeDetectKernel)
+}
+
+//Performs a blur effect
+func (img *Image) Blur(){
+	img.convolve3x3(blurKernel)
+}
+
+// EdgeThin performs a gradient-based (Sobel) edge detection followed by non-maximum suppression,
+// so that detected edges come out one pixel wide
+func (img *Image) EdgeThin() {
+	kernelX := [3][3]float64{
+		{-1, 0, 1},
+		{-2, 0, 2},
+		{-1, 0, 1},
+	}
+	kernelY := [3][3]float64{
+		{-1, -2, -1},
+		{0, 0, 0},
+		{1, 2, 1},
 	}
 
 	bounds := img.out.Bounds()
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			v := img.kernelApply(x, y, kernel, bounds)
-			img.out.Set(x, y, color.RGBA64{v[0], v[1], v[2], v[3]})
+	width, height := bounds.Dx(), bounds.Dy()
+	magnitude := make([]float64, width*height)
+	direction := make([]int, width*height)
+
+	//first pass computes the gradient magnitude and its direction rounded to one of 4 sectors
+	rowSpans(bounds, bounds.Min.Y, bounds.Max.Y, 1, func(y int, minX int, maxX int, inside bool) {
+		for x := minX; x < maxX; x++ {
+			var gx, gy float64
+			if inside {
+				gx, gy = img.lumaKernelSum(x, y, kernelX), img.lumaKernelSum(x, y, kernelY)
+			} else {
+				gx, gy = img.lumaKernelApply(x, y, kernelX, bounds), img.lumaKernelApply(x, y, kernelY, bounds)
+			}
+			i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+			magnitude[i] = math.Hypot(gx, gy)
+
+			angle := math.Atan2(gy, gx) * 180 / math.Pi
+			if angle < 0 {
+				angle += 180
+			}
+			direction[i] = int((angle+22.5)/45) % 4
+		}
+	})
+
+	//second pass keeps a pixel only if it is the maximum along its gradient direction
+	neighbours := [4][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}}
+	at := func(x int, y int) float64 {
+		x, inX := edgeColumn(x, 0, width)
+		y, inY := edgeRow(y, 0, height)
+		if !inX || !inY {
+			return 0
 		}
+		return magnitude[y*width+x]
 	}
+	rowSpans(image.Rect(0, 0, width, height), 0, height, 1, func(y int, minX int, maxX int, inside bool) {
+		for x := minX; x < maxX; x++ {
+			i := y*width + x
+			d := neighbours[direction[i]]
+			v := magnitude[i]
+			if inside {
+				if v < magnitude[i+d[1]*width+d[0]] || v < magnitude[i-d[1]*width-d[0]] {
+					v = 0
+				}
+			} else if v < at(x+d[0], y+d[1]) || v < at(x-d[0], y-d[1]) {
+				v = 0
+			}
+			_, _, _, a := img.in.At(x+bounds.Min.X, y+bounds.Min.Y).RGBA()
+			edge := clamp(v)
+			img.out.Set(x+bounds.Min.X, y+bounds.Min.Y, color.RGBA64{edge, edge, edge, uint16(a)})
+		}
+	})
 }
 
-//Performs a edge-detection effect
-func (img *Image) EdgeDetect(){
-	kernel := [3][3]float64{
-		{-1, -1, -1},
-		{-1, 8, -1},
-		{-1, -1, -1},
+// Applies a 3x3 kernel to the luminance (average of rgb) around (x, y), whose neighbors must all be inside the
+// input's bounds
+func (img *Image) lumaKernelSum(x int, y int, kernel [3][3]float64) float64 {
+	sum := float64(0)
+	for kRow := 0; kRow < 3; kRow++ {
+		for kCol := 0; kCol < 3; kCol++ {
+			r, g, b, _ := img.in.At(x+kCol-1, y+kRow-1).RGBA()
+			sum += kernel[kRow][kCol] * float64(r+g+b) / 3
+		}
+	}
+	return sum
+}
+
+// Applies a 3x3 kernel to the luminance (average of rgb) around (x, y), reading out of bounds pixels as Edges says
+func (img *Image) lumaKernelApply(x int, y int, kernel [3][3]float64, bounds image.Rectangle) float64 {
+	sum := float64(0)
+	for kRow := 0; kRow < 3; kRow++ {
+		for kCol := 0; kCol < 3; kCol++ {
+			imgX, inX := edgeColumn(x+kCol-1, bounds.Min.X, bounds.Max.X)
+			imgY, inY := edgeRow(y+kRow-1, bounds.Min.Y, bounds.Max.Y)
+			if !inX || !inY {
+				continue
+			}
+			r, g, b, _ := img.in.At(imgX, imgY).RGBA()
+			sum += kernel[kRow][kCol] * float64(r+g+b) / 3
+		}
+	}
+	return sum
+}
+
+// Convolve applies an arbitrary square kernel (for example one built with the kernel package) to the image,
+// reading out of bounds pixels as Edges says and keeping the alpha value of each center pixel. 3x3 kernels, by far
+// the most common, take the same blocked and unrolled path as the built in kernel effects
+func (img *Image) Convolve(k kernel.Kernel) {
+	if k.Size() == 3 {
+		img.convolve3x3([3][3]float64{
+			{k[0][0], k[0][1], k[0][2]},
+			{k[1][0], k[1][1], k[1][2]},
+			{k[2][0], k[2][1], k[2][2]},
+		})
+		return
+	}
+	radius := k.Radius()
+	bounds := img.out.Bounds()
+	debugColor, low, high, debug := kernelDebugRange()
+	rgba64, _ := img.in.(*image.RGBA64)
+	rowSpans(bounds, bounds.Min.Y, bounds.Max.Y, radius, func(y int, minX int, maxX int, inside bool) {
+		for x := minX; x < maxX; x++ {
+			var r, g, b float64
+			if inside {
+				r, g, b = img.kernelSum(x, y, k, rgba64)
+			} else {
+				r, g, b = img.kernelSumBorder(x, y, k)
+			}
+			if debug && (outOfRange(r, low, high) || outOfRange(g, low, high) || outOfRange(b, low, high)) {
+				img.out.Set(x, y, debugColor)
+				continue
+			}
+			_, _, _, a := img.in.At(x, y).RGBA()
+			img.out.Set(x, y, color.RGBA64{clamp(r), clamp(g), clamp(b), uint16(a)})
+		}
+	})
+}
+
+// Returns the rgb sums of k around (x, y), whose kernel must stay inside the input's bounds. The kernel is flipped
+// both ways, same as convolve3x3. rgba64 is the input if it is an *image.RGBA64, whose pixel buffer is then read
+// directly, and nil otherwise
+func (img *Image) kernelSum(x int, y int, k kernel.Kernel, rgba64 *image.RGBA64) (float64, float64, float64) {
+	var r, g, b float64
+	size := len(k)
+	radius := size / 2
+	for kRow := 0; kRow < size; kRow++ {
+		weights := k[size-1-kRow]
+		if rgba64 != nil {
+			start := rgba64.PixOffset(x-radius, y+kRow-radius)
+			row := rgba64.Pix[start : start+8*size]
+			for kCol := 0; kCol < size; kCol++ {
+				s := row[8*kCol : 8*kCol+8 : 8*kCol+8]
+				weight := weights[size-1-kCol]
+				r += weight * float64(uint16(s[0])<<8|uint16(s[1]))
+				g += weight * float64(uint16(s[2])<<8|uint16(s[3]))
+				b += weight * float64(uint16(s[4])<<8|uint16(s[5]))
+			}
+			continue
+		}
+		for kCol := 0; kCol < size; kCol++ {
+			pr, pg, pb, _ := img.in.At(x+kCol-radius, y+kRow-radius).RGBA()
+			weight := weights[size-1-kCol]
+			r += weight * float64(pr)
+			g += weight * float64(pg)
+			b += weight * float64(pb)
+		}
+	}
+	return r, g, b
+}
+
+// kernelSum for pixels whose kernel reaches past the input's edges, reading pixels there as Edges says
+func (img *Image) kernelSumBorder(x int, y int, k kernel.Kernel) (float64, float64, float64) {
+	var r, g, b float64
+	size, radius := k.Size(), k.Radius()
+	bounds := img.in.Bounds()
+	for kRow := 0; kRow < size; kRow++ {
+		imgY, inY := edgeRow(y+kRow-radius, bounds.Min.Y, bounds.Max.Y)
+		if !inY {
+			continue
+		}
+		weights := k[size-1-kRow]
+		for kCol := 0; kCol < size; kCol++ {
+			imgX, inX := edgeColumn(x+kCol-radius, bounds.Min.X, bounds.Max.X)
+			if !inX {
+				continue
+			}
+			pr, pg, pb, _ := img.in.At(imgX, imgY).RGBA()
+			weight := weights[size-1-kCol]
+			r += weight * float64(pr)
+			g += weight * float64(pg)
+			b += weight * float64(pb)
+		}
 	}
+	return r, g, b
+}
 
+// AutoLevels stretches each color channel so that the darkest lowClip percent of pixels become black and the
+// brightest highClip percent become white. The percentiles are taken over the whole image, so it must not be
+// applied to subimages independently
+func (img *Image) AutoLevels(lowClip float64, highClip float64) {
 	bounds := img.out.Bounds()
+	var histogram [3][]int
+	for c := range histogram {
+		histogram[c] = make([]int, 65536)
+	}
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			v := img.kernelApply(x, y, kernel, bounds)
-			img.out.Set(x, y, color.RGBA64{v[0], v[1], v[2], v[3]})
+			r, g, b, _ := img.in.At(x, y).RGBA()
+			histogram[0][r]++
+			histogram[1][g]++
+			histogram[2][b]++
 		}
 	}
-}
 
-//Performs a blur effect
-func (img *Image) Blur(){
-	kernel := [3][3]float64{
-		{1.0/9.0, 1.0/9.0, 1.0/9.0},
-		{1.0/9.0, 1.0/9.0, 1.0/9.0},
-		{1.0/9.0, 1.0/9.0, 1.0/9.0},
+	//find the channel values at the low and high percentiles
+	numPixels := bounds.Dx() * bounds.Dy()
+	var low, high [3]float64
+	for c := range histogram {
+		lowCount := int(float64(numPixels) * lowClip / 100)
+		highCount := int(float64(numPixels) * (100 - highClip) / 100)
+		seen := 0
+		low[c], high[c] = 0, 65535
+		for v, count := range histogram[c] {
+			if seen <= lowCount && seen+count > lowCount {
+				low[c] = float64(v)
+			}
+			if seen < highCount && seen+count >= highCount {
+				high[c] = float64(v)
+			}
+			seen += count
+		}
+	}
+
+	stretch := func(c int, v uint32) uint16 {
+		if high[c] <= low[c] {
+			return uint16(v)
+		}
+		return clamp((float64(v) - low[c]) / (high[c] - low[c]) * 65535)
 	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA()
+			img.out.Set(x, y, color.RGBA64{stretch(0, r), stretch(1, g), stretch(2, b), uint16(a)})
+		}
+	}
+}
 
+// ShadowsHighlights brightens dark areas by the shadows strength and darkens bright areas by the highlights
+// strength (both from 0 for no change to 1 for the strongest recovery), leaving midtones mostly untouched.
+// Colors are kept by scaling r, g and b by the same factor
+func (img *Image) ShadowsHighlights(shadows float64, highlights float64) {
 	bounds := img.out.Bounds()
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			v := img.kernelApply(x, y, kernel, bounds)
-			img.out.Set(x, y, color.RGBA64{v[0], v[1], v[2], v[3]})
+			r, g, b, a := img.in.At(x, y).RGBA()
+			luma := float64(r+g+b) / 3 / 65535
+			if luma == 0 {
+				luma = 1.0 / 65535
+			}
+
+			//shadows only affect the darker half of the range and highlights the brighter half
+			shadowWeight := math.Pow(math.Max(0, 1-luma/0.5), 2)
+			highlightWeight := math.Pow(math.Max(0, (luma-0.5)/0.5), 2)
+			lifted := math.Pow(luma, 1/(1+shadows))
+			recovered := math.Pow(luma, 1+highlights)
+			target := luma + shadowWeight*(lifted-luma) + highlightWeight*(recovered-luma)
+
+			gain := target / luma
+			img.out.Set(x, y, color.RGBA64{
+				clamp(float64(r) * gain), clamp(float64(g) * gain), clamp(float64(b) * gain), uint16(a)})
 		}
 	}
 }
 
-func(img * Image) kernelApply(x int, y int, kernel [3][3]float64, bounds image.Rectangle) [4]uint16 {
-	rTransformed := float64(0)
-	gTransformed := float64(0)
-	bTransformed := float64(0)
-	a := float64(0)
+// AdaptiveSharpen sharpens the image by adding back each pixel's difference from the mean of its neighborhood
+// (radius pixels on each side), scaled by strength. The scale is reduced where the local standard deviation of
+// the luminance is close to or below noise (on the 0-255 scale), so flat regions don't get their noise amplified
+func (img *Image) AdaptiveSharpen(strength float64, radius int, noise float64) {
+	bounds := img.out.Bounds()
+	channel := func(c int) func(x int, y int) uint64 {
+		return func(x int, y int) uint64 {
+			r, g, b, _ := img.in.At(x, y).RGBA()
+			return uint64([3]uint32{r, g, b}[c])
+		}
+	}
 
-	for kRow := 0; kRow < 3; kRow++{
-		for kCol := 0; kCol < 3; kCol++{
-			imgRow := x + kRow - 1
-			imgCol := y + kCol - 1
-			if imgRow < 0 || imgRow > bounds.Max.X || imgCol < 0 || imgCol > bounds.Max.Y {
-				//if index is out of bounds, pad with 0 values
-			} else {
-				r, g, b, a_temp := img.in.At(imgRow, imgCol).RGBA()
+	//luminance is kept as the integer r+g+b, three times the average, so its sums stay exact
+	lumaTimes3 := func(x int, y int) uint64 {
+		r, g, b, _ := img.in.At(x, y).RGBA()
+		return uint64(r + g + b)
+	}
+	means := [3]*IntegralImage{
+		NewIntegralImage(bounds, channel(0)), NewIntegralImage(bounds, channel(1)), NewIntegralImage(bounds, channel(2))}
+	lumaSums := NewIntegralImage(bounds, lumaTimes3)
+	lumaSquares := NewIntegralImage(bounds, func(x int, y int) uint64 {
+		l := lumaTimes3(x, y)
+		return l * l
+	})
 
-				// as defined by http://www.songho.ca/dsp/convolution/convolution2d_example.html
-				// we need to flip kernel horizonal and vertical ways
-				rTransformed += kernel[2-kRow][2-kCol] * float64(r)
-				gTransformed += kernel[2-kRow][2-kCol] * float64(g)
-				bTransformed += kernel[2-kRow][2-kCol] * float64(b)
+	noiseVariance := (3 * noise * 257) * (3 * noise * 257) // on the same r+g+b scale as the luminance
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mean := lumaSums.Mean(x, y, radius)
+			variance := math.Max(0, lumaSquares.Mean(x, y, radius)-mean*mean)
+			gain := strength * variance / (variance + noiseVariance)
 
-				//take the original alpha value at our center coordinate
-				if imgRow == x && imgCol == y {
-					a = float64(a_temp)
-				}
+			r, g, b, a := img.in.At(x, y).RGBA()
+			var v [3]uint16
+			for c, value := range [3]uint32{r, g, b} {
+				detail := float64(value) - means[c].Mean(x, y, radius)
+				v[c] = clamp(float64(value) + gain*detail)
 			}
+			img.out.Set(x, y, color.RGBA64{v[0], v[1], v[2], uint16(a)})
 		}
 	}
-	return [4]uint16{clamp(rTransformed), clamp(gTransformed), clamp(bTransformed), clamp(a)}
-}
\ No newline at end of file
+}
@@ -0,0 +1,28 @@
+package png
+
+import (
+	"image/color"
+)
+
+// Flatten composites the image over an opaque background color, so transparent pixels take on the background and
+// every pixel of the output is opaque. Formats without an alpha channel need images flattened first, or their
+// transparent pixels come out black
+func (img *Image) Flatten(background color.Color) {
+	br, bg, bb, _ := background.RGBA()
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA() //premultiplied, so the background fills in what alpha leaves
+			img.out.SetRGBA64(x, y, color.RGBA64{R: over(r, br, a), G: over(g, bg, a), B: over(b, bb, a), A: 0xffff})
+		}
+	}
+}
+
+// Returns a premultiplied channel c with alpha a over the same channel of an opaque background
+func over(c uint32, background uint32, a uint32) uint16 {
+	v := c + (background*(0xffff-a)+0x7fff)/0xffff
+	if v > 0xffff { //channels brighter than their alpha, which effects can leave behind
+		v = 0xffff
+	}
+	return uint16(v)
+}
@@ -0,0 +1,116 @@
+package png
+
+import (
+	"image"
+	"image/color"
+)
+
+// FloatImage holds a working copy of an image as float32 per channel, so chained effects can be applied without
+// the clamping and uint16 rounding that happens between effects on an Image. Values use the same 0-65535 scale
+// as color.RGBA64 but are allowed to leave that range until Store is called.
+type FloatImage struct {
+	Rect image.Rectangle
+	Pix  []float32 // r, g, b, a values for each pixel in row-major order
+}
+
+// NewFloatImage converts the input pixels of img into a FloatImage
+func NewFloatImage(img *Image) *FloatImage {
+	bounds := img.in.Bounds()
+	f := &FloatImage{Rect: bounds, Pix: make([]float32, 4*bounds.Dx()*bounds.Dy())}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.in.At(x, y).RGBA()
+			i := f.offset(x, y)
+			f.Pix[i], f.Pix[i+1], f.Pix[i+2], f.Pix[i+3] = float32(r), float32(g), float32(b), float32(a)
+		}
+	}
+	return f
+}
+
+// NewFloatImageLike returns an empty FloatImage with the same bounds as f, to be used as an effect's destination
+func NewFloatImageLike(f *FloatImage) *FloatImage {
+	return &FloatImage{Rect: f.Rect, Pix: make([]float32, len(f.Pix))}
+}
+
+// Store quantizes the float pixels into the output pixels of img. This is the only place clamping happens.
+func (f *FloatImage) Store(img *Image) {
+	for y := f.Rect.Min.Y; y < f.Rect.Max.Y; y++ {
+		for x := f.Rect.Min.X; x < f.Rect.Max.X; x++ {
+			i := f.offset(x, y)
+			img.out.Set(x, y, color.RGBA64{
+				clamp(float64(f.Pix[i])), clamp(float64(f.Pix[i+1])),
+				clamp(float64(f.Pix[i+2])), clamp(float64(f.Pix[i+3]))})
+		}
+	}
+}
+
+// Grayscale writes the grayscale of rows [minY, maxY) of f into dst
+func (f *FloatImage) Grayscale(dst *FloatImage, minY int, maxY int) {
+	for y := minY; y < maxY; y++ {
+		for x := f.Rect.Min.X; x < f.Rect.Max.X; x++ {
+			i := f.offset(x, y)
+			grey := (f.Pix[i] + f.Pix[i+1] + f.Pix[i+2]) / 3
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = grey, grey, grey, f.Pix[i+3]
+		}
+	}
+}
+
+// Sharpen writes the sharpened rows [minY, maxY) of f into dst
+func (f *FloatImage) Sharpen(dst *FloatImage, minY int, maxY int) {
+	f.convolve(dst, sharpenKernel, minY, maxY)
+}
+
+// EdgeDetect writes the edge-detected rows [minY, maxY) of f into dst
+func (f *FloatImage) EdgeDetect(dst *FloatImage, minY int, maxY int) {
+	f.convolve(dst, edgeDetectKernel, minY, maxY)
+}
+
+// Blur writes the blurred rows [minY, maxY) of f into dst
+func (f *FloatImage) Blur(dst *FloatImage, minY int, maxY int) {
+	f.convolve(dst, blurKernel, minY, maxY)
+}
+
+// Convolves rows [minY, maxY) of f with a 3x3 kernel into dst, reading out of bounds pixels as Edges says and
+// keeping the alpha value of the center pixel. Only the pixels on the image's edges check for out of bounds
+// neighbors
+func (f *FloatImage) convolve(dst *FloatImage, kernel [3][3]float64, minY int, maxY int) {
+	stride := 4 * f.Rect.Dx()
+	rowSpans(f.Rect, minY, maxY, 1, func(y int, minX int, maxX int, inside bool) {
+		for x := minX; x < maxX; x++ {
+			var r, g, b float64
+			i := f.offset(x, y)
+			if inside {
+				for kRow := 0; kRow < 3; kRow++ {
+					row := f.Pix[i+(kRow-1)*stride-4 : i+(kRow-1)*stride+8]
+					for kCol := 0; kCol < 3; kCol++ {
+						k := kernel[2-kRow][2-kCol]
+						r += k * float64(row[4*kCol])
+						g += k * float64(row[4*kCol+1])
+						b += k * float64(row[4*kCol+2])
+					}
+				}
+			} else {
+				for kRow := 0; kRow < 3; kRow++ {
+					for kCol := 0; kCol < 3; kCol++ {
+						imgX, inX := edgeColumn(x+kCol-1, f.Rect.Min.X, f.Rect.Max.X)
+						imgY, inY := edgeRow(y+kRow-1, f.Rect.Min.Y, f.Rect.Max.Y)
+						if !inX || !inY {
+							continue
+						}
+						j := f.offset(imgX, imgY)
+						k := kernel[2-kRow][2-kCol]
+						r += k * float64(f.Pix[j])
+						g += k * float64(f.Pix[j+1])
+						b += k * float64(f.Pix[j+2])
+					}
+				}
+			}
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = float32(r), float32(g), float32(b), f.Pix[i+3]
+		}
+	})
+}
+
+// Index into Pix of the red value of pixel (x, y)
+func (f *FloatImage) offset(x int, y int) int {
+	return 4 * ((y-f.Rect.Min.Y)*f.Rect.Dx() + (x - f.Rect.Min.X))
+}
@@ -0,0 +1,59 @@
+package png
+
+import (
+	"image/color"
+)
+
+// GradientStop is a color of a gradient map and the luminance (0 for black to 1 for white) it is placed at
+type GradientStop struct {
+	Color    color.Color
+	Position float64
+}
+
+// GradientMap replaces the color of every pixel by the color its luminance falls on in a gradient through stops,
+// which must be sorted by position. Two stops make a duotone, three a tritone. Luminances before the first stop or
+// after the last one get that stop's color, and colors in between are interpolated linearly. Alpha is kept
+func (img *Image) GradientMap(stops []GradientStop) {
+	if len(stops) == 0 {
+		img.mapColors(func(c color.NRGBA64) color.NRGBA64 { return c })
+		return
+	}
+	positions := make([]float64, len(stops))
+	colors := make([][3]float64, len(stops))
+	for i, stop := range stops {
+		c := color.NRGBA64Model.Convert(stop.Color).(color.NRGBA64)
+		positions[i] = stop.Position
+		colors[i] = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	}
+
+	img.mapColors(func(c color.NRGBA64) color.NRGBA64 {
+		//Rec. 709 luma, so the gradient follows perceived brightness rather than the plain average of the channels
+		luma := (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 65535
+		i := 0
+		for i < len(stops) && positions[i] < luma {
+			i++
+		}
+		var mapped [3]float64
+		if i == 0 {
+			mapped = colors[0]
+		} else if i == len(stops) {
+			mapped = colors[len(stops)-1]
+		} else {
+			t := (luma - positions[i-1]) / (positions[i] - positions[i-1])
+			for ch := range mapped {
+				mapped[ch] = colors[i-1][ch] + t*(colors[i][ch]-colors[i-1][ch])
+			}
+		}
+		return color.NRGBA64{clamp(mapped[0]), clamp(mapped[1]), clamp(mapped[2]), c.A}
+	})
+}
+
+// Replaces the color of every pixel by f of its unpremultiplied color
+func (img *Image) mapColors(f func(c color.NRGBA64) color.NRGBA64) {
+	bounds := img.out.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.out.Set(x, y, f(color.NRGBA64Model.Convert(img.in.At(x, y)).(color.NRGBA64)))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package png
+
+import (
+	"image"
+	"math/bits"
+)
+
+// DifferenceHash returns a 64 bit perceptual hash (dHash) of img: the luminance is averaged down to a 9x8 grid and
+// each bit says whether a cell is brighter than its right neighbor. Resized, recompressed or slightly retouched
+// copies of an image get hashes a few bits apart, see HashDistance
+func DifferenceHash(img image.Image) uint64 {
+	const gridWidth, gridHeight = 9, 8
+	bounds := img.Bounds()
+	var grid [gridHeight][gridWidth]float64
+	var counts [gridHeight][gridWidth]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * gridHeight / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * gridWidth / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			grid[cellY][cellX] += float64(r+g+b) / 3
+			counts[cellY][cellX]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < gridHeight; y++ {
+		for x := 0; x < gridWidth-1; x++ {
+			left := grid[y][x] / float64(maxInt(counts[y][x], 1))
+			right := grid[y][x+1] / float64(maxInt(counts[y][x+1], 1))
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashDistance returns the number of bits two perceptual hashes differ in, 0 for images that look the same
+func HashDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
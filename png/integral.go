@@ -0,0 +1,48 @@
+package png
+
+import "image"
+
+// IntegralImage holds running sums of an integer value over an image region, so the sum over any rectangle can
+// be found with 4 lookups no matter how big the rectangle is. Sums are kept as uint64 and are allowed to wrap
+// around: the sum over a rectangle still comes out exact as long as it fits in a uint64 itself. Being integers,
+// the results don't depend on where the region starts, so subimages give the same answers as the whole image
+type IntegralImage struct {
+	Rect image.Rectangle
+	sums []uint64 // sums[(y+1)*(width+1)+(x+1)] is the sum over all pixels above and to the left of (x, y)
+}
+
+// NewIntegralImage builds the integral image of value(x, y) over rect
+func NewIntegralImage(rect image.Rectangle, value func(x int, y int) uint64) *IntegralImage {
+	width := rect.Dx()
+	ii := &IntegralImage{Rect: rect, sums: make([]uint64, (width+1)*(rect.Dy()+1))}
+	for y := 0; y < rect.Dy(); y++ {
+		rowSum := uint64(0)
+		for x := 0; x < width; x++ {
+			rowSum += value(x+rect.Min.X, y+rect.Min.Y)
+			ii.sums[(y+1)*(width+1)+x+1] = ii.sums[y*(width+1)+x+1] + rowSum
+		}
+	}
+	return ii
+}
+
+// Sum returns the sum of the values over r, clipped to the integral image's bounds
+func (ii *IntegralImage) Sum(r image.Rectangle) uint64 {
+	r = r.Intersect(ii.Rect)
+	if r.Empty() {
+		return 0
+	}
+	width := ii.Rect.Dx() + 1
+	x0, y0 := r.Min.X-ii.Rect.Min.X, r.Min.Y-ii.Rect.Min.Y
+	x1, y1 := r.Max.X-ii.Rect.Min.X, r.Max.Y-ii.Rect.Min.Y
+	return ii.sums[y1*width+x1] - ii.sums[y0*width+x1] - ii.sums[y1*width+x0] + ii.sums[y0*width+x0]
+}
+
+// Mean returns the average value over the square of the given radius around (x, y), ignoring the parts of the
+// square outside of the integral image's bounds
+func (ii *IntegralImage) Mean(x int, y int, radius int) float64 {
+	r := image.Rect(x-radius, y-radius, x+radius+1, y+radius+1).Intersect(ii.Rect)
+	if r.Empty() {
+		return 0
+	}
+	return float64(ii.Sum(r)) / float64(r.Dx()*r.Dy())
+}
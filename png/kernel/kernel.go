@@ -0,0 +1,119 @@
+// Package kernel builds convolution kernels that can be applied to an image
+// with png.Image's Convolve effect.
+package kernel
+
+import (
+	"fmt"
+	"math"
+)
+
+// Kernel is a square convolution matrix with an odd number of rows and columns, indexed as kernel[row][col]
+type Kernel [][]float64
+
+// New returns a size x size kernel of zeros. Panics if size is not a positive odd number
+func New(size int) Kernel {
+	if size < 1 || size%2 == 0 {
+		panic(fmt.Sprintf("kernel: size must be a positive odd number, got %d", size))
+	}
+	k := make(Kernel, size)
+	for row := range k {
+		k[row] = make([]float64, size)
+	}
+	return k
+}
+
+// Identity returns a size x size kernel that leaves an image unchanged
+func Identity(size int) Kernel {
+	k := New(size)
+	k[size/2][size/2] = 1
+	return k
+}
+
+// Box returns an n x n averaging kernel
+func Box(n int) Kernel {
+	k := New(n)
+	for row := range k {
+		for col := range k[row] {
+			k[row][col] = 1 / float64(n*n)
+		}
+	}
+	return k
+}
+
+// Laplacian returns the 3x3 Laplacian kernel of the edge detect effect, which responds to changes in every
+// direction and sums to 0, so flat regions come out as 0
+func Laplacian() Kernel {
+	return Kernel{
+		{-1, -1, -1},
+		{-1, 8, -1},
+		{-1, -1, -1},
+	}
+}
+
+// Gaussian returns a normalized Gaussian blur kernel with standard deviation sigma, sized to cover 3 sigma on
+// each side of the center
+func Gaussian(sigma float64) Kernel {
+	if sigma <= 0 {
+		panic(fmt.Sprintf("kernel: sigma must be positive, got %g", sigma))
+	}
+	radius := int(math.Ceil(3 * sigma))
+	k := New(2*radius + 1)
+	sum := float64(0)
+	for row := range k {
+		for col := range k[row] {
+			dy := float64(row - radius)
+			dx := float64(col - radius)
+			k[row][col] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+			sum += k[row][col]
+		}
+	}
+	return Scale(k, 1/sum)
+}
+
+// Scale returns a copy of k with every weight multiplied by f
+func Scale(k Kernel, f float64) Kernel {
+	scaled := New(k.Size())
+	for row := range k {
+		for col := range k[row] {
+			scaled[row][col] = k[row][col] * f
+		}
+	}
+	return scaled
+}
+
+// Compose returns the kernel equivalent to convolving an image with a and then with b. The result is
+// (a.Size() + b.Size() - 1) wide
+func Compose(a Kernel, b Kernel) Kernel {
+	k := New(a.Size() + b.Size() - 1)
+	for aRow := range a {
+		for aCol := range a[aRow] {
+			for bRow := range b {
+				for bCol := range b[bRow] {
+					k[aRow+bRow][aCol+bCol] += a[aRow][aCol] * b[bRow][bCol]
+				}
+			}
+		}
+	}
+	return k
+}
+
+// Size returns the number of rows (and columns) of k
+func (k Kernel) Size() int {
+	return len(k)
+}
+
+// Radius returns how many pixels the kernel reaches on each side of its center
+func (k Kernel) Radius() int {
+	return len(k) / 2
+}
+
+// Sum returns the sum of all weights, which is 1 for kernels that preserve brightness
+func (k Kernel) Sum() float64 {
+	sum := float64(0)
+	for row := range k {
+		for col := range k[row] {
+			sum += k[row][col]
+		}
+	}
+	return sum
+}
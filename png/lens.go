@@ -0,0 +1,81 @@
+package png
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Undistort corrects radial lens distortion with the Brown-Conrady model: the output pixel at distance r from the
+// image's center, as a fraction of half its diagonal, is read from the input at r*(1 + k1*r^2 + k2*r^4) along the
+// same ray, interpolated bilinearly. Barrel distortion, which bows straight lines outward, is corrected by a
+// negative k1, and pincushion distortion by a positive one. Pixels read past the input's edges are read as Edges
+// says, so with EdgeZero the corners the correction pulls in are transparent
+func (img *Image) Undistort(k1 float64, k2 float64) {
+	bounds := img.out.Bounds()
+	centerX := float64(bounds.Min.X+bounds.Max.X) / 2
+	centerY := float64(bounds.Min.Y+bounds.Max.Y) / 2
+	halfDiagonal := math.Hypot(float64(bounds.Dx()), float64(bounds.Dy())) / 2
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dx, dy := float64(x)+0.5-centerX, float64(y)+0.5-centerY
+			r2 := (dx*dx + dy*dy) / (halfDiagonal * halfDiagonal)
+			scale := 1 + k1*r2 + k2*r2*r2
+			img.out.SetRGBA64(x, y, img.bilinear(centerX+dx*scale-0.5, centerY+dy*scale-0.5))
+		}
+	}
+}
+
+// Returns the input interpolated at (x, y), where whole coordinates are the centers of pixels, reading pixels past
+// the input's edges as Edges says
+func (img *Image) bilinear(x float64, y float64) color.RGBA64 {
+	inBounds := img.in.Bounds()
+	x0, y0 := math.Floor(x), math.Floor(y)
+	tx, ty := x-x0, y-y0
+	var sum [4]float64
+	for i, w := range [4]float64{(1 - tx) * (1 - ty), tx * (1 - ty), (1 - tx) * ty, tx * ty} {
+		if w == 0 {
+			continue
+		}
+		p := image.Pt(int(x0)+i%2, int(y0)+i/2)
+		px, inX := edgeColumn(p.X, inBounds.Min.X, inBounds.Max.X)
+		py, inY := edgeRow(p.Y, inBounds.Min.Y, inBounds.Max.Y)
+		if !inX || !inY {
+			continue
+		}
+		r, g, b, a := img.in.At(px, py).RGBA()
+		sum[0] += w * float64(r)
+		sum[1] += w * float64(g)
+		sum[2] += w * float64(b)
+		sum[3] += w * float64(a)
+	}
+	return color.RGBA64{R: round16(sum[0]), G: round16(sum[1]), B: round16(sum[2]), A: round16(sum[3])}
+}
+
+// Devignette compensates the vignetting of a lens, which darkens the image toward its corners, by brightening each
+// pixel at distance r from the center, as a fraction of half the image's diagonal, by 1/(1 - amount*r^falloff):
+// amount is the fraction of brightness the corners lose, and falloff how quickly the loss grows toward them (2 for
+// the usual, roughly quadratic, falloff). Like DivideFlatField, which corrects a measured vignette, it scales the
+// stored channel values and keeps alpha
+func (img *Image) Devignette(amount float64, falloff float64) {
+	bounds := img.out.Bounds()
+	centerX := float64(bounds.Min.X+bounds.Max.X) / 2
+	centerY := float64(bounds.Min.Y+bounds.Max.Y) / 2
+	halfDiagonal := math.Hypot(float64(bounds.Dx()), float64(bounds.Dy())) / 2
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r := math.Hypot(float64(x)+0.5-centerX, float64(y)+0.5-centerY) / halfDiagonal
+			gain := 1 / (1 - amount*math.Pow(r, falloff))
+			c := color.RGBA64Model.Convert(img.in.At(x, y)).(color.RGBA64)
+			//premultiplied channels can't be brighter than alpha
+			limit := float64(c.A)
+			img.out.SetRGBA64(x, y, color.RGBA64{R: round16(math.Min(limit, float64(c.R)*gain)),
+				G: round16(math.Min(limit, float64(c.G)*gain)), B: round16(math.Min(limit, float64(c.B)*gain)), A: c.A})
+		}
+	}
+}
+
+// Rounds a 16 bit value computed in floating point, clamping it to 0-65535
+func round16(v float64) uint16 {
+	return clamp(math.Round(v))
+}
@@ -0,0 +1,44 @@
+package png
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Output returns the image's output pixels, which hold the result of the last effect applied
+func (img *Image) Output() image.Image {
+	return img.out
+}
+
+// MismatchedPixels returns how many pixels of img's output differ from other's output. Pixels outside of either
+// image's bounds count as mismatches
+func (img *Image) MismatchedPixels(other *Image) int {
+	bounds := img.out.Bounds()
+	otherBounds := other.out.Bounds()
+	common := bounds.Intersect(otherBounds)
+	mismatches := bounds.Dx()*bounds.Dy() + otherBounds.Dx()*otherBounds.Dy() - 2*common.Dx()*common.Dy()
+	for y := common.Min.Y; y < common.Max.Y; y++ {
+		for x := common.Min.X; x < common.Max.X; x++ {
+			if img.out.RGBA64At(x, y) != other.out.RGBA64At(x, y) {
+				mismatches++
+			}
+		}
+	}
+	return mismatches
+}
+
+// FromImage returns an Image whose input pixels are src, for images that weren't loaded with Load, such as other
+// formats than png
+func FromImage(src image.Image) *Image {
+	return &Image{in: src, out: image.NewRGBA64(src.Bounds())}
+}
+
+// KeepInput sets the image's output pixels to its input pixels, the result of applying no effects
+func (img *Image) KeepInput() {
+	draw.Draw(img.out, img.out.Bounds(), img.in, img.out.Bounds().Min, draw.Src)
+}
+
+// Input returns the image's input pixels, which the next effect applied reads
+func (img *Image) Input() image.Image {
+	return img.in
+}
@@ -0,0 +1,93 @@
+package png
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+)
+
+// Rows of each 5x7 glyph of the stamp font, top to bottom, with the leftmost column in bit 4. Letters are upper
+// case only: Stamp draws lower case letters with their upper case glyph
+var glyphs = map[rune][7]uint8{
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11}, 'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E}, 'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F}, 'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F}, 'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E}, 'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11}, 'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11}, 'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, 'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D}, 'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E}, 'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, 'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A}, 'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04}, 'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E}, '1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F}, '3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02}, '5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E}, '7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E}, '9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	' ': {}, '.': {0, 0, 0, 0, 0, 0x0C, 0x0C}, ',': {0, 0, 0, 0, 0x0C, 0x04, 0x08},
+	':': {0, 0x0C, 0x0C, 0, 0x0C, 0x0C, 0}, '=': {0, 0, 0x1F, 0, 0x1F, 0, 0}, '-': {0, 0, 0, 0x1F, 0, 0, 0},
+	'+': {0, 0x04, 0x04, 0x1F, 0x04, 0x04, 0}, '/': {0, 0x01, 0x02, 0x04, 0x08, 0x10, 0},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02}, ')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'[': {0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E}, ']': {0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E},
+	'{': {0x02, 0x04, 0x04, 0x08, 0x04, 0x04, 0x02}, '}': {0x08, 0x04, 0x04, 0x02, 0x04, 0x04, 0x08},
+	'"': {0x0A, 0x0A, 0, 0, 0, 0, 0}, '#': {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	'_': {0, 0, 0, 0, 0, 0, 0x1F}, '%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'<': {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02}, '>': {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+}
+
+// Drawn for characters the stamp font has no glyph for
+var missingGlyph = [7]uint8{0x1F, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1F}
+
+// Stamp writes lines of text in the bottom left corner of the image's output, in white on a darkened, opaque
+// background, so the text stays readable on any image. Glyphs are scaled up with the image, about one glyph
+// pixel per 400 image pixels of width. Text that doesn't fit is cut off at the image's edges
+func (img *Image) Stamp(lines []string) {
+	bounds := img.out.Bounds()
+	scale := bounds.Dx()/400 + 1
+	lineHeight := 9 * scale
+	longest := 0
+	for _, line := range lines {
+		if n := len([]rune(line)); n > longest {
+			longest = n
+		}
+	}
+	box := image.Rect(bounds.Min.X, bounds.Max.Y-len(lines)*lineHeight-2*scale,
+		bounds.Min.X+longest*6*scale+3*scale, bounds.Max.Y).Intersect(bounds)
+
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			c := img.out.RGBA64At(x, y)
+			img.out.SetRGBA64(x, y, color.RGBA64{c.R / 4, c.G / 4, c.B / 4, 0xffff})
+		}
+	}
+	white := color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}
+	for i, line := range lines {
+		top := box.Min.Y + 2*scale + i*lineHeight
+		left := bounds.Min.X + 2*scale
+		for _, r := range strings.ToUpper(line) {
+			glyph, ok := glyphs[unicode.ToUpper(r)]
+			if !ok {
+				glyph = missingGlyph
+			}
+			for row := 0; row < 7; row++ {
+				for col := 0; col < 5; col++ {
+					if glyph[row]&(0x10>>col) == 0 {
+						continue
+					}
+					dot := image.Rect(left+col*scale, top+row*scale, left+(col+1)*scale, top+(row+1)*scale)
+					dot = dot.Intersect(bounds)
+					for y := dot.Min.Y; y < dot.Max.Y; y++ {
+						for x := dot.Min.X; x < dot.Max.X; x++ {
+							img.out.SetRGBA64(x, y, white)
+						}
+					}
+				}
+			}
+			left += 6 * scale
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package png
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail returns img scaled down to fit in size by size pixels, keeping its aspect ratio, and flattened over
+// white. Each pixel of the thumbnail averages the pixels of img it covers, so fine detail is smoothed rather than
+// aliased. Images that already fit are only flattened
+func Thumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, maxInt(1, height*size/bounds.Dx())
+		} else {
+			width, height = maxInt(1, width*size/bounds.Dy()), size
+		}
+	}
+	sums := make([]uint64, width*height*4)
+	counts := make([]uint64, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * height / bounds.Dy() * width
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := row + (x-bounds.Min.X)*width/bounds.Dx()
+			r, g, b, a := img.At(x, y).RGBA()
+			sums[i*4] += uint64(over(r, 0xffff, a))
+			sums[i*4+1] += uint64(over(g, 0xffff, a))
+			sums[i*4+2] += uint64(over(b, 0xffff, a))
+			counts[i]++
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, count := range counts {
+		count = count * 0x101 //from 16 to 8 bits
+		thumb.SetRGBA(i%width, i/width, color.RGBA{R: uint8((sums[i*4] + count/2) / count),
+			G: uint8((sums[i*4+1] + count/2) / count), B: uint8((sums[i*4+2] + count/2) / count), A: 0xff})
+	}
+	return thumb
+}
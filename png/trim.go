@@ -0,0 +1,64 @@
+package png
+
+import (
+	"image"
+	"math"
+)
+
+// TrimRect returns the part of the image's input left once its uniform borders are trimmed: the rows and columns
+// along each edge whose every pixel is within tolerance (0-255, on each channel and alpha) of the top left pixel.
+// The rectangle is empty if the whole image is uniform. The output is a copy of the input, so the image can go on
+// through a chain of effects unchanged
+func (img *Image) TrimRect(tolerance float64) image.Rectangle {
+	bounds := img.in.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.out.Set(x, y, img.in.At(x, y))
+		}
+	}
+	if bounds.Empty() {
+		return image.Rectangle{}
+	}
+
+	limit := tolerance * 257
+	r0, g0, b0, a0 := img.in.At(bounds.Min.X, bounds.Min.Y).RGBA()
+	border := func(x int, y int) bool {
+		r, g, b, a := img.in.At(x, y).RGBA()
+		return math.Abs(float64(r)-float64(r0)) <= limit && math.Abs(float64(g)-float64(g0)) <= limit &&
+			math.Abs(float64(b)-float64(b0)) <= limit && math.Abs(float64(a)-float64(a0)) <= limit
+	}
+	row := func(y int, minX int, maxX int) bool {
+		for x := minX; x < maxX; x++ {
+			if !border(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	column := func(x int, minY int, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !border(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	rect := bounds
+	for rect.Min.Y < rect.Max.Y && row(rect.Min.Y, rect.Min.X, rect.Max.X) {
+		rect.Min.Y++
+	}
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+	for row(rect.Max.Y-1, rect.Min.X, rect.Max.X) {
+		rect.Max.Y--
+	}
+	for column(rect.Min.X, rect.Min.Y, rect.Max.Y) {
+		rect.Min.X++
+	}
+	for column(rect.Max.X-1, rect.Min.Y, rect.Max.Y) {
+		rect.Max.X--
+	}
+	return rect
+}